@@ -0,0 +1,295 @@
+package loggy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// groupOrAttrs holds either a group name or a list of attributes that were added to a handler via WithGroup or
+// WithAttrs. Handlers that do their own encoding keep a slice of these so that they can qualify the attributes of a
+// record by the groups that were opened before them.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// withGroupOrAttrs returns a copy of goas with goa appended to it, so that handlers derived from the same parent do
+// not share a backing array.
+func withGroupOrAttrs(goas []groupOrAttrs, goa groupOrAttrs) []groupOrAttrs {
+	newGoas := make([]groupOrAttrs, len(goas), len(goas)+1)
+	copy(newGoas, goas)
+	return append(newGoas, goa)
+}
+
+// collectAttrs returns all the attributes that apply to a record - the ones added to the handler via WithAttrs and
+// the ones in the record itself - as a single list. Attributes that come after a group are nested inside it as group
+// attributes, and groups that end up with no attributes are omitted.
+//
+// Values are resolved, empty attributes are dropped and inline groups (groups with an empty key) are flattened into
+// their parent. If replace is not nil, it is called on every non-group attribute along with the groups it is in.
+func collectAttrs(goas []groupOrAttrs, record slog.Record, replace func([]string, slog.Attr) slog.Attr) []slog.Attr {
+	// Each level holds the attributes of one open group, the first level being the top level
+	type level struct {
+		name  string
+		attrs []slog.Attr
+	}
+	levels := []level{{}}
+	var groups []string
+
+	// Add the attributes and groups that were added to the handler
+	for _, goa := range goas {
+		if goa.group != "" {
+			groups = append(groups, goa.group)
+			levels = append(levels, level{name: goa.group})
+			continue
+		}
+		last := len(levels) - 1
+		levels[last].attrs = append(levels[last].attrs, resolveAttrs(groups, goa.attrs, replace)...)
+	}
+
+	// Add the attributes of the record to the innermost group
+	last := len(levels) - 1
+	if levels[last].attrs == nil {
+		levels[last].attrs = make([]slog.Attr, 0, record.NumAttrs())
+	}
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			levels[last].attrs = appendResolvedAttr(levels[last].attrs, groups, attr, replace)
+			return true
+		},
+	)
+
+	// Fold the groups into their parents, from the innermost outwards
+	for i := last; i > 0; i-- {
+		if len(levels[i].attrs) == 0 {
+			continue
+		}
+		levels[i-1].attrs = append(
+			levels[i-1].attrs, slog.Attr{Key: levels[i].name, Value: slog.GroupValue(levels[i].attrs...)},
+		)
+	}
+
+	return levels[0].attrs
+}
+
+// resolveAttrs resolves the values of the given attributes, drops empty attributes and groups, and inlines groups
+// with empty keys. If replace is not nil, it is called on every non-group attribute along with the given groups.
+func resolveAttrs(groups []string, attrs []slog.Attr, replace func([]string, slog.Attr) slog.Attr) []slog.Attr {
+	resolved := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		resolved = appendResolvedAttr(resolved, groups, attr, replace)
+	}
+	return resolved
+}
+
+// appendResolvedAttr resolves a single attribute the same way as resolveAttrs and appends the result to dst, so that
+// the attributes of a record can be resolved without allocating a slice for each of them.
+func appendResolvedAttr(
+	dst []slog.Attr, groups []string, attr slog.Attr, replace func([]string, slog.Attr) slog.Attr,
+) []slog.Attr {
+	attr.Value = attr.Value.Resolve()
+
+	// Groups are resolved recursively, and inlined if they have no key
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key == "" {
+			for _, groupAttr := range attr.Value.Group() {
+				dst = appendResolvedAttr(dst, groups, groupAttr, replace)
+			}
+			return dst
+		}
+
+		groupAttrs := resolveAttrs(append(groups[:len(groups):len(groups)], attr.Key), attr.Value.Group(), replace)
+		if len(groupAttrs) > 0 {
+			dst = append(dst, slog.Attr{Key: attr.Key, Value: slog.GroupValue(groupAttrs...)})
+		}
+		return dst
+	}
+
+	if replace != nil {
+		attr = replace(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	if attr.Equal(slog.Attr{}) {
+		return dst
+	}
+	return append(dst, attr)
+}
+
+// replaceBuiltin calls replace, if it is not nil, on one of the built-in attributes of a record (time, level,
+// message or source) so that handlers doing their own encoding honour slog.HandlerOptions.ReplaceAttr the same way
+// the handlers in the standard library do.
+func replaceBuiltin(replace func([]string, slog.Attr) slog.Attr, attr slog.Attr) slog.Attr {
+	if replace == nil {
+		return attr
+	}
+
+	attr = replace(nil, attr)
+	attr.Value = attr.Value.Resolve()
+	return attr
+}
+
+// replaceBuiltinTime calls replace, if it is not nil, on the time of a record for handlers that write times in their
+// own way, returning the time to write and whether it has not been removed. Times written in a format by TimeOpts are
+// written as the times they were formatted from, with the clock and location applied, since these handlers can't
+// write them in another format.
+func replaceBuiltinTime(replace func([]string, slog.Attr) slog.Attr, t time.Time) (time.Time, bool) {
+	if replace == nil {
+		return t, true
+	}
+
+	attr := replace(nil, slog.Time(slog.TimeKey, t))
+	if attr.Value.Kind() == slog.KindLogValuer {
+		if formatted, ok := attr.Value.Any().(formattedTime); ok {
+			return formatted.time, true
+		}
+	}
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() != slog.KindTime {
+		return time.Time{}, false
+	}
+	return attr.Value.Time(), true
+}
+
+// recordSource returns the source location of the record, or nil if the record has no program counter.
+func recordSource(record slog.Record) *slog.Source {
+	if record.PC == 0 {
+		return nil
+	}
+
+	frames := runtime.CallersFrames([]uintptr{record.PC})
+	frame, _ := frames.Next()
+	return &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+}
+
+// flattenAttrs calls fn for every non-group attribute in attrs, with the key qualified by the keys of the groups it is
+// in, joined by sep.
+func flattenAttrs(prefix, sep string, attrs []slog.Attr, fn func(key string, value slog.Value)) {
+	for _, attr := range attrs {
+		key := attr.Key
+		if prefix != "" {
+			key = prefix + sep + attr.Key
+		}
+
+		if attr.Value.Kind() == slog.KindGroup {
+			flattenAttrs(key, sep, attr.Value.Group(), fn)
+			continue
+		}
+
+		fn(key, attr.Value)
+	}
+}
+
+// valueToAny converts a resolved slog.Value into a value that can be marshalled into JSON by the encoding/json
+// package, turning groups into maps and errors into their messages.
+func valueToAny(value slog.Value) any {
+	switch value.Kind() {
+	case slog.KindString:
+		return value.String()
+	case slog.KindInt64:
+		return value.Int64()
+	case slog.KindUint64:
+		return value.Uint64()
+	case slog.KindFloat64:
+		return floatToJSON(value.Float64())
+	case slog.KindBool:
+		return value.Bool()
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindGroup:
+		group := make(map[string]any, len(value.Group()))
+		for _, attr := range value.Group() {
+			group[attr.Key] = valueToAny(attr.Value)
+		}
+		return group
+	default:
+		return anyToJSON(value.Any())
+	}
+}
+
+// anyToJSON converts an arbitrary value into something that encoding/json can marshal without failing, falling back to
+// its string representation. Nil pointers to types implementing error or fmt.Stringer are written as "<nil>", since
+// their methods usually can't be called on them.
+func anyToJSON(v any) any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case error:
+		if isNilPointer(v) {
+			return "<nil>"
+		}
+		return v.Error()
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return "<nil>"
+		}
+		return v.String()
+	}
+
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return v
+}
+
+// isNilPointer checks whether v is a nil pointer, the same way slog does before calling the methods of a value.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// floatToJSON returns the float as it is, or as the string "NaN", "+Inf" or "-Inf" if it is one of the values that
+// JSON can't represent, so that marshalling the rest of the record doesn't fail.
+func floatToJSON(f float64) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return f
+	}
+}
+
+// valueToString converts a resolved slog.Value into its string representation.
+func valueToString(value slog.Value) string {
+	switch value.Kind() {
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindGroup:
+		var builder strings.Builder
+		builder.WriteByte('{')
+		for i, attr := range value.Group() {
+			if i > 0 {
+				builder.WriteByte(' ')
+			}
+			builder.WriteString(attr.Key)
+			builder.WriteByte('=')
+			builder.WriteString(valueToString(attr.Value))
+		}
+		builder.WriteByte('}')
+		return builder.String()
+	default:
+		return value.String()
+	}
+}
+
+// recordWithAttrs returns a copy of record with its attributes replaced by attrs. Handlers that wrap other handlers
+// use it to pass on records with all the attributes they have collected, including the ones from WithAttrs and
+// WithGroup, so that they have control over where the attributes they add end up.
+func recordWithAttrs(record slog.Record, attrs []slog.Attr) slog.Record {
+	newRecord := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	newRecord.AddAttrs(attrs...)
+	return newRecord
+}
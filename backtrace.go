@@ -0,0 +1,203 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// backtraceKey is the key that the backtrace buffer is stored under in a context.
+type backtraceKey struct{}
+
+// backtraceEntry is a buffered record, along with the handler it has to be flushed to.
+type backtraceEntry struct {
+	owner   *BacktraceHandlerOpts
+	handler slog.Handler
+	record  slog.Record
+}
+
+// backtraceBuffer holds the records buffered in a context, separately for every BacktraceHandler.
+type backtraceBuffer struct {
+	mu     sync.Mutex
+	owners map[*BacktraceHandlerOpts]*backtraceRing
+}
+
+// backtraceRing holds the records buffered by a BacktraceHandler in a context, overwriting the oldest record once it
+// is full. It grows as records are added, up to the maximum number of records of the handler.
+type backtraceRing struct {
+	entries []backtraceEntry
+	head    int
+}
+
+// WithBacktrace returns a copy of ctx that carries a new buffer for BacktraceHandlers, typically at the start of a
+// request or job. Records logged with the returned context (or contexts derived from it) below the pass level of a
+// BacktraceHandler are held in the buffer until a record at its flush level is logged with it, and are discarded
+// along with the context otherwise. The middleware returned by NewHTTPMiddleware does this for every request, and logs
+// its access record without the buffer, so that the access record is always passed on, and the buffered records are
+// only flushed by the errors logged while serving the request.
+func WithBacktrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backtraceKey{}, &backtraceBuffer{})
+}
+
+// backtraceFromContext returns the buffer stored in ctx with WithBacktrace, or nil if there is none.
+func backtraceFromContext(ctx context.Context) *backtraceBuffer {
+	if ctx == nil {
+		return nil
+	}
+	buf, _ := ctx.Value(backtraceKey{}).(*backtraceBuffer)
+	return buf
+}
+
+// BacktraceHandlerOpts represents the options for configuring the behaviour of the `BacktraceHandler`.
+type BacktraceHandlerOpts struct {
+	// Level is the minimum level of the records that are buffered. By default, it is slog.LevelDebug.
+	Level slog.Leveler
+
+	// PassLevel is the level from which records are passed on to the wrapped handler straight away instead of being
+	// buffered. By default, it is slog.LevelWarn.
+	PassLevel slog.Leveler
+
+	// FlushLevel is the level of the records that flush the buffered records to the wrapped handler before being
+	// passed on themselves. By default, it is slog.LevelError.
+	FlushLevel slog.Leveler
+
+	// MaxRecords is the maximum number of records buffered per context by the handler. Once it is reached, the oldest
+	// record is dropped for every new one. By default, it is 1000.
+	MaxRecords int
+}
+
+// BacktraceHandler is a handler that holds back low level records logged with a context created by WithBacktrace, and
+// only passes them on to the wrapped handler if an error is logged with the same context. This gives all the details
+// of failing requests while keeping the volume of logs of successful ones low.
+//
+// Records below the pass level are buffered, and records at or above it are passed on straight away. Records at or
+// above the flush level first flush the records buffered in their context, in the order they were logged. The
+// buffered records are passed on without checking if the wrapped handler is enabled for their level, so that they
+// aren't lost to its level filter. Records logged with contexts that have no buffer are passed on to the wrapped
+// handler as they are.
+//
+// Every handler keeps its own records in the buffer of a context, so that BacktraceHandlers wrapping different
+// children of a CombinedHandler only flush their own records.
+type BacktraceHandler struct {
+	opts    *BacktraceHandlerOpts
+	handler slog.Handler
+}
+
+// Enabled reports whether the record at the given level would be buffered or handled by the wrapped handler.
+func (h *BacktraceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if backtraceFromContext(ctx) != nil && level >= h.opts.Level.Level() && level < h.opts.PassLevel.Level() {
+		return true
+	}
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle buffers the record, or passes it on to the wrapped handler after flushing the buffered records if it is at
+// the flush level.
+func (h *BacktraceHandler) Handle(ctx context.Context, record slog.Record) error {
+	buf := backtraceFromContext(ctx)
+	if buf == nil {
+		return h.handler.Handle(ctx, record)
+	}
+
+	// Buffer low level records
+	if record.Level < h.opts.PassLevel.Level() {
+		if record.Level >= h.opts.Level.Level() {
+			buf.add(backtraceEntry{owner: h.opts, handler: h.handler, record: record.Clone()}, h.opts.MaxRecords)
+		}
+		return nil
+	}
+
+	// Flush the buffered records before passing on the record
+	if record.Level >= h.opts.FlushLevel.Level() {
+		for _, entry := range buf.take(h.opts) {
+			if err := entry.handler.Handle(ctx, entry.record); err != nil {
+				return err
+			}
+		}
+	}
+
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a new BacktraceHandler that wraps the wrapped handler with the given attributes.
+func (h *BacktraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &BacktraceHandler{opts: h.opts, handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new BacktraceHandler that wraps the wrapped handler with the given group.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *BacktraceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &BacktraceHandler{opts: h.opts, handler: h.handler.WithGroup(name)}
+}
+
+// add buffers a record, dropping the oldest record of the same owner if it already has maxRecords records buffered.
+func (b *backtraceBuffer) add(entry backtraceEntry, maxRecords int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.owners == nil {
+		b.owners = make(map[*BacktraceHandlerOpts]*backtraceRing)
+	}
+	ring := b.owners[entry.owner]
+	if ring == nil {
+		ring = &backtraceRing{}
+		b.owners[entry.owner] = ring
+	}
+
+	// Grow the ring until it is full, and then overwrite its oldest record
+	if len(ring.entries) < maxRecords {
+		ring.entries = append(ring.entries, entry)
+		return
+	}
+	ring.entries[ring.head] = entry
+	ring.head = (ring.head + 1) % len(ring.entries)
+}
+
+// take removes the records of an owner from the buffer and returns them, from the oldest to the newest.
+func (b *backtraceBuffer) take(owner *BacktraceHandlerOpts) []backtraceEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ring := b.owners[owner]
+	if ring == nil {
+		return nil
+	}
+	delete(b.owners, owner)
+
+	taken := make([]backtraceEntry, 0, len(ring.entries))
+	taken = append(taken, ring.entries[ring.head:]...)
+	return append(taken, ring.entries[:ring.head]...)
+}
+
+// NewBacktraceHandler returns a BacktraceHandler that buffers low level records logged with contexts created by
+// WithBacktrace, and only passes them on to the given handler when an error is logged with the same context.
+func NewBacktraceHandler(handler slog.Handler, options ...BacktraceHandlerOpts) *BacktraceHandler {
+	// If options are provided, assign the first option to opts
+	var opts BacktraceHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Level == nil {
+		opts.Level = slog.LevelDebug
+	}
+	if opts.PassLevel == nil {
+		opts.PassLevel = slog.LevelWarn
+	}
+	if opts.FlushLevel == nil {
+		opts.FlushLevel = slog.LevelError
+	}
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = 1000
+	}
+
+	return &BacktraceHandler{opts: &opts, handler: handler}
+}
@@ -0,0 +1,188 @@
+package loggy_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewBacktraceHandler tests the BacktraceHandler returned by NewBacktraceHandler, which should only write the
+// debug and info records of a context if an error is logged with it.
+func TestNewBacktraceHandler(t *testing.T) {
+	// Create a logger that writes warnings and errors, and buffers everything else
+	var outputStream strings.Builder
+	handler := loggy.NewBacktraceHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log a successful request, which should only write the warning
+	ctx := loggy.WithBacktrace(context.Background())
+	logger.DebugContext(ctx, "loading user", "id", 1)
+	logger.InfoContext(ctx, "user loaded", "id", 1)
+	logger.WarnContext(ctx, "slow query")
+	assert.Equal(t, "level=WARN msg=\"slow query\" service=api\n", outputStream.String())
+	outputStream.Reset()
+
+	// Log a failing request, which should write the buffered records before the error
+	ctx = loggy.WithBacktrace(context.Background())
+	logger.DebugContext(ctx, "loading user", "id", 2)
+	logger.WithGroup("db").InfoContext(ctx, "query", "rows", 0)
+	logger.ErrorContext(ctx, "user not found", "id", 2)
+	logger.InfoContext(ctx, "after the error")
+	logger.ErrorContext(ctx, "another error")
+	expectedOutput := "level=DEBUG msg=\"loading user\" service=api id=2\n" +
+		"level=INFO msg=query service=api db.rows=0\n" +
+		"level=ERROR msg=\"user not found\" service=api id=2\n" +
+		"level=INFO msg=\"after the error\" service=api\n" +
+		"level=ERROR msg=\"another error\" service=api\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+	outputStream.Reset()
+
+	// Log without a buffer in the context, which should pass records on to the wrapped handler as they are
+	logger.Debug("not buffered")
+	logger.Info("written")
+	assert.Equal(t, "level=INFO msg=written service=api\n", outputStream.String())
+}
+
+// TestNewBacktraceHandler_Opts tests the BacktraceHandler returned by NewBacktraceHandler with custom levels and a
+// limit on the number of buffered records.
+func TestNewBacktraceHandler_Opts(t *testing.T) {
+	// Create a logger that passes on info records, buffers debug records, and flushes them on warnings
+	var outputStream strings.Builder
+	handler := loggy.NewBacktraceHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.BacktraceHandlerOpts{PassLevel: slog.LevelInfo, FlushLevel: slog.LevelWarn, MaxRecords: 2},
+	)
+	logger := slog.New(handler)
+
+	// Log more debug records than can be buffered, and then a warning
+	ctx := loggy.WithBacktrace(context.Background())
+	for i := 0; i < 3; i++ {
+		logger.DebugContext(ctx, "debug", "i", i)
+	}
+	logger.InfoContext(ctx, "info")
+	logger.WarnContext(ctx, "warning")
+
+	// Check that the oldest debug record was dropped
+	expectedOutput := "level=INFO msg=info\n" +
+		"level=DEBUG msg=debug i=1\n" +
+		"level=DEBUG msg=debug i=2\n" +
+		"level=WARN msg=warning\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+}
+
+// TestNewBacktraceHandler_Combined tests BacktraceHandlers wrapping different children of a CombinedHandler, which
+// should only flush their own records.
+func TestNewBacktraceHandler_Combined(t *testing.T) {
+	// Flush the records of one child on errors, and of the other on fatal records
+	var errorStream, fatalStream strings.Builder
+	logger := slog.New(
+		loggy.NewCombinedHandler(
+			loggy.NewBacktraceHandler(
+				slog.NewTextHandler(&errorStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+			),
+			loggy.NewBacktraceHandler(
+				slog.NewTextHandler(&fatalStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+				loggy.BacktraceHandlerOpts{PassLevel: loggy.LevelFatal, FlushLevel: loggy.LevelFatal},
+			),
+		),
+	)
+
+	// Log an info record and an error
+	ctx := loggy.WithBacktrace(context.Background())
+	logger.InfoContext(ctx, "info")
+	logger.ErrorContext(ctx, "error")
+	assert.Equal(t, "level=INFO msg=info\nlevel=ERROR msg=error\n", errorStream.String())
+	assert.Equal(t, "", fatalStream.String())
+
+	// Log a fatal record, which should flush the records of the other child
+	logger.Log(ctx, loggy.LevelFatal, "fatal")
+	assert.Equal(t, "level=INFO msg=info\nlevel=ERROR msg=error\nlevel=ERROR+4 msg=fatal\n", errorStream.String())
+	assert.Equal(t, "level=INFO msg=info\nlevel=ERROR msg=error\nlevel=ERROR+4 msg=fatal\n", fatalStream.String())
+}
+
+// TestNewBacktraceHandler_HTTP tests the BacktraceHandler returned by NewBacktraceHandler with the HTTP middleware,
+// which should create a buffer for every request.
+func TestNewBacktraceHandler_HTTP(t *testing.T) {
+	// Create a middleware that writes the debug records of failing requests
+	var outputStream strings.Builder
+	handler := loggy.NewBacktraceHandler(
+		slog.NewJSONHandler(&outputStream, nil), loggy.BacktraceHandlerOpts{PassLevel: slog.LevelInfo},
+	)
+	middleware := loggy.NewHTTPMiddleware(handler)
+	server := middleware(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				logger := loggy.LoggerFromContext(r.Context())
+				logger.DebugContext(r.Context(), "handling", "path", r.URL.Path)
+				if r.URL.Path == "/fail" {
+					logger.ErrorContext(r.Context(), "request failed")
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		),
+	)
+
+	// Serve a successful request and a failing one
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	// Check that the debug record was only written for the failing request, when the error was logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 4) {
+		return
+	}
+	assert.Equal(t, "INFO", logs[0]["level"])
+	assert.Equal(t, "DEBUG", logs[1]["level"])
+	assert.Equal(t, "/fail", logs[1]["path"])
+	assert.Equal(t, "request failed", logs[2]["msg"])
+	assert.Equal(t, "http request", logs[3]["msg"])
+	assert.Equal(t, "ERROR", logs[3]["level"])
+}
+
+// TestNewBacktraceHandler_HTTPAccessRecord tests the BacktraceHandler returned by NewBacktraceHandler with the HTTP
+// middleware and the default levels, which should still write the access records of successful requests while
+// holding back their info records.
+func TestNewBacktraceHandler_HTTPAccessRecord(t *testing.T) {
+	// Create a middleware that buffers the debug and info records of every request
+	var outputStream strings.Builder
+	middleware := loggy.NewHTTPMiddleware(loggy.NewBacktraceHandler(slog.NewJSONHandler(&outputStream, nil)))
+	server := middleware(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				loggy.LoggerFromContext(r.Context()).InfoContext(r.Context(), "handling")
+			},
+		),
+	)
+
+	// Serve a successful request
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+	// Check that only the access record was written
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "http request", logs[0]["msg"])
+		assert.Equal(t, float64(200), logs[0]["http"].(map[string]any)["status"])
+	}
+}
+
+// BenchmarkBacktraceHandler benchmarks buffering records with a BacktraceHandler whose buffer is full, which drops
+// the oldest record for every new one.
+func BenchmarkBacktraceHandler(b *testing.B) {
+	logger := slog.New(loggy.NewBacktraceHandler(slog.NewJSONHandler(io.Discard, nil)))
+	ctx := loggy.WithBacktrace(context.Background())
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.DebugContext(ctx, "debug", "i", i)
+	}
+}
@@ -0,0 +1,369 @@
+package loggy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// BinaryFormat is the format that the BinaryHandler encodes records in.
+type BinaryFormat int
+
+const (
+	// BinaryFormatMsgpack encodes records as MessagePack maps, with times as MessagePack timestamps. This is the
+	// default.
+	BinaryFormatMsgpack BinaryFormat = iota
+	// BinaryFormatCBOR encodes records as CBOR maps, with times as tagged RFC 3339 strings.
+	BinaryFormatCBOR
+)
+
+// binaryMaxFrameSize is the size of the largest frame that a BinaryDecoder reads, so that a corrupt length can't
+// exhaust memory.
+const binaryMaxFrameSize = 64 << 20
+
+// binaryMaxPrealloc is the largest number of elements that space is allocated for up front when decoding arrays and
+// maps, so that corrupt lengths can't exhaust memory before the decoder runs out of data.
+const binaryMaxPrealloc = 1024
+
+// binaryMaxDepth is the deepest that maps and arrays can be nested in a decoded record, so that corrupt input can't
+// exhaust the stack.
+const binaryMaxDepth = 64
+
+// binaryBufferPool holds the buffers that frames are encoded in, to avoid allocating one for every record.
+var binaryBufferPool = sync.Pool{New: func() any { b := make([]byte, 0, 1024); return &b }}
+
+// binaryReader is the reader that binary records are decoded from. It must support unreading a byte, so that the
+// decoders can peek at the type of a value.
+type binaryReader interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// binaryEncoding contains the functions used to encode and decode records in a BinaryFormat.
+type binaryEncoding struct {
+	appendMapHeader func(b []byte, n int) []byte
+	appendString    func(b []byte, v string) []byte
+	appendInt       func(b []byte, v int64) []byte
+	appendTime      func(b []byte, t time.Time) []byte
+	appendAttrs     func(b []byte, attrs []slog.Attr) []byte
+	decodeAttrs     func(r binaryReader) ([]slog.Attr, error)
+}
+
+// binaryEncodings maps every BinaryFormat to its encoding.
+var binaryEncodings = map[BinaryFormat]binaryEncoding{
+	BinaryFormatMsgpack: {
+		appendMapHeader: appendMsgpackMapHeader,
+		appendString:    appendMsgpackString,
+		appendInt:       appendMsgpackInt,
+		appendTime:      appendMsgpackTime,
+		appendAttrs: func(b []byte, attrs []slog.Attr) []byte {
+			return appendMsgpackAttrs(b, attrs, appendMsgpackTime)
+		},
+		decodeAttrs: decodeMsgpackAttrs,
+	},
+	BinaryFormatCBOR: {
+		appendMapHeader: func(b []byte, n int) []byte { return appendCBORHead(b, cborMap, uint64(n)) },
+		appendString:    appendCBORString,
+		appendInt:       appendCBORInt,
+		appendTime:      appendCBORTime,
+		appendAttrs:     appendCBORAttrs,
+		decodeAttrs:     decodeCBORAttrs,
+	},
+}
+
+// BinaryHandlerOpts represents the options for configuring the behaviour of the `BinaryHandler`.
+type BinaryHandlerOpts struct {
+	// Format is the format that records are encoded in. By default, it is BinaryFormatMsgpack.
+	Format BinaryFormat
+
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the time and source of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// BinaryHandler is a handler that writes records as MessagePack or CBOR maps, for high volume pipelines where the
+// size of records and the cost of encoding them matter more than being able to read them. Records can be turned back
+// into slog.Records with a BinaryDecoder.
+//
+// Every record is written as a frame, made of the size of the encoded record as a 4 byte big-endian integer followed
+// by the encoded record, so that records can be read back one by one from files and streams. The record is a map with
+// the following keys:
+//
+//   - "time": the time of the record, as a native time of the format, unless it has been removed.
+//   - "level": the level of the record, as an integer.
+//   - "msg": the message of the record.
+//   - "source": the function, file and line of the source location, if AddSource is set.
+//   - "attrs": the attributes of the record, with groups as nested maps, unless there are none.
+//
+// Byte slices are encoded as binary data, times as native times and durations as integer nanoseconds. Values of any
+// other type are encoded as strings.
+type BinaryHandler struct {
+	opts BinaryHandlerOpts
+	mu   *sync.Mutex
+	w    io.Writer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the BinaryHandler handles records at the given level.
+func (h *BinaryHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record and writes it as a single frame.
+func (h *BinaryHandler) Handle(_ context.Context, record slog.Record) error {
+	// Encode the record after the space for its size
+	bufPtr := binaryBufferPool.Get().(*[]byte)
+	defer func() {
+		// Don't keep large buffers around
+		if cap(*bufPtr) <= 64<<10 {
+			binaryBufferPool.Put(bufPtr)
+		}
+	}()
+	b := h.appendRecord(append((*bufPtr)[:0], 0, 0, 0, 0), record)
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	*bufPtr = b
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b)
+	return err
+}
+
+// WithAttrs returns a new BinaryHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *BinaryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &BinaryHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new BinaryHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *BinaryHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &BinaryHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// appendRecord appends the map that a record is encoded as to b.
+func (h *BinaryHandler) appendRecord(b []byte, record slog.Record) []byte {
+	enc := binaryEncodings[h.opts.Format]
+	replace := h.opts.HandlerOptions.ReplaceAttr
+
+	// Find the time and source location, unless they have been removed
+	var t time.Time
+	if !record.Time.IsZero() {
+		t, _ = replaceBuiltinTime(replace, record.Time)
+	}
+	var source *slog.Source
+	if h.opts.HandlerOptions.AddSource {
+		if recordSource := recordSource(record); recordSource != nil {
+			source, _ = replaceBuiltin(replace, slog.Any(slog.SourceKey, recordSource)).Value.Any().(*slog.Source)
+		}
+	}
+	attrs := collectAttrs(h.goas, record, replace)
+
+	// Count the keys of the map
+	n := 2
+	if !t.IsZero() {
+		n++
+	}
+	if source != nil {
+		n++
+	}
+	if len(attrs) > 0 {
+		n++
+	}
+	b = enc.appendMapHeader(b, n)
+
+	// Add the built-in fields
+	if !t.IsZero() {
+		b = enc.appendTime(enc.appendString(b, slog.TimeKey), t)
+	}
+	b = enc.appendInt(enc.appendString(b, slog.LevelKey), int64(record.Level))
+	b = enc.appendString(enc.appendString(b, slog.MessageKey), record.Message)
+	if source != nil {
+		b = enc.appendAttrs(
+			enc.appendString(b, slog.SourceKey),
+			[]slog.Attr{
+				slog.String("function", source.Function),
+				slog.String("file", source.File),
+				slog.Int("line", source.Line),
+			},
+		)
+	}
+
+	// Add the attributes
+	if len(attrs) > 0 {
+		b = enc.appendAttrs(enc.appendString(b, "attrs"), attrs)
+	}
+
+	return b
+}
+
+// NewBinaryHandler returns a BinaryHandler that writes records to w as frames of MessagePack or CBOR.
+func NewBinaryHandler(w io.Writer, options ...BinaryHandlerOpts) *BinaryHandler {
+	// If options are provided, assign the first option to opts
+	var opts BinaryHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if _, ok := binaryEncodings[opts.Format]; !ok {
+		opts.Format = BinaryFormatMsgpack
+	}
+
+	return &BinaryHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
+
+// BinaryDecoder reads the frames written by a BinaryHandler and decodes them back into records.
+//
+// The time, level and message of the decoded records are the ones that were logged, and the attributes are in the
+// order they were logged in, with groups as group attributes. Since the program counter of a record can't be
+// restored, the source location is added as the first attribute of the record, under slog.SourceKey, as a
+// *slog.Source. Values are decoded into the closest slog.Value: binary data is decoded into a []byte, durations into
+// integers and arrays into a []any.
+type BinaryDecoder struct {
+	r     io.Reader
+	enc   binaryEncoding
+	frame []byte
+}
+
+// Decode reads the next frame and decodes it into a record. It returns io.EOF once there are no frames left, and
+// io.ErrUnexpectedEOF if the last frame is incomplete.
+func (d *BinaryDecoder) Decode() (slog.Record, error) {
+	// Read the size of the frame
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return slog.Record{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > binaryMaxFrameSize {
+		return slog.Record{}, fmt.Errorf("loggy: binary frame of %d bytes is too large", size)
+	}
+
+	// Read the frame
+	if cap(d.frame) < int(size) {
+		d.frame = make([]byte, size)
+	}
+	d.frame = d.frame[:size]
+	if _, err := io.ReadFull(d.r, d.frame); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return slog.Record{}, err
+	}
+
+	// Decode the map of the record
+	r := bytes.NewReader(d.frame)
+	fields, err := d.enc.decodeAttrs(r)
+	if err != nil {
+		return slog.Record{}, fmt.Errorf("loggy: invalid binary record: %w", err)
+	}
+	if r.Len() > 0 {
+		return slog.Record{}, fmt.Errorf("loggy: invalid binary record: %d bytes after the end of the record", r.Len())
+	}
+
+	return binaryRecord(fields), nil
+}
+
+// binaryRecord creates a record from the fields of the map it was encoded as.
+func binaryRecord(fields []slog.Attr) slog.Record {
+	var t time.Time
+	var level slog.Level
+	var msg string
+	var source *slog.Source
+	var attrs []slog.Attr
+
+	for _, field := range fields {
+		switch {
+		case field.Key == slog.TimeKey && field.Value.Kind() == slog.KindTime:
+			t = field.Value.Time()
+		case field.Key == slog.LevelKey && field.Value.Kind() == slog.KindInt64:
+			level = slog.Level(field.Value.Int64())
+		case field.Key == slog.MessageKey && field.Value.Kind() == slog.KindString:
+			msg = field.Value.String()
+		case field.Key == slog.SourceKey && field.Value.Kind() == slog.KindGroup:
+			source = &slog.Source{}
+			for _, attr := range field.Value.Group() {
+				switch attr.Key {
+				case "function":
+					source.Function = attr.Value.String()
+				case "file":
+					source.File = attr.Value.String()
+				case "line":
+					source.Line = int(attr.Value.Int64())
+				}
+			}
+		case field.Key == "attrs" && field.Value.Kind() == slog.KindGroup:
+			attrs = field.Value.Group()
+		}
+	}
+
+	record := slog.NewRecord(t, level, msg, 0)
+	if source != nil {
+		record.AddAttrs(slog.Any(slog.SourceKey, source))
+	}
+	record.AddAttrs(attrs...)
+	return record
+}
+
+// checkBinaryLength returns an error if a string, binary value, array or map claims to hold more bytes or elements
+// than there are bytes left in r, when r knows how many there are, like the reader of a frame. Every element takes at
+// least one byte, so a longer length can only be corrupt, and must be rejected before anything is allocated for it.
+func checkBinaryLength(r io.Reader, n uint64) error {
+	if remaining, ok := r.(interface{ Len() int }); ok && n > uint64(remaining.Len()) {
+		return fmt.Errorf("loggy: length of %d is longer than the %d bytes left", n, remaining.Len())
+	}
+	return nil
+}
+
+// checkBinaryDepth returns an error if a map or array is nested deeper than binaryMaxDepth.
+func checkBinaryDepth(depth int) error {
+	if depth > binaryMaxDepth {
+		return fmt.Errorf("loggy: values are nested more than %d levels deep", binaryMaxDepth)
+	}
+	return nil
+}
+
+// binaryValue converts a decoded MessagePack or CBOR value into a slog.Value.
+func binaryValue(v any) slog.Value {
+	switch v := v.(type) {
+	case string:
+		return slog.StringValue(v)
+	case int64:
+		return slog.Int64Value(v)
+	case uint64:
+		return slog.Uint64Value(v)
+	case float64:
+		return slog.Float64Value(v)
+	case bool:
+		return slog.BoolValue(v)
+	case time.Time:
+		return slog.TimeValue(v)
+	default:
+		return slog.AnyValue(v)
+	}
+}
+
+// NewBinaryDecoder returns a BinaryDecoder that reads frames in the given format from r.
+func NewBinaryDecoder(r io.Reader, format BinaryFormat) *BinaryDecoder {
+	enc, ok := binaryEncodings[format]
+	if !ok {
+		enc = binaryEncodings[BinaryFormatMsgpack]
+	}
+	return &BinaryDecoder{r: r, enc: enc}
+}
@@ -0,0 +1,391 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ksdfg/loggy"
+)
+
+// binaryFormats are the formats that the BinaryHandler is tested with.
+var binaryFormats = map[string]loggy.BinaryFormat{
+	"msgpack": loggy.BinaryFormatMsgpack,
+	"cbor":    loggy.BinaryFormatCBOR,
+}
+
+// TestNewBinaryHandler tests the BinaryHandler returned by NewBinaryHandler in every format, with records that should
+// be decoded back into the same time, level, message and attributes by a BinaryDecoder.
+func TestNewBinaryHandler(t *testing.T) {
+	for name, format := range binaryFormats {
+		t.Run(
+			name, func(t *testing.T) {
+				// Create a handler that writes frames to a buffer
+				var outputStream bytes.Buffer
+				handler := loggy.NewBinaryHandler(&outputStream, loggy.BinaryHandlerOpts{Format: format}).
+					WithAttrs([]slog.Attr{slog.String("service", "api")}).
+					WithGroup("request")
+
+				// Handle a record with all sorts of values, and one without any attributes
+				now := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+				record := slog.NewRecord(now, slog.LevelWarn, "this is a test log", 0)
+				record.AddAttrs(
+					slog.String("path", "/users/42"),
+					slog.Int("status", -404),
+					slog.Uint64("bytes", 1<<63),
+					slog.Float64("ratio", 0.5),
+					slog.Bool("cached", true),
+					slog.Duration("duration", time.Second),
+					slog.Any("body", []byte{0x00, 0xff}),
+					slog.Any("missing", nil),
+					slog.Any("err", errors.New("boom")),
+					slog.Any("url", (*url.URL)(nil)),
+					slog.Any("cause", (*pointerError)(nil)),
+					slog.Group("user", "id", 42, "admin", false),
+				)
+				assert.NoError(t, handler.Handle(context.Background(), record))
+				assert.NoError(t, handler.Handle(context.Background(), slog.NewRecord(now, loggy.LevelFatal, "", 0)))
+
+				// Decode the first record
+				decoder := loggy.NewBinaryDecoder(&outputStream, format)
+				decoded, err := decoder.Decode()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.True(t, now.Equal(decoded.Time))
+				assert.Equal(t, slog.LevelWarn, decoded.Level)
+				assert.Equal(t, "this is a test log", decoded.Message)
+
+				var attrs []slog.Attr
+				decoded.Attrs(
+					func(attr slog.Attr) bool {
+						attrs = append(attrs, attr)
+						return true
+					},
+				)
+				assert.Equal(
+					t,
+					[]string{
+						"service=api",
+						"request=[path=/users/42 status=-404 bytes=9223372036854775808 ratio=0.5 cached=true " +
+							"duration=1000000000 body=[0 255] missing=<nil> err=boom url=<nil> cause=<nil> " +
+							"user=[id=42 admin=false]]",
+					},
+					attrStrings(attrs),
+				)
+
+				// Decode the second record
+				decoded, err = decoder.Decode()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, loggy.LevelFatal, decoded.Level)
+				assert.Equal(t, 1, decoded.NumAttrs())
+
+				// Check that there are no records left
+				_, err = decoder.Decode()
+				assert.Equal(t, io.EOF, err)
+			},
+		)
+	}
+}
+
+// TestNewBinaryHandler_Source tests the BinaryHandler returned by NewBinaryHandler with AddSource, where the source
+// location should be decoded as the first attribute, and without the time.
+func TestNewBinaryHandler_Source(t *testing.T) {
+	for name, format := range binaryFormats {
+		t.Run(
+			name, func(t *testing.T) {
+				// Log a record with its source location and without the time
+				var outputStream bytes.Buffer
+				handler := loggy.NewBinaryHandler(
+					&outputStream,
+					loggy.BinaryHandlerOpts{
+						Format:         format,
+						HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: removeTime},
+					},
+				)
+				slog.New(handler).Info("this is a test log", "key", "value")
+
+				// Decode the record
+				decoded, err := loggy.NewBinaryDecoder(&outputStream, format).Decode()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.True(t, decoded.Time.IsZero())
+
+				var attrs []slog.Attr
+				decoded.Attrs(
+					func(attr slog.Attr) bool {
+						attrs = append(attrs, attr)
+						return true
+					},
+				)
+				if !assert.Len(t, attrs, 2) {
+					return
+				}
+				source := attrs[0].Value.Any().(*slog.Source)
+				assert.Equal(t, "github.com/ksdfg/loggy_test.TestNewBinaryHandler_Source.func1", source.Function)
+				assert.True(t, strings.HasSuffix(source.File, "binary_test.go"))
+				assert.NotZero(t, source.Line)
+				assert.Equal(t, "key=value", attrs[1].String())
+			},
+		)
+	}
+}
+
+// TestNewBinaryHandler_Msgpack tests that the frames written by the BinaryHandler in the MessagePack format can be
+// decoded by other MessagePack libraries, with native times and binary data.
+func TestNewBinaryHandler_Msgpack(t *testing.T) {
+	// Log a record with binary data
+	var outputStream bytes.Buffer
+	slog.New(loggy.NewBinaryHandler(&outputStream)).Info("this is a test log", "body", []byte("hi"))
+
+	// Check the size of the frame
+	frame := outputStream.Bytes()
+	if !assert.Greater(t, len(frame), 4) {
+		return
+	}
+	assert.Equal(t, len(frame)-4, int(binary.BigEndian.Uint32(frame)))
+
+	// Decode the frame
+	var entry map[string]any
+	if !assert.NoError(t, msgpack.Unmarshal(frame[4:], &entry)) {
+		return
+	}
+	assert.IsType(t, time.Time{}, entry["time"])
+	assert.EqualValues(t, 0, entry["level"])
+	assert.Equal(t, "this is a test log", entry["msg"])
+	assert.Equal(t, map[string]any{"body": []byte("hi")}, entry["attrs"])
+}
+
+// TestNewBinaryHandler_Files tests the BinaryHandler returned by NewBinaryHandler with files as sinks, combined with
+// each other using a CombinedHandler.
+func TestNewBinaryHandler_Files(t *testing.T) {
+	// Create a file for every format
+	dir := t.TempDir()
+	files := make(map[string]*os.File, len(binaryFormats))
+	var handlers []slog.Handler
+	for name, format := range binaryFormats {
+		file, err := os.Create(filepath.Join(dir, name+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = file
+		handlers = append(handlers, loggy.NewBinaryHandler(file, loggy.BinaryHandlerOpts{Format: format}))
+	}
+
+	// Log a few records to all the files
+	logger := slog.New(loggy.NewCombinedHandler(handlers...))
+	for i := 0; i < 3; i++ {
+		logger.Info("this is a test log", "i", i)
+	}
+
+	for name, format := range binaryFormats {
+		// Read the file back from the start
+		file := files[name]
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		// Check that all the records were written to the file
+		decoder := loggy.NewBinaryDecoder(file, format)
+		for i := 0; i < 3; i++ {
+			decoded, err := decoder.Decode()
+			if !assert.NoError(t, err, name) {
+				break
+			}
+			decoded.Attrs(
+				func(attr slog.Attr) bool {
+					assert.Equal(t, slog.Int("i", i).String(), attr.String(), name)
+					return true
+				},
+			)
+		}
+		_, err := decoder.Decode()
+		assert.Equal(t, io.EOF, err, name)
+		assert.NoError(t, file.Close())
+	}
+}
+
+// TestBinaryDecoder_Invalid tests the BinaryDecoder with frames that are incomplete or do not contain a valid record.
+func TestBinaryDecoder_Invalid(t *testing.T) {
+	// Log a record to take frames apart
+	var outputStream bytes.Buffer
+	slog.New(loggy.NewBinaryHandler(&outputStream)).Info("this is a test log")
+	frame := outputStream.Bytes()
+
+	// Incomplete frames
+	_, err := loggy.NewBinaryDecoder(bytes.NewReader(frame[:2]), loggy.BinaryFormatMsgpack).Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = loggy.NewBinaryDecoder(bytes.NewReader(frame[:len(frame)-1]), loggy.BinaryFormatMsgpack).Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Frames that are not maps, or have data after the map
+	for _, invalid := range [][]byte{
+		{0, 0, 0, 1, 0x01},
+		{0, 0, 0, 2, 0x80, 0x01},
+		{0xff, 0xff, 0xff, 0xff},
+	} {
+		_, err = loggy.NewBinaryDecoder(bytes.NewReader(invalid), loggy.BinaryFormatMsgpack).Decode()
+		assert.Error(t, err, invalid)
+	}
+
+	// A MessagePack frame is not a valid CBOR frame
+	_, err = loggy.NewBinaryDecoder(bytes.NewReader(frame), loggy.BinaryFormatCBOR).Decode()
+	assert.Error(t, err)
+}
+
+// binaryFrame prefixes the encoded record with its size, as a BinaryHandler frames it.
+func binaryFrame(record ...[]byte) []byte {
+	payload := bytes.Join(record, nil)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(payload))), payload...)
+}
+
+// TestBinaryDecoder_Corrupt tests the BinaryDecoder with frames that claim to hold much longer values than they do,
+// or that are nested too deep, which should be rejected without allocating memory for the claimed lengths.
+func TestBinaryDecoder_Corrupt(t *testing.T) {
+	key := []byte{0xa1, 0x61} // A map with one pair, and the key "a" in both formats
+	for name, tt := range map[string]struct {
+		format loggy.BinaryFormat
+		frame  []byte
+	}{
+		"msgpack array": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, []byte{0xdd, 0xff, 0xff, 0xff, 0xff}),
+		},
+		"msgpack array 16": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, []byte{0xdc, 0xff, 0xff}),
+		},
+		"msgpack map": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, []byte{0x91, 0xdf, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"msgpack group": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0xdf, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"msgpack string": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, []byte{0xdb, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"msgpack bytes": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, []byte{0xc6, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"msgpack nested arrays": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame([]byte{0x81}, key, bytes.Repeat([]byte{0x91}, 1000), []byte{0x01}),
+		},
+		"msgpack nested groups": {
+			format: loggy.BinaryFormatMsgpack,
+			frame:  binaryFrame(bytes.Repeat([]byte{0x81, 0xa1, 0x61}, 1000), []byte{0x01}),
+		},
+		"cbor array": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61, 0x9a, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"cbor map": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61, 0xba, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"cbor string": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61, 0x7a, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"cbor bytes": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61, 0x5a, 0x7f, 0xff, 0xff, 0xff}),
+		},
+		"cbor nested arrays": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61}, bytes.Repeat([]byte{0x81}, 1000), []byte{0x01}),
+		},
+		"cbor nested tags": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(key, []byte{0x61}, bytes.Repeat([]byte{0xc6}, 1000), []byte{0x01}),
+		},
+		"cbor nested groups": {
+			format: loggy.BinaryFormatCBOR,
+			frame:  binaryFrame(bytes.Repeat([]byte{0xa1, 0x61, 0x61}, 1000), []byte{0x01}),
+		},
+	} {
+		t.Run(
+			name, func(t *testing.T) {
+				// Decode the frame, measuring the memory allocated while doing so
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				_, err := loggy.NewBinaryDecoder(bytes.NewReader(tt.frame), tt.format).Decode()
+				runtime.ReadMemStats(&after)
+
+				// Check that the frame was rejected, without allocating memory for the claimed lengths
+				assert.Error(t, err)
+				assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+			},
+		)
+	}
+}
+
+// countingWriter is a writer that discards everything written to it, counting the bytes.
+type countingWriter struct {
+	n int
+}
+
+// Write counts the bytes of p.
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// benchmarkHandler logs a typical record with a handler that writes to w, reporting the bytes written per record.
+func benchmarkHandler(b *testing.B, w *countingWriter, handler slog.Handler) {
+	logger := slog.New(handler).With("service", "api")
+	body := []byte("0123456789abcdef")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info(
+			"request handled",
+			"method", "GET",
+			"path", "/users/42",
+			"status", 200,
+			"duration", 1500*time.Microsecond,
+			"body", body,
+			slog.Group("user", "id", 42, "admin", false),
+		)
+	}
+	b.ReportMetric(float64(w.n)/float64(b.N), "bytes/record")
+}
+
+// BenchmarkBinaryHandler_Msgpack benchmarks the BinaryHandler in the MessagePack format.
+func BenchmarkBinaryHandler_Msgpack(b *testing.B) {
+	var w countingWriter
+	benchmarkHandler(b, &w, loggy.NewBinaryHandler(&w))
+}
+
+// BenchmarkBinaryHandler_CBOR benchmarks the BinaryHandler in the CBOR format.
+func BenchmarkBinaryHandler_CBOR(b *testing.B) {
+	var w countingWriter
+	benchmarkHandler(b, &w, loggy.NewBinaryHandler(&w, loggy.BinaryHandlerOpts{Format: loggy.BinaryFormatCBOR}))
+}
+
+// BenchmarkJSONHandler benchmarks the slog.JSONHandler, for comparison with the BinaryHandler.
+func BenchmarkJSONHandler(b *testing.B) {
+	var w countingWriter
+	benchmarkHandler(b, &w, slog.NewJSONHandler(&w, nil))
+}
@@ -0,0 +1,371 @@
+package loggy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// The major types of CBOR data items.
+const (
+	cborUint   byte = 0
+	cborNegInt byte = 1
+	cborBytes  byte = 2
+	cborString byte = 3
+	cborArray  byte = 4
+	cborMap    byte = 5
+	cborTag    byte = 6
+	cborSimple byte = 7
+)
+
+// The tags that CBOR defines for times.
+const (
+	cborTagRFC3339 = 0
+	cborTagEpoch   = 1
+)
+
+// appendCBORHead appends the head of a CBOR data item, made of its major type and argument, to b.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+// appendCBORInt appends a signed integer to b.
+func appendCBORInt(b []byte, v int64) []byte {
+	if v >= 0 {
+		return appendCBORHead(b, cborUint, uint64(v))
+	}
+	return appendCBORHead(b, cborNegInt, uint64(-1-v))
+}
+
+// appendCBORFloat appends a float to b as a double-precision float.
+func appendCBORFloat(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, cborSimple<<5|27), math.Float64bits(v))
+}
+
+// appendCBORString appends a text string to b.
+func appendCBORString(b []byte, v string) []byte {
+	return append(appendCBORHead(b, cborString, uint64(len(v))), v...)
+}
+
+// appendCBORBytes appends a byte string to b.
+func appendCBORBytes(b []byte, v []byte) []byte {
+	return append(appendCBORHead(b, cborBytes, uint64(len(v))), v...)
+}
+
+// appendCBORBool appends a boolean to b.
+func appendCBORBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+// appendCBORNil appends a CBOR null to b.
+func appendCBORNil(b []byte) []byte {
+	return append(b, 0xf6)
+}
+
+// appendCBORTime appends a time to b as an RFC 3339 string with the standard date/time tag, which keeps both the
+// nanoseconds and the offset of the time.
+func appendCBORTime(b []byte, t time.Time) []byte {
+	return appendCBORString(appendCBORHead(b, cborTag, cborTagRFC3339), t.Format(time.RFC3339Nano))
+}
+
+// appendCBORAttrs appends resolved attributes to b as a CBOR map, with groups as nested maps.
+func appendCBORAttrs(b []byte, attrs []slog.Attr) []byte {
+	b = appendCBORHead(b, cborMap, uint64(len(attrs)))
+	for _, attr := range attrs {
+		b = appendCBORString(b, attr.Key)
+		b = appendCBORValue(b, attr.Value)
+	}
+	return b
+}
+
+// appendCBORValue appends a resolved slog.Value to b.
+func appendCBORValue(b []byte, value slog.Value) []byte {
+	switch value.Kind() {
+	case slog.KindString:
+		return appendCBORString(b, value.String())
+	case slog.KindInt64:
+		return appendCBORInt(b, value.Int64())
+	case slog.KindUint64:
+		return appendCBORHead(b, cborUint, value.Uint64())
+	case slog.KindFloat64:
+		return appendCBORFloat(b, value.Float64())
+	case slog.KindBool:
+		return appendCBORBool(b, value.Bool())
+	case slog.KindDuration:
+		return appendCBORInt(b, int64(value.Duration()))
+	case slog.KindTime:
+		return appendCBORTime(b, value.Time())
+	case slog.KindGroup:
+		return appendCBORAttrs(b, value.Group())
+	}
+
+	// Values of any other kind are encoded as what they are closest to, with nil pointers to errors and fmt.Stringers
+	// encoded as "<nil>" since their methods usually can't be called on them
+	switch v := value.Any().(type) {
+	case nil:
+		return appendCBORNil(b)
+	case []byte:
+		return appendCBORBytes(b, v)
+	case error:
+		if isNilPointer(v) {
+			return appendCBORString(b, "<nil>")
+		}
+		return appendCBORString(b, v.Error())
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return appendCBORString(b, "<nil>")
+		}
+		return appendCBORString(b, v.String())
+	default:
+		return appendCBORString(b, fmt.Sprintf("%+v", v))
+	}
+}
+
+// decodeCBOR decodes a single CBOR data item from r.
+//
+// Maps are decoded into map[string]any, arrays into []any, integers into int64 or uint64 (if they don't fit in an
+// int64), floats into float64 and times into time.Time. Other tags are ignored, and their content is returned. Items
+// of indefinite length are not supported.
+func decodeCBOR(r binaryReader) (any, error) {
+	return decodeCBORValue(r, 0)
+}
+
+// decodeCBORValue decodes a single CBOR data item from r, nested in depth arrays, maps or tags.
+func decodeCBORValue(r binaryReader, depth int) (any, error) {
+	if err := checkBinaryDepth(depth); err != nil {
+		return nil, err
+	}
+
+	major, n, info, err := readCBORHead(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("loggy: CBOR negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborString:
+		if n > math.MaxInt32 {
+			return nil, fmt.Errorf("loggy: CBOR string of %d bytes is too long", n)
+		}
+		if err := checkBinaryLength(r, n); err != nil {
+			return nil, err
+		}
+	case cborArray, cborMap:
+		if err := checkBinaryLength(r, n); err != nil {
+			return nil, err
+		}
+	}
+
+	switch major {
+	case cborBytes:
+		return readMsgpackBytes(r, int(n))
+	case cborString:
+		data, err := readMsgpackBytes(r, int(n))
+		return string(data), err
+	case cborArray:
+		a := make([]any, 0, min(n, binaryMaxPrealloc))
+		for i := uint64(0); i < n; i++ {
+			value, err := decodeCBORValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+		return a, nil
+	case cborMap:
+		m := make(map[string]any, min(n, binaryMaxPrealloc))
+		for i := uint64(0); i < n; i++ {
+			key, err := decodeCBORValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeCBORValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, nil
+	case cborTag:
+		return decodeCBORTag(r, n, depth)
+	}
+
+	// Decode the simple values and floats
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	default:
+		return nil, fmt.Errorf("loggy: unsupported CBOR simple value %d", info)
+	}
+}
+
+// decodeCBORTag decodes the content of a tag nested in depth arrays, maps or tags, turning the date/time tags into
+// times.
+func decodeCBORTag(r binaryReader, tag uint64, depth int) (any, error) {
+	value, err := decodeCBORValue(r, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case cborTagRFC3339:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("loggy: invalid CBOR date/time string")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case cborTagEpoch:
+		switch v := value.(type) {
+		case int64:
+			return time.Unix(v, 0), nil
+		case float64:
+			sec, frac := math.Modf(v)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		default:
+			return nil, errors.New("loggy: invalid CBOR epoch date/time")
+		}
+	default:
+		return value, nil
+	}
+}
+
+// decodeCBORAttrs decodes a CBOR map into attributes, keeping the order of its keys, with nested maps as groups.
+func decodeCBORAttrs(r binaryReader) ([]slog.Attr, error) {
+	return decodeCBORGroup(r, 0)
+}
+
+// decodeCBORGroup decodes a CBOR map nested in depth maps into attributes, like decodeCBORAttrs.
+func decodeCBORGroup(r binaryReader, depth int) ([]slog.Attr, error) {
+	if err := checkBinaryDepth(depth); err != nil {
+		return nil, err
+	}
+
+	major, n, _, err := readCBORHead(r)
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, fmt.Errorf("loggy: expected a CBOR map, got major type %d", major)
+	}
+	if err := checkBinaryLength(r, n); err != nil {
+		return nil, err
+	}
+
+	attrs := make([]slog.Attr, 0, min(n, binaryMaxPrealloc))
+	for i := uint64(0); i < n; i++ {
+		key, err := decodeCBORValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Peek at the value to decode maps as groups
+		code, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.UnreadByte(); err != nil {
+			return nil, err
+		}
+
+		var value slog.Value
+		if code>>5 == cborMap {
+			groupAttrs, err := decodeCBORGroup(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value = slog.GroupValue(groupAttrs...)
+		} else {
+			v, err := decodeCBORValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value = binaryValue(v)
+		}
+		attrs = append(attrs, slog.Attr{Key: fmt.Sprint(key), Value: value})
+	}
+
+	return attrs, nil
+}
+
+// readCBORHead reads the head of a CBOR data item, returning its major type, its argument and the additional
+// information it was read from. For floats, the argument holds their bits.
+func readCBORHead(r binaryReader) (byte, uint64, byte, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info := code>>5, code&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), info, nil
+	case info <= 27:
+		data, err := readMsgpackBytes(r, 1<<(info-24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if major == cborSimple && info == 25 {
+			return major, math.Float64bits(float64(halfToFloat32(uint16(readMsgpackUint(data))))), 27, nil
+		}
+		return major, readMsgpackUint(data), info, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("loggy: unsupported CBOR additional information %d", info)
+	}
+}
+
+// halfToFloat32 converts the bits of a half-precision float into a float32.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		// Subnormal numbers and zeros
+		f := float32(frac) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		// Infinities and NaNs
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	default:
+		return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+	}
+}
@@ -0,0 +1,160 @@
+package loggy
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Clock tells the current time. Handlers use it instead of the time records were logged at when it is provided, e.g.
+// so that their output can be compared with golden files in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to allow the use of ordinary functions as clocks.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock returns a Clock that always tells the given time.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// TimeFormat is the format that the times of records are written in.
+type TimeFormat int
+
+const (
+	// TimeFormatDefault writes times the way the handler writes them by default.
+	TimeFormatDefault TimeFormat = iota
+	// TimeFormatRFC3339 writes times as RFC 3339 strings with seconds, e.g. "2006-01-02T15:04:05Z".
+	TimeFormatRFC3339
+	// TimeFormatRFC3339Nano writes times as RFC 3339 strings with nanoseconds, e.g. "2006-01-02T15:04:05.999999999Z".
+	TimeFormatRFC3339Nano
+	// TimeFormatUnix writes times as the number of seconds since the Unix epoch.
+	TimeFormatUnix
+	// TimeFormatUnixMilli writes times as the number of milliseconds since the Unix epoch.
+	TimeFormatUnixMilli
+	// TimeFormatKitchen writes times as the time of day, e.g. "3:04PM".
+	TimeFormatKitchen
+	// TimeFormatElapsed writes times as the duration since the handler was created, the way the handler writes
+	// durations, e.g. "1.5s" for slog.TextHandler.
+	TimeFormatElapsed
+	// TimeFormatLayout writes times with the layout in TimeOpts.Layout.
+	TimeFormatLayout
+)
+
+// TimeOpts represents the options for the times of records written by handlers.
+//
+// They are applied by ReplaceAttr, which works with any handler that supports slog.HandlerOptions.ReplaceAttr, and
+// by the Time option of the console handler. The clock and location apply to all handlers, but the format only
+// applies to handlers that write times as text, i.e. the console handler, slog.TextHandler, slog.JSONHandler,
+// LogfmtHandler and CSVHandler. The other handlers of this package, like GCPHandler, ECSHandler, BinaryHandler,
+// ProtoHandler and GELFHandler, write times in the way required by their schema or encoding, so they ignore the
+// format and write the time with only the clock and location applied.
+type TimeOpts struct {
+	// Clock tells the time that records are logged with, instead of the time they were actually logged at. By
+	// default, records are logged with their own time.
+	Clock Clock
+
+	// Format is the format that times are written in. By default, times are written the way the handler writes them.
+	Format TimeFormat
+
+	// Layout is the layout used to write times with TimeFormatLayout. See time.Layout. If it is empty, times are
+	// written with time.RFC3339.
+	Layout string
+
+	// Location is the time zone that times are written in, e.g. time.UTC, time.Local or a location loaded with
+	// time.LoadLocation. By default, times are written in the time zone they were logged in, which is the local one.
+	Location *time.Location
+}
+
+// ReplaceAttr returns a function to be used as slog.HandlerOptions.ReplaceAttr, which replaces the time of records by
+// the time told by the clock, converts it to the location and writes it in the format.
+//
+// slog passes the built-in time to ReplaceAttr like any other attribute, so a time attribute of a record at the top
+// level with the key "time" can't be told apart from it, and is replaced as well. Log such times in a group or with
+// another key to keep them.
+//
+// If next is not nil, it is called on every attribute before the time is replaced, with the original values.
+func (o TimeOpts) ReplaceAttr(
+	next func(groups []string, attr slog.Attr) slog.Attr,
+) func(groups []string, attr slog.Attr) slog.Attr {
+	// Elapsed times are measured from now, using the clock if there is one
+	start := time.Now()
+	if o.Clock != nil {
+		start = o.Clock.Now()
+	}
+
+	return func(groups []string, attr slog.Attr) slog.Attr {
+		if next != nil {
+			attr = next(groups, attr)
+		}
+
+		// Only top level times with this key are replaced, which includes the built-in time along with any attribute of
+		// the record with the same key, and records without a time are left without one
+		if len(groups) > 0 || attr.Key != slog.TimeKey || attr.Value.Kind() != slog.KindTime {
+			return attr
+		}
+		t := attr.Value.Time()
+		if t.IsZero() {
+			return attr
+		}
+
+		if o.Clock != nil {
+			t = o.Clock.Now()
+		}
+		if o.Location != nil {
+			t = t.In(o.Location)
+		}
+
+		if o.Format == TimeFormatDefault {
+			attr.Value = slog.TimeValue(t)
+			return attr
+		}
+
+		// Keep the time along with the formatted value, for the handlers that can only write times
+		attr.Value = slog.AnyValue(formattedTime{time: t, value: o.formatTime(t, start)})
+		return attr
+	}
+}
+
+// formattedTime is a time written in a format by TimeOpts. It is logged as the formatted value, and handlers that
+// can't write times in another format write the time instead.
+type formattedTime struct {
+	time  time.Time
+	value slog.Value
+}
+
+// LogValue returns the formatted value.
+func (f formattedTime) LogValue() slog.Value {
+	return f.value
+}
+
+// formatTime returns the value that a time is written as in the format.
+func (o TimeOpts) formatTime(t, start time.Time) slog.Value {
+	switch o.Format {
+	case TimeFormatRFC3339:
+		return slog.StringValue(t.Format(time.RFC3339))
+	case TimeFormatRFC3339Nano:
+		return slog.StringValue(t.Format(time.RFC3339Nano))
+	case TimeFormatUnix:
+		return slog.Int64Value(t.Unix())
+	case TimeFormatUnixMilli:
+		return slog.Int64Value(t.UnixMilli())
+	case TimeFormatKitchen:
+		return slog.StringValue(t.Format(time.Kitchen))
+	case TimeFormatElapsed:
+		return slog.DurationValue(t.Sub(start))
+	case TimeFormatLayout:
+		if o.Layout == "" {
+			return slog.StringValue(t.Format(time.RFC3339))
+		}
+		return slog.StringValue(t.Format(o.Layout))
+	default:
+		return slog.TimeValue(t)
+	}
+}
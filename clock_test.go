@@ -0,0 +1,175 @@
+package loggy_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestTimeOpts_ReplaceAttr tests the function returned by TimeOpts.ReplaceAttr with every time format, in a time zone
+// other than the one the clock tells the time in.
+func TestTimeOpts_ReplaceAttr(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.UTC)
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+
+	tests := map[loggy.TimeFormat]slog.Value{
+		loggy.TimeFormatDefault:     slog.TimeValue(now.In(ist)),
+		loggy.TimeFormatRFC3339:     slog.StringValue("2024-03-01T15:00:15+05:30"),
+		loggy.TimeFormatRFC3339Nano: slog.StringValue("2024-03-01T15:00:15.123456789+05:30"),
+		loggy.TimeFormatUnix:        slog.Int64Value(1709285415),
+		loggy.TimeFormatUnixMilli:   slog.Int64Value(1709285415123),
+		loggy.TimeFormatKitchen:     slog.StringValue("3:00PM"),
+		loggy.TimeFormatLayout:      slog.StringValue("01/03 15:00"),
+	}
+	for format, expected := range tests {
+		opts := loggy.TimeOpts{Clock: loggy.FixedClock(now), Format: format, Layout: "02/01 15:04", Location: ist}
+		attr := opts.ReplaceAttr(nil)(nil, slog.Time(slog.TimeKey, time.Now()))
+		value := attr.Value.Resolve()
+		assert.True(t, expected.Equal(value), "format %d: got %v, expected %v", format, value, expected)
+	}
+
+	// Check that the layout format falls back to RFC 3339 without a layout
+	opts := loggy.TimeOpts{Clock: loggy.FixedClock(now), Format: loggy.TimeFormatLayout, Location: ist}
+	attr := opts.ReplaceAttr(nil)(nil, slog.Time(slog.TimeKey, time.Now()))
+	assert.Equal(t, "2024-03-01T15:00:15+05:30", attr.Value.Resolve().String())
+}
+
+// TestTimeOpts_ReplaceAttr_Elapsed tests the function returned by TimeOpts.ReplaceAttr with the elapsed time format,
+// which should write the time since the function was created, and with other attributes that shouldn't be replaced.
+func TestTimeOpts_ReplaceAttr_Elapsed(t *testing.T) {
+	// Create a clock that moves on by 1.5 seconds every time it is read
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := loggy.ClockFunc(
+		func() time.Time {
+			now = now.Add(1500 * time.Millisecond)
+			return now
+		},
+	)
+	var outputStream strings.Builder
+	logger := slog.New(
+		slog.NewTextHandler(
+			&outputStream,
+			&slog.HandlerOptions{
+				ReplaceAttr: loggy.TimeOpts{Clock: clock, Format: loggy.TimeFormatElapsed}.ReplaceAttr(nil),
+			},
+		),
+	)
+
+	// Log records, one with a time attribute in a group and one at the top level with another key
+	logger.Info("first", slog.Group("g", slog.Time("time", now)))
+	logger.Info("second", slog.Time("at", now))
+
+	// Check the output
+	assert.Equal(
+		t,
+		"time=1.5s level=INFO msg=first g.time=2024-01-01T00:00:01.500Z\n"+
+			"time=3s level=INFO msg=second at=2024-01-01T00:00:03.000Z\n",
+		outputStream.String(),
+	)
+}
+
+// TestTimeOpts_ReplaceAttr_Handlers tests the function returned by TimeOpts.ReplaceAttr with handlers that write times
+// as text, which should write them in the format, and with handlers that have their own time encoding, which should
+// ignore the format and only use the clock and location.
+func TestTimeOpts_ReplaceAttr_Handlers(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 30, 15, 0, time.UTC)
+	replaceAttr := loggy.TimeOpts{
+		Clock: loggy.FixedClock(now), Format: loggy.TimeFormatUnixMilli, Location: time.FixedZone("IST", 19800),
+	}.ReplaceAttr(nil)
+
+	// Write a record as logfmt and CSV
+	var logfmtStream, csvStream strings.Builder
+	slog.New(
+		loggy.NewLogfmtHandler(
+			&logfmtStream, loggy.LogfmtHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: replaceAttr}},
+		),
+	).Info("test")
+	slog.New(
+		loggy.NewCSVHandler(
+			&csvStream, loggy.CSVHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: replaceAttr}},
+		),
+	).Info("test")
+	assert.Equal(t, "time=1709285415000 level=INFO msg=test\n", logfmtStream.String())
+	assert.Equal(t, "time,level,msg,extra\n1709285415000,INFO,test,\n", csvStream.String())
+
+	// Write a record as protobuf, which should have the time told by the clock
+	var protoStream bytes.Buffer
+	slog.New(
+		loggy.NewProtoHandler(
+			&protoStream, loggy.ProtoHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: replaceAttr}},
+		),
+	).Info("test")
+	record, err := loggy.NewProtoDecoder(&protoStream).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, now.Equal(record.Time), "the time should be kept instead of the formatted value")
+
+	// Write a record as GCP and ECS structured logs, which should have the time told by the clock in the time zone
+	var gcpStream, ecsStream bytes.Buffer
+	slog.New(
+		loggy.NewGCPHandler(
+			&gcpStream, loggy.GCPHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: replaceAttr}},
+		),
+	).Info("test")
+	slog.New(
+		loggy.NewECSHandler(
+			&ecsStream, loggy.ECSHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: replaceAttr}},
+		),
+	).Info("test")
+	assert.Equal(t, "2024-03-01T15:00:15+05:30", decodeJSONLogs(t, gcpStream.String())[0]["time"])
+	assert.Equal(t, "2024-03-01T15:00:15+05:30", decodeJSONLogs(t, ecsStream.String())[0]["@timestamp"])
+}
+
+// TestNewConsoleLogHandler_Time tests the handler returned by NewConsoleLogHandler with time options, which should
+// write the time in the format and time zone, after the deterministic clock.
+func TestNewConsoleLogHandler_Time(t *testing.T) {
+	// Capture the output of the console handler
+	output, err := captureConsoleOutput(
+		t, false, func() {
+			handler := loggy.NewConsoleLogHandler(
+				loggy.ConsoleLogWriterOpts{
+					Deterministic: &loggy.DeterministicOpts{},
+					Time:          &loggy.TimeOpts{Format: loggy.TimeFormatKitchen, Location: time.FixedZone("IST", 19800)},
+				},
+			)
+			slog.New(handler).Info("test")
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	// Check the output
+	assert.Equal(t, "time=5:30AM level=INFO msg=test\n", output)
+}
+
+// TestNewConsoleLogHandler_TimeGCP tests the handler returned by NewConsoleLogHandler with time options and the GCP
+// format, which should keep writing the time as a timestamp, in the time zone.
+func TestNewConsoleLogHandler_TimeGCP(t *testing.T) {
+	// Capture the output of the console handler
+	output, err := captureConsoleOutput(
+		t, false, func() {
+			handler := loggy.NewConsoleLogHandler(
+				loggy.ConsoleLogWriterOpts{
+					Format:        loggy.ConsoleFormatGCP,
+					Deterministic: &loggy.DeterministicOpts{},
+					Time:          &loggy.TimeOpts{Format: loggy.TimeFormatKitchen, Location: time.FixedZone("IST", 19800)},
+				},
+			)
+			slog.New(handler).Info("test")
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	// Check the output
+	assert.Equal(t, `{"message":"test","severity":"INFO","time":"1970-01-01T05:30:00+05:30"}`+"\n", output)
+}
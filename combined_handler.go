@@ -66,7 +66,13 @@ func (h CombinedHandler) Handle(ctx context.Context, record slog.Record) error {
 // WithAttrs returns a new CombinedHandler whose child handlers' attributes consist of
 // both the child handlers' attributes and the arguments.
 // The CombinedHandler owns the slice: it may retain, modify or discard it.
+//
+// If there are no attributes, WithAttrs returns the receiver.
 func (h CombinedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
 	// Create a new CombinedHandler
 	newHandler := CombinedHandler{}
 
@@ -88,6 +94,10 @@ func (h CombinedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 //
 // If the name is empty, WithGroup returns the receiver.
 func (h CombinedHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
 	// Create a new CombinedHandler
 	newHandler := CombinedHandler{}
 
@@ -334,3 +334,35 @@ func TestNewCombinedHandler_Enabled_True(t *testing.T) {
 	// Check if Info level is enabled
 	assert.Equal(t, true, logger.Enabled(context.Background(), slog.LevelInfo))
 }
+
+// countingHandler is a handler that discards records and counts the handlers derived from it.
+type countingHandler struct {
+	derived *int
+}
+
+func (h countingHandler) Enabled(context.Context, slog.Level) bool  { return true }
+func (h countingHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h countingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	*h.derived++
+	return h
+}
+func (h countingHandler) WithGroup(string) slog.Handler {
+	*h.derived++
+	return h
+}
+
+// TestCombinedHandler_ReturnsReceiver tests that the WithAttrs and WithGroup methods of the CombinedHandler returned by
+// NewCombinedHandler return the receiver without deriving any child handlers when there are no attributes or the group
+// name is empty.
+func TestCombinedHandler_ReturnsReceiver(t *testing.T) {
+	var derived int
+	handler := loggy.NewCombinedHandler(countingHandler{derived: &derived})
+
+	assert.Equal(t, handler, handler.WithAttrs(nil))
+	assert.Equal(t, handler, handler.WithGroup(""))
+	assert.Equal(t, 0, derived)
+
+	// Check that the child handlers are still derived otherwise
+	handler.WithAttrs([]slog.Attr{slog.Int("a", 1)}).WithGroup("g")
+	assert.Equal(t, 2, derived)
+}
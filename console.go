@@ -13,6 +13,9 @@ import (
 // It implements the `slog.Writer` interface, allowing it to be used as a logger handler.
 type ConsoleLogWriter struct {
 	outputStream io.Writer
+
+	// preset is used to find the level of log messages whose built-in attributes were rewritten by a FieldPreset
+	preset FieldPreset
 }
 
 // Write writes the log message to the standard error output.
@@ -31,26 +34,65 @@ func (w ConsoleLogWriter) Write(p []byte) (n int, err error) {
 
 	// Colourise according to log levels
 	switch {
-	case checkLevel(log, slog.LevelError):
+	case w.checkLevel(log, LevelFatal), w.checkLevel(log, slog.LevelError):
 		return color.New(color.FgRed).Fprint(w.outputStream, log)
-	case checkLevel(log, slog.LevelWarn):
+	case w.checkLevel(log, slog.LevelWarn):
 		return color.New(color.FgYellow).Fprint(w.outputStream, log)
-	case checkLevel(log, slog.LevelInfo):
+	case w.checkLevel(log, slog.LevelInfo):
 		return color.New(color.FgBlue).Fprint(w.outputStream, log)
 	default:
 		return w.outputStream.Write([]byte(log))
 	}
 }
 
+// checkLevel checks whether the log message has the given level, using the level key and value of the preset.
+func (w ConsoleLogWriter) checkLevel(log string, level slog.Level) bool {
+	return checkLevel(log, w.preset.levelKey(), w.preset.levelValue(level))
+}
+
+// ConsoleFormat is the format of the log messages written by the console handler.
+type ConsoleFormat int
+
+const (
+	// ConsoleFormatText writes log messages as key=value pairs. This is the default.
+	ConsoleFormatText ConsoleFormat = iota
+	// ConsoleFormatJSON writes log messages as JSON objects.
+	ConsoleFormatJSON
+	// ConsoleFormatGCP writes log messages as Google Cloud Logging structured logs. See GCPHandler.
+	ConsoleFormatGCP
+	// ConsoleFormatECS writes log messages as Elastic Common Schema documents. See ECSHandler.
+	ConsoleFormatECS
+	// ConsoleFormatLogfmt writes log messages as strictly quoted logfmt lines. See LogfmtHandler.
+	ConsoleFormatLogfmt
+)
+
 // ConsoleLogWriterOpts represents the options for configuring the behavior of the `ConsoleLogWriter`.
 type ConsoleLogWriterOpts struct {
-	// JSON specifies whether to use JSON format for log messages.
+	// JSON specifies whether to use JSON format for log messages. It is the same as setting Format to
+	// ConsoleFormatJSON.
 	JSON bool
 
+	// Format specifies the format of log messages. By default, they are written as text.
+	Format ConsoleFormat
+
 	// LogToStdout specifies whether to write log messages to stdout. By default,
 	// the ConsoleLogWriter will write logs to stderr.
 	LogToStdout bool
 
+	// Preset rewrites the keys of the built-in attributes and the level values to the schema of a log backend, e.g.
+	// ECSPreset. It is applied after HandlerOptions.ReplaceAttr, and only to the text, JSON and logfmt formats.
+	Preset *FieldPreset
+
+	// Deterministic makes the output the same on every run, for golden files and examples, by replacing the time of
+	// log messages by the time told by a clock, making the paths of source files relative and sorting attributes by
+	// their keys. See DeterministicOpts.
+	Deterministic *DeterministicOpts
+
+	// Time sets the clock, format and time zone of the times of log messages, e.g. to write them as the time of day
+	// in UTC. It is applied after Deterministic. The GCP and ECS formats ignore the format, and only apply the clock and
+	// time zone. See TimeOpts.
+	Time *TimeOpts
+
 	// HandlerOptions contains additional options for the logger handler.
 	HandlerOptions slog.HandlerOptions
 }
@@ -64,6 +106,19 @@ func NewConsoleLogHandler(options ...ConsoleLogWriterOpts) slog.Handler {
 		opts = options[0]
 	}
 
+	// If deterministic output is enabled, replace the times and source paths of log messages before anything else,
+	// and sort the attributes of the handler that would be created otherwise
+	if opts.Deterministic != nil {
+		opts.HandlerOptions.ReplaceAttr = opts.Deterministic.ReplaceAttr(opts.HandlerOptions.ReplaceAttr)
+		opts.Deterministic = nil
+		return NewTransformHandler(NewConsoleLogHandler(opts), SortAttrs())
+	}
+
+	// If time options are provided, replace the times of log messages before the preset renames their keys
+	if opts.Time != nil {
+		opts.HandlerOptions.ReplaceAttr = opts.Time.ReplaceAttr(opts.HandlerOptions.ReplaceAttr)
+	}
+
 	// Select the stream to output to
 	outputStream := os.Stderr
 	if opts.LogToStdout {
@@ -73,11 +128,33 @@ func NewConsoleLogHandler(options ...ConsoleLogWriterOpts) slog.Handler {
 	// Create a new ConsoleLogWriter with all the required params
 	writer := ConsoleLogWriter{outputStream: outputStream}
 
+	// Formats for specific backends have their own schema, so only their level key and values are needed to colourise
+	// log messages
+	switch opts.Format {
+	case ConsoleFormatGCP:
+		writer.preset = GCPPreset
+		return NewGCPHandler(writer, GCPHandlerOpts{HandlerOptions: opts.HandlerOptions})
+	case ConsoleFormatECS:
+		writer.preset = ECSPreset
+		return NewECSHandler(writer, ECSHandlerOpts{HandlerOptions: opts.HandlerOptions})
+	}
+
+	// If a preset is provided, rewrite the built-in attributes with it
+	if opts.Preset != nil {
+		writer.preset = *opts.Preset
+		opts.HandlerOptions.ReplaceAttr = opts.Preset.ReplaceAttr(opts.HandlerOptions.ReplaceAttr)
+	}
+
 	// If the JSON option is enabled, create a new JSON handler using the writer and opts.HandlerOptions
-	if opts.JSON {
+	if opts.JSON || opts.Format == ConsoleFormatJSON {
 		return slog.NewJSONHandler(writer, &opts.HandlerOptions)
 	}
 
+	// If the logfmt format is selected, create a new logfmt handler using the writer and opts.HandlerOptions
+	if opts.Format == ConsoleFormatLogfmt {
+		return NewLogfmtHandler(writer, LogfmtHandlerOpts{HandlerOptions: opts.HandlerOptions})
+	}
+
 	// Otherwise, create a new text handler using the writer and opts.HandlerOptions
 	return slog.NewTextHandler(writer, &opts.HandlerOptions)
 }
@@ -0,0 +1,89 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+)
+
+// contextAttrsKey is the key that attributes are stored under in a context.
+type contextAttrsKey struct{}
+
+// WithContextAttrs returns a copy of ctx that carries the given attributes along with any attributes that were
+// already stored in ctx. A ContextHandler adds them to every record that is logged with the returned context, e.g.
+// via slog.InfoContext.
+func WithContextAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+
+	// Copy the existing attributes, so that contexts derived from the same parent do not share a backing array
+	existing := ContextAttrs(ctx)
+	newAttrs := make([]slog.Attr, 0, len(existing)+len(attrs))
+	newAttrs = append(newAttrs, existing...)
+	newAttrs = append(newAttrs, attrs...)
+
+	return context.WithValue(ctx, contextAttrsKey{}, newAttrs)
+}
+
+// ContextAttrs returns the attributes stored in ctx with WithContextAttrs, in the order they were added.
+func ContextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+
+	attrs, _ := ctx.Value(contextAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// ContextHandler is a handler that adds the attributes stored in the context of every record with WithContextAttrs
+// before passing it on to another handler. This allows request scoped attributes like request IDs and user IDs to be
+// added to logs without passing loggers around.
+//
+// The attributes from the context are always added at the top level of the record, even if the handler has groups.
+type ContextHandler struct {
+	handler slog.Handler
+	goas    []groupOrAttrs
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle adds the attributes from the context to the record and passes it on to the wrapped handler.
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := ContextAttrs(ctx)
+
+	// Nothing needs to change if there are no attributes in the context and no groups to qualify the attributes by
+	if len(attrs) == 0 && len(h.goas) == 0 {
+		return h.handler.Handle(ctx, record)
+	}
+
+	// Copy the attributes from the context, so that the ones from the record aren't appended to its backing array
+	attrs = append(attrs[:len(attrs):len(attrs)], collectAttrs(h.goas, record, nil)...)
+	return h.handler.Handle(ctx, recordWithAttrs(record, attrs))
+}
+
+// WithAttrs returns a new ContextHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &ContextHandler{handler: h.handler, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new ContextHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &ContextHandler{handler: h.handler, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// NewContextHandler returns a ContextHandler that adds the attributes stored in the context of records with
+// WithContextAttrs before passing them on to the given handler.
+func NewContextHandler(handler slog.Handler) slog.Handler {
+	return &ContextHandler{handler: handler}
+}
@@ -0,0 +1,80 @@
+package loggy_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestWithContextAttrs tests the WithContextAttrs function with attributes added to a context in two steps, which
+// should not affect the parent context.
+func TestWithContextAttrs(t *testing.T) {
+	// Add attributes to a context, and then to a child of it
+	parent := loggy.WithContextAttrs(context.Background(), slog.String("request_id", "abc"))
+	child := loggy.WithContextAttrs(parent, slog.Int("user_id", 42))
+
+	// Check the attributes in both contexts
+	assert.Equal(t, []slog.Attr{slog.String("request_id", "abc")}, loggy.ContextAttrs(parent))
+	assert.Equal(
+		t, []slog.Attr{slog.String("request_id", "abc"), slog.Int("user_id", 42)}, loggy.ContextAttrs(child),
+	)
+	assert.Empty(t, loggy.ContextAttrs(context.Background()))
+}
+
+// TestNewContextHandler tests the ContextHandler returned by NewContextHandler with a record logged using a context
+// carrying attributes, which should be added at the top level even though the logger has a group.
+func TestNewContextHandler(t *testing.T) {
+	// Create a logger that adds attributes from the context to a text handler
+	var outputStream strings.Builder
+	handler := loggy.NewContextHandler(slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}))
+	logger := slog.New(handler).With("service", "api").WithGroup("request")
+
+	// Log a message with a context carrying attributes
+	ctx := loggy.WithContextAttrs(context.Background(), slog.String("request_id", "abc"), slog.Int("user_id", 42))
+	logger.InfoContext(ctx, "this is a test log", "method", "GET")
+
+	// Check the output
+	expectedOutput := "level=INFO msg=\"this is a test log\" request_id=abc user_id=42 service=api " +
+		"request.method=GET\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+}
+
+// TestNewContextHandler_NoAttrs tests the ContextHandler returned by NewContextHandler with a record logged without a
+// context, which should be passed on unchanged.
+func TestNewContextHandler_NoAttrs(t *testing.T) {
+	// Create a logger that adds attributes from the context to a JSON handler
+	var outputStream strings.Builder
+	handler := loggy.NewContextHandler(slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}))
+
+	// Log a message without a context
+	slog.New(handler).Warn("this is a test log", "key", "value")
+
+	// Check the output
+	assert.Equal(t, "{\"level\":\"WARN\",\"msg\":\"this is a test log\",\"key\":\"value\"}\n", outputStream.String())
+}
+
+// TestNewContextHandler_CombinedHandler tests the ContextHandler returned by NewContextHandler wrapping a
+// CombinedHandler, which should pass the attributes from the context to all of its children.
+func TestNewContextHandler_CombinedHandler(t *testing.T) {
+	// Create a logger that adds attributes from the context to two handlers
+	var textOutput, jsonOutput strings.Builder
+	handler := loggy.NewContextHandler(
+		loggy.NewCombinedHandler(
+			slog.NewTextHandler(&textOutput, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+			slog.NewJSONHandler(&jsonOutput, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		),
+	)
+
+	// Log a message with a context carrying attributes
+	ctx := loggy.WithContextAttrs(context.Background(), slog.String("request_id", "abc"))
+	slog.New(handler).ErrorContext(ctx, "this is a test log")
+
+	// Check the output of both handlers
+	assert.Equal(t, "level=ERROR msg=\"this is a test log\" request_id=abc\n", textOutput.String())
+	assert.Equal(t, "{\"level\":\"ERROR\",\"msg\":\"this is a test log\",\"request_id\":\"abc\"}\n", jsonOutput.String())
+}
@@ -0,0 +1,252 @@
+package loggy
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// CSVHeader specifies when the CSVHandler writes the header row.
+type CSVHeader int
+
+const (
+	// CSVHeaderAuto writes the header before the first record, unless the writer is a file that already has data in
+	// it, so that appending to an existing file doesn't add another header in the middle of it. This is the default.
+	CSVHeaderAuto CSVHeader = iota
+	// CSVHeaderAlways writes the header before the first record.
+	CSVHeaderAlways
+	// CSVHeaderNever never writes the header.
+	CSVHeaderNever
+)
+
+// CSVHandlerOpts represents the options for configuring the behaviour of the `CSVHandler`.
+type CSVHandlerOpts struct {
+	// Columns are the keys of the attributes that get a column of their own, after the time, level, message and source
+	// columns. Attributes in groups are matched by their keys joined with dots, e.g. "user.id". The column of an
+	// attribute that isn't logged with a record is left empty.
+	Columns []string
+
+	// ExtraColumn is the name of the last column, which holds the attributes that don't have a column of their own as
+	// a JSON object, with groups as nested objects. It is left empty if there are no such attributes, and holds
+	// "!ERROR:" followed by the error if they can't be encoded, the same way slog.JSONHandler writes such values. By
+	// default, it is "extra".
+	ExtraColumn string
+
+	// Comma is the field delimiter. Set it to '\t' to write TSV. By default, it is ','.
+	Comma rune
+
+	// Header specifies when the header row is written. By default, it is CSVHeaderAuto.
+	Header CSVHeader
+
+	// HandlerOptions contains additional options for the handler. If AddSource is set, a source column holding the
+	// file and line of every record is added after the message column. ReplaceAttr is called for the time and source
+	// of every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// csvState is the state shared between a CSVHandler and the handlers derived from it, as they write to the same
+// writer.
+type csvState struct {
+	mu            sync.Mutex
+	headerWritten bool
+}
+
+// CSVHandler is a handler that writes records as rows of CSV or TSV with a fixed set of columns, so that logs can be
+// loaded into spreadsheets and data frames without any processing.
+//
+// Every row has the time, level and message of a record, followed by its source location (if AddSource is set), the
+// configured attribute columns and the extra column holding all the other attributes as JSON. Fields are quoted as
+// done by the encoding/csv package.
+type CSVHandler struct {
+	opts   CSVHandlerOpts
+	state  *csvState
+	w      io.Writer
+	goas   []groupOrAttrs
+	header []string
+}
+
+// Enabled reports whether the CSVHandler handles records at the given level.
+func (h *CSVHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle writes the record as a row, preceded by the header row if it hasn't been written yet.
+func (h *CSVHandler) Handle(_ context.Context, record slog.Record) error {
+	row := h.buildRow(record)
+
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+
+	// Encode the header along with the first row
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = h.opts.Comma
+	if !h.state.headerWritten {
+		h.state.headerWritten = true
+		if h.needsHeader() {
+			_ = writer.Write(h.header)
+		}
+	}
+	_ = writer.Write(row)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+// WithAttrs returns a new CSVHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *CSVHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &CSVHandler{
+		opts: h.opts, state: h.state, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs}), header: h.header,
+	}
+}
+
+// WithGroup returns a new CSVHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *CSVHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &CSVHandler{
+		opts: h.opts, state: h.state, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name}), header: h.header,
+	}
+}
+
+// needsHeader reports whether the header row has to be written before the first row.
+func (h *CSVHandler) needsHeader() bool {
+	switch h.opts.Header {
+	case CSVHeaderAlways:
+		return true
+	case CSVHeaderNever:
+		return false
+	}
+
+	// Don't write the header to files that already have rows in them
+	if file, ok := h.w.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size() == 0
+		}
+	}
+	return true
+}
+
+// buildRow creates the fields of the row for a record.
+func (h *CSVHandler) buildRow(record slog.Record) []string {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+	row := make([]string, 0, len(h.header))
+
+	// Add the time, unless it has been removed
+	var timeField string
+	if !record.Time.IsZero() {
+		if attr := replaceBuiltin(replace, slog.Time(slog.TimeKey, record.Time)); !attr.Equal(slog.Attr{}) {
+			timeField = valueToString(attr.Value.Resolve())
+		}
+	}
+	row = append(row, timeField, record.Level.String(), record.Message)
+
+	// Add the source location
+	if h.opts.HandlerOptions.AddSource {
+		var sourceField string
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				sourceField = fmt.Sprintf("%s:%d", source.File, source.Line)
+			} else if !attr.Equal(slog.Attr{}) {
+				sourceField = valueToString(attr.Value.Resolve())
+			}
+		}
+		row = append(row, sourceField)
+	}
+
+	// Add the attributes with columns of their own, and the extra attributes as JSON
+	attrs := collectAttrs(h.goas, record, replace)
+	columns := make(map[string]string, len(h.opts.Columns))
+	for _, column := range h.opts.Columns {
+		columns[column] = ""
+	}
+	extra := csvExtra("", attrs, columns)
+	for _, column := range h.opts.Columns {
+		row = append(row, columns[column])
+	}
+
+	// Keep the rest of the row if the extra attributes can't be encoded, e.g. because a json.Marshaler failed
+	var extraField string
+	if len(extra) > 0 {
+		data, err := json.Marshal(extra)
+		if err != nil {
+			extraField = "!ERROR:" + err.Error()
+		} else {
+			extraField = string(data)
+		}
+	}
+	return append(row, extraField)
+}
+
+// csvExtra stores the values of the attributes that have a column in columns, and returns all the other attributes
+// as a map that can be marshalled into JSON. Groups that have no attributes left are omitted.
+func csvExtra(prefix string, attrs []slog.Attr, columns map[string]string) map[string]any {
+	extra := make(map[string]any)
+	for _, attr := range attrs {
+		key := attr.Key
+		if prefix != "" {
+			key = prefix + "." + attr.Key
+		}
+
+		if _, ok := columns[key]; ok {
+			columns[key] = valueToString(attr.Value)
+			continue
+		}
+		if attr.Value.Kind() == slog.KindGroup {
+			if group := csvExtra(key, attr.Value.Group(), columns); len(group) > 0 {
+				extra[attr.Key] = group
+			}
+			continue
+		}
+		extra[attr.Key] = valueToAny(attr.Value)
+	}
+	return extra
+}
+
+// NewCSVHandler returns a CSVHandler that writes records to w as rows of CSV, or TSV if the Comma option is '\t'.
+func NewCSVHandler(w io.Writer, options ...CSVHandlerOpts) *CSVHandler {
+	// If options are provided, assign the first option to opts
+	var opts CSVHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.ExtraColumn == "" {
+		opts.ExtraColumn = "extra"
+	}
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+
+	// Create the header row
+	header := []string{slog.TimeKey, slog.LevelKey, slog.MessageKey}
+	if opts.HandlerOptions.AddSource {
+		header = append(header, slog.SourceKey)
+	}
+	header = append(header, opts.Columns...)
+	header = append(header, opts.ExtraColumn)
+
+	return &CSVHandler{opts: opts, state: &csvState{}, w: w, header: header}
+}
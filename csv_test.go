@@ -0,0 +1,152 @@
+package loggy_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewCSVHandler tests the CSVHandler returned by NewCSVHandler with configured columns, which should be taken out
+// of the extra column, and values that need to be quoted.
+func TestNewCSVHandler(t *testing.T) {
+	// Create a logger that writes CSV to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewCSVHandler(
+		&outputStream,
+		loggy.CSVHandlerOpts{
+			Columns:        []string{"request.path", "user.id", "status"},
+			HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime},
+		},
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log records with and without the configured columns
+	logger.Info(
+		"request handled", slog.Group("request", "path", "/users/42", "query", "a,b"), "status", 200,
+		slog.Group("user", "id", 42),
+	)
+	logger.Warn("line 1\nline \"2\"")
+
+	// Check the output
+	expectedOutput := "time,level,msg,request.path,user.id,status,extra\n" +
+		",INFO,request handled,/users/42,42,200," +
+		"\"{\"\"request\"\":{\"\"query\"\":\"\"a,b\"\"},\"\"service\"\":\"\"api\"\"}\"\n" +
+		",WARN,\"line 1\nline \"\"2\"\"\",,,,\"{\"\"service\"\":\"\"api\"\"}\"\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+
+	// Check that the output can be parsed back
+	rows, err := csv.NewReader(strings.NewReader(outputStream.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "line 1\nline \"2\"", rows[2][2])
+}
+
+// failingMarshaler is a value that can't be marshalled into JSON.
+type failingMarshaler struct{}
+
+// MarshalJSON always fails.
+func (failingMarshaler) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("cannot marshal")
+}
+
+// TestNewCSVHandler_ExtraValues tests the CSVHandler returned by NewCSVHandler with values that JSON can't represent,
+// which should be written as strings, and a value that fails to be marshalled, which should only affect the extra
+// column instead of dropping the row.
+func TestNewCSVHandler_ExtraValues(t *testing.T) {
+	// Create a logger that writes CSV to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewCSVHandler(
+		&outputStream,
+		loggy.CSVHandlerOpts{
+			Columns:        []string{"status"},
+			Header:         loggy.CSVHeaderNever,
+			HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime},
+		},
+	)
+	logger := slog.New(handler)
+
+	// Log a record with non-finite floats and a nil pointer, and one with a value that can't be marshalled
+	logger.Info("first", "ratio", math.NaN(), "limit", math.Inf(1), "url", (*url.URL)(nil))
+	logger.Info("second", "status", 500, "value", failingMarshaler{})
+
+	// Check the output
+	rows, err := csv.NewReader(strings.NewReader(outputStream.String())).ReadAll()
+	if !assert.NoError(t, err) || !assert.Len(t, rows, 2) {
+		return
+	}
+	assert.Equal(t, []string{"", "INFO", "first", ""}, rows[0][:4])
+	var extra map[string]any
+	if assert.NoError(t, json.Unmarshal([]byte(rows[0][4]), &extra)) {
+		assert.Equal(t, map[string]any{"limit": "+Inf", "ratio": "NaN", "url": "<nil>"}, extra)
+	}
+	assert.Equal(t, []string{"", "INFO", "second", "500"}, rows[1][:4])
+	assert.True(t, strings.HasPrefix(rows[1][4], "!ERROR:"), rows[1][4])
+}
+
+// TestNewCSVHandler_TSV tests the CSVHandler returned by NewCSVHandler with tabs as the delimiter, the source column,
+// a custom extra column and without the header.
+func TestNewCSVHandler_TSV(t *testing.T) {
+	// Create a logger that writes TSV to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewCSVHandler(
+		&outputStream,
+		loggy.CSVHandlerOpts{
+			ExtraColumn:    "attrs",
+			Comma:          '\t',
+			Header:         loggy.CSVHeaderNever,
+			HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: removeTime},
+		},
+	)
+
+	// Log a record without any attributes
+	slog.New(handler).Error("this is a test log")
+
+	// Check the output
+	fields := strings.Split(strings.TrimSuffix(outputStream.String(), "\n"), "\t")
+	if !assert.Len(t, fields, 5) {
+		return
+	}
+	assert.Equal(t, []string{"", "ERROR", "this is a test log"}, fields[:3])
+	assert.Regexp(t, `csv_test\.go:\d+$`, fields[3])
+	assert.Equal(t, "", fields[4])
+}
+
+// TestNewCSVHandler_Files tests the CSVHandler returned by NewCSVHandler with files, where the header should only be
+// written to new files.
+func TestNewCSVHandler_Files(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.csv")
+
+	// Log a record to the file twice, opening it in append mode every time
+	for i := 0; i < 2; i++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := loggy.NewCSVHandler(
+			file, loggy.CSVHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime}},
+		)
+		slog.New(handler).Info("this is a test log", "i", i)
+		assert.NoError(t, file.Close())
+	}
+
+	// Check that the header was only written once
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := "time,level,msg,extra\n" +
+		",INFO,this is a test log,\"{\"\"i\"\":0}\"\n" +
+		",INFO,this is a test log,\"{\"\"i\"\":1}\"\n"
+	assert.Equal(t, expectedOutput, string(data))
+}
@@ -0,0 +1,266 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupDefaultWindow is the default maximum time a record is held back while waiting for duplicates of it.
+const dedupDefaultWindow = time.Second
+
+// DedupHandlerOpts represents the options for configuring the behaviour of the `DedupHandler`.
+type DedupHandlerOpts struct {
+	// Window is the maximum time a record is held back while waiting for duplicates of it, measured from when the
+	// first of them was logged. By default, it is one second.
+	Window time.Duration
+
+	// RepeatedKey is the key of the attribute holding the number of times a collapsed record was logged. By default,
+	// it is "repeated".
+	RepeatedKey string
+
+	// FirstSeenKey is the key of the attribute holding the time of the first of the collapsed records. By default, it
+	// is "first_seen".
+	FirstSeenKey string
+
+	// LastSeenKey is the key of the attribute holding the time of the last of the collapsed records. By default, it is
+	// "last_seen".
+	LastSeenKey string
+}
+
+// dedupPending is the record that is held back while waiting for duplicates of it.
+type dedupPending struct {
+	ctx       context.Context
+	record    slog.Record
+	key       string
+	repeated  int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// deduper holds the pending record. It is shared between a DedupHandler and all the handlers derived from it.
+type deduper struct {
+	handler slog.Handler
+	opts    DedupHandlerOpts
+
+	// mu guards the pending record and whether the deduper has been closed, and is held while records are passed on
+	// to keep them in order
+	mu      sync.Mutex
+	pending *dedupPending
+	closed  bool
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// DedupHandler is a handler that collapses consecutive identical records into one before passing them on to another
+// handler, to keep retry loops from flooding the logs.
+//
+// Records are identical if they have the same level, message and attributes, ignoring their time. Every record is
+// held back until a different record is logged, the window has passed or the handler is closed. If identical records
+// were logged in the meantime, the record is passed on once with attributes holding the number of times it was logged
+// and the times of the first and last of them.
+type DedupHandler struct {
+	deduper *deduper
+	goas    []groupOrAttrs
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *DedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.deduper.handler.Enabled(ctx, level)
+}
+
+// Handle collapses the record into the pending record if they are identical. Otherwise, the pending record is passed
+// on to the wrapped handler, and this record is held back in its place. If the handler has been closed, the record
+// is dropped and ErrHandlerClosed is returned.
+func (h *DedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	// Move the attributes from WithAttrs into the record, so that records logged with different loggers can be
+	// compared and passed on to the wrapped handler
+	record = recordWithAttrs(record, collectAttrs(h.goas, record, nil))
+	key := dedupKey(record)
+
+	seen := record.Time
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+
+	d := h.deduper
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrHandlerClosed
+	}
+	if d.pending != nil && d.pending.key == key {
+		d.pending.repeated++
+		d.pending.lastSeen = seen
+		return nil
+	}
+
+	err := d.flush()
+	d.pending = &dedupPending{ctx: ctx, record: record, key: key, repeated: 1, firstSeen: seen, lastSeen: seen}
+	return err
+}
+
+// WithAttrs returns a new DedupHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *DedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &DedupHandler{deduper: h.deduper, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new DedupHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *DedupHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &DedupHandler{deduper: h.deduper, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// Flush passes the pending record on to the wrapped handler, without waiting for the window to pass.
+func (h *DedupHandler) Flush() error {
+	h.deduper.mu.Lock()
+	defer h.deduper.mu.Unlock()
+	return h.deduper.flush()
+}
+
+// Close stops the background goroutine and passes the pending record on to the wrapped handler. It is shared by all
+// the handlers derived from this one, so none of them can be used after it is closed.
+func (h *DedupHandler) Close() error {
+	var err error
+	h.deduper.closeOnce.Do(
+		func() {
+			close(h.deduper.done)
+			<-h.deduper.stopped
+
+			h.deduper.mu.Lock()
+			defer h.deduper.mu.Unlock()
+			h.deduper.closed = true
+			err = h.deduper.flush()
+		},
+	)
+	return err
+}
+
+// flush passes the pending record on to the wrapped handler, with the attributes describing the collapsed records if
+// there were any duplicates of it. The mutex must be held by the caller.
+func (d *deduper) flush() error {
+	pending := d.pending
+	if pending == nil {
+		return nil
+	}
+	d.pending = nil
+
+	record := pending.record
+	if pending.repeated > 1 {
+		record = record.Clone()
+		record.AddAttrs(
+			slog.Int(d.opts.RepeatedKey, pending.repeated),
+			slog.Time(d.opts.FirstSeenKey, pending.firstSeen),
+			slog.Time(d.opts.LastSeenKey, pending.lastSeen),
+		)
+	}
+
+	return d.handler.Handle(pending.ctx, record)
+}
+
+// run passes the pending record on to the wrapped handler once the window has passed, until the deduper is closed.
+func (d *deduper) run() {
+	defer close(d.stopped)
+
+	ticker := time.NewTicker(max(d.opts.Window/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			d.mu.Lock()
+			if d.pending != nil && now.Sub(d.pending.firstSeen) >= d.opts.Window {
+				// There is nowhere to report the error
+				_ = d.flush()
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// dedupKey returns a string that identifies a record by its level, message and attributes.
+func dedupKey(record slog.Record) string {
+	var builder strings.Builder
+	builder.WriteString(record.Level.String())
+	builder.WriteByte(0)
+	builder.WriteString(record.Message)
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			writeDedupAttr(&builder, attr)
+			return true
+		},
+	)
+	return builder.String()
+}
+
+// writeDedupAttr writes an attribute to the key of a record, including its kind so that e.g. the string "1" and the
+// number 1 are different.
+func writeDedupAttr(builder *strings.Builder, attr slog.Attr) {
+	builder.WriteByte(0)
+	builder.WriteString(attr.Key)
+	builder.WriteByte(0)
+	builder.WriteString(attr.Value.Kind().String())
+	builder.WriteByte(0)
+
+	if attr.Value.Kind() != slog.KindGroup {
+		builder.WriteString(valueToString(attr.Value))
+		return
+	}
+
+	builder.WriteByte('{')
+	for _, groupAttr := range attr.Value.Group() {
+		writeDedupAttr(builder, groupAttr)
+	}
+	builder.WriteByte('}')
+}
+
+// NewDedupHandler returns a DedupHandler that collapses consecutive identical records into one before passing them
+// on to the given handler.
+//
+// The handler must be closed to pass on the record that is still held back.
+func NewDedupHandler(handler slog.Handler, options ...DedupHandlerOpts) *DedupHandler {
+	// If options are provided, assign the first option to opts
+	var opts DedupHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Window <= 0 {
+		opts.Window = dedupDefaultWindow
+	}
+	if opts.RepeatedKey == "" {
+		opts.RepeatedKey = "repeated"
+	}
+	if opts.FirstSeenKey == "" {
+		opts.FirstSeenKey = "first_seen"
+	}
+	if opts.LastSeenKey == "" {
+		opts.LastSeenKey = "last_seen"
+	}
+
+	// Start passing on records once the window has passed in the background
+	d := &deduper{
+		handler: handler,
+		opts:    opts,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go d.run()
+
+	return &DedupHandler{deduper: d}
+}
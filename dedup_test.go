@@ -0,0 +1,98 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewDedupHandler tests the DedupHandler returned by NewDedupHandler with consecutive identical records, which
+// should be collapsed into one record, followed by different records, which should be passed on as they are.
+func TestNewDedupHandler(t *testing.T) {
+	// Create a logger that collapses identical records before logging them to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewDedupHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.DedupHandlerOpts{Window: time.Hour},
+	)
+	logger := slog.New(handler).With("service", "api").WithGroup("request")
+
+	// Log the same record a few times, followed by records that differ in their attributes and level
+	for i := 0; i < 5; i++ {
+		logger.Warn("retrying", "attempt", 1)
+	}
+	logger.Warn("retrying", "attempt", "1")
+	logger.Error("retrying", "attempt", "1")
+	assert.NoError(t, handler.Close())
+
+	// Check the collapsed record
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 3) {
+		return
+	}
+	assert.Equal(t, "retrying", logs[0]["msg"])
+	assert.Equal(t, "api", logs[0]["service"])
+	assert.Equal(t, map[string]any{"attempt": float64(1)}, logs[0]["request"])
+	assert.Equal(t, float64(5), logs[0]["repeated"])
+	firstSeen, err := time.Parse(time.RFC3339Nano, logs[0]["first_seen"].(string))
+	assert.NoError(t, err)
+	lastSeen, err := time.Parse(time.RFC3339Nano, logs[0]["last_seen"].(string))
+	assert.NoError(t, err)
+	assert.False(t, lastSeen.Before(firstSeen))
+
+	// Check that the different records were not collapsed
+	assert.Equal(t, "WARN", logs[1]["level"])
+	assert.NotContains(t, logs[1], "repeated")
+	assert.Equal(t, "ERROR", logs[2]["level"])
+	assert.NotContains(t, logs[2], "repeated")
+}
+
+// TestNewDedupHandler_Window tests the DedupHandler returned by NewDedupHandler with a short window, which should pass
+// on the pending record once the window has passed, without waiting for another record.
+func TestNewDedupHandler_Window(t *testing.T) {
+	// Create a logger that holds records back for at most 20 milliseconds
+	var outputStream syncBuffer
+	handler := loggy.NewDedupHandler(
+		slog.NewJSONHandler(&outputStream, nil),
+		loggy.DedupHandlerOpts{Window: 20 * time.Millisecond, RepeatedKey: "count"},
+	)
+	logger := slog.New(handler)
+
+	// Log the same record twice, and wait for the window to pass
+	logger.Info("connection refused")
+	logger.Info("connection refused")
+	time.Sleep(100 * time.Millisecond)
+
+	// Check the collapsed record was logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, float64(2), logs[0]["count"])
+	}
+
+	// Log the record again, which should not be collapsed into the one that was already logged
+	logger.Info("connection refused")
+	assert.NoError(t, handler.Close())
+	logs = decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 2) {
+		assert.NotContains(t, logs[1], "count")
+	}
+}
+
+// TestDedupHandler_Close tests the Close method of the DedupHandler returned by NewDedupHandler, after which records
+// should be dropped with an error instead of being held back forever.
+func TestDedupHandler_Close(t *testing.T) {
+	var outputStream bytes.Buffer
+	handler := loggy.NewDedupHandler(slog.NewJSONHandler(&outputStream, nil))
+	assert.NoError(t, handler.Close())
+
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "after close", 0)
+	assert.ErrorIs(t, handler.Handle(context.Background(), record), loggy.ErrHandlerClosed)
+	assert.ErrorIs(t, handler.WithGroup("group").Handle(context.Background(), record), loggy.ErrHandlerClosed)
+	assert.Empty(t, outputStream.String())
+}
@@ -0,0 +1,89 @@
+package loggy
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeterministicOpts represents the options for making the output of handlers the same on every run, so that it can be
+// compared with golden files or the output of examples.
+//
+// The time of every record is replaced by the time told by a clock, and the paths of source files are made relative.
+// This is done by ReplaceAttr, which works with any handler that supports slog.HandlerOptions.ReplaceAttr. To also
+// sort the attributes of records by their keys, wrap the handler with NewTransformHandler and SortAttrs. The console
+// handler does both with its Deterministic option.
+type DeterministicOpts struct {
+	// Clock tells the time that records are logged with, instead of the time they were actually logged at. By
+	// default, every record is logged at the Unix epoch in UTC.
+	Clock Clock
+
+	// SourceRoot is the directory that the paths of source files are made relative to. By default, it is the working
+	// directory, which is the directory of the package being tested when running go test. Files outside the root are
+	// logged with only their names.
+	SourceRoot string
+}
+
+// ReplaceAttr returns a function to be used as slog.HandlerOptions.ReplaceAttr, which replaces the time of records by
+// the time told by the clock and makes the paths of their source files relative to the source root.
+//
+// slog passes the built-in attributes to ReplaceAttr like any other attribute, so a time attribute of a record at the
+// top level with the key "time" can't be told apart from the time of the record, and is replaced as well. The same
+// goes for a *slog.Source attribute with the key "source". Log such attributes in a group or with another key to keep
+// them.
+//
+// If next is not nil, it is called on every attribute before they are replaced, with the original values.
+func (o DeterministicOpts) ReplaceAttr(
+	next func(groups []string, attr slog.Attr) slog.Attr,
+) func(groups []string, attr slog.Attr) slog.Attr {
+	// Set the defaults
+	if o.Clock == nil {
+		o.Clock = FixedClock(time.Unix(0, 0).UTC())
+	}
+	if o.SourceRoot == "" {
+		o.SourceRoot, _ = os.Getwd()
+	}
+
+	return func(groups []string, attr slog.Attr) slog.Attr {
+		if next != nil {
+			attr = next(groups, attr)
+		}
+
+		// Only top level attributes with these keys are replaced, which includes the built-in ones along with any
+		// attributes of the record with the same keys
+		if len(groups) > 0 {
+			return attr
+		}
+
+		switch attr.Key {
+		case slog.TimeKey:
+			// Records without a time are left without one
+			if attr.Value.Kind() == slog.KindTime && !attr.Value.Time().IsZero() {
+				attr.Value = slog.TimeValue(o.Clock.Now())
+			}
+		case slog.SourceKey:
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				relative := *source
+				relative.File = relativeSourcePath(o.SourceRoot, source.File)
+				attr.Value = slog.AnyValue(&relative)
+			}
+		}
+		return attr
+	}
+}
+
+// relativeSourcePath returns the path of a source file relative to root, with forward slashes, or only the name of
+// the file if it is outside root.
+func relativeSourcePath(root, file string) string {
+	if root == "" {
+		return filepath.Base(file)
+	}
+
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(file)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,115 @@
+package loggy_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestDeterministicOpts_ReplaceAttr tests the function returned by DeterministicOpts.ReplaceAttr with a clock, which
+// should replace the time of every record, and with a source root, which the paths of source files should be made
+// relative to.
+func TestDeterministicOpts_ReplaceAttr(t *testing.T) {
+	// Create a logger that logs records a minute apart, with source paths relative to the parent directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := loggy.DeterministicOpts{
+		Clock: loggy.ClockFunc(
+			func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			},
+		),
+		SourceRoot: filepath.Dir(wd),
+	}
+	var outputStream strings.Builder
+	logger := slog.New(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{AddSource: true, ReplaceAttr: opts.ReplaceAttr(nil)}),
+	)
+
+	// Log two records, and an attribute with the time key in a group which shouldn't be replaced
+	logger.Info("first")
+	logger.Info("second", slog.Group("g", slog.Time("time", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))))
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	assert.Equal(t, "2024-01-01T00:01:00Z", logs[0]["time"])
+	assert.Equal(t, "2024-01-01T00:02:00Z", logs[1]["time"])
+	assert.Equal(t, map[string]any{"time": "2000-01-01T00:00:00Z"}, logs[1]["g"])
+	source := logs[0]["source"].(map[string]any)
+	assert.Equal(t, filepath.Base(wd)+"/deterministic_test.go", source["file"])
+	assert.Equal(t, "github.com/ksdfg/loggy_test.TestDeterministicOpts_ReplaceAttr", source["function"])
+}
+
+// TestDeterministicOpts_ReplaceAttr_Defaults tests the function returned by DeterministicOpts.ReplaceAttr with the
+// default options, along with another function which should be called first.
+func TestDeterministicOpts_ReplaceAttr_Defaults(t *testing.T) {
+	// Create a logger that logs at the Unix epoch, with source paths relative to the working directory
+	var outputStream strings.Builder
+	replaceAttr := loggy.DeterministicOpts{}.ReplaceAttr(
+		func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == "secret" {
+				return slog.String(attr.Key, "***")
+			}
+			return attr
+		},
+	)
+	logger := slog.New(slog.NewTextHandler(&outputStream, &slog.HandlerOptions{AddSource: true, ReplaceAttr: replaceAttr}))
+
+	// Log a record
+	logger.Info("test", "secret", "hunter2")
+
+	// Check the output
+	assert.Regexp(
+		t,
+		`^time=1970-01-01T00:00:00.000Z level=INFO source=deterministic_test.go:\d+ msg=test secret=\*\*\*\n$`,
+		outputStream.String(),
+	)
+}
+
+// TestDeterministicOpts_ReplaceAttr_OutsideRoot tests the function returned by DeterministicOpts.ReplaceAttr with a
+// source root that doesn't contain the source files, which should be logged with only their names.
+func TestDeterministicOpts_ReplaceAttr_OutsideRoot(t *testing.T) {
+	replaceAttr := loggy.DeterministicOpts{SourceRoot: t.TempDir()}.ReplaceAttr(nil)
+	attr := replaceAttr(nil, slog.Any(slog.SourceKey, &slog.Source{File: "/src/app/main.go", Line: 12}))
+	assert.Equal(t, &slog.Source{File: "main.go", Line: 12}, attr.Value.Any())
+}
+
+// TestNewConsoleLogHandler_Deterministic tests the handler returned by NewConsoleLogHandler with deterministic output,
+// which should have a fixed time, a relative source path and sorted attributes, along with a preset.
+func TestNewConsoleLogHandler_Deterministic(t *testing.T) {
+	// Capture the output of the console handler
+	output, err := captureConsoleOutput(
+		t, true, func() {
+			handler := loggy.NewConsoleLogHandler(
+				loggy.ConsoleLogWriterOpts{
+					Format:         loggy.ConsoleFormatLogfmt,
+					LogToStdout:    true,
+					Preset:         &loggy.DatadogPreset,
+					Deterministic:  &loggy.DeterministicOpts{Clock: loggy.FixedClock(time.Unix(1700000000, 0).UTC())},
+					HandlerOptions: slog.HandlerOptions{Level: slog.LevelDebug},
+				},
+			)
+			slog.New(handler).With("z", 1).Debug("test", "b", 2, "a", 3)
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	// Check the output
+	assert.Equal(t, "timestamp=2023-11-14T22:13:20Z status=debug message=test a=3 b=2 z=1\n", output)
+}
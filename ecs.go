@@ -0,0 +1,220 @@
+package loggy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ECSVersion is the version of the Elastic Common Schema that the ECSHandler follows.
+const ECSVersion = "8.11.0"
+
+// ECSHandlerOpts represents the options for configuring the behaviour of the `ECSHandler`.
+type ECSHandlerOpts struct {
+	// ServiceName is logged as the service.name field of every record, if it is set.
+	ServiceName string
+
+	// TraceExtractors are used in order to find the trace and span IDs of a record in the context it was logged with.
+	// By default, only W3CTraceExtractor is used.
+	TraceExtractors []TraceExtractor
+
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the time and source of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// ECSHandler is a handler that writes records as JSON objects following the Elastic Common Schema, one per line, so
+// that they can be shipped to Elasticsearch without any further processing.
+//
+// The time, level, message and source location of a record are written to their ECS fields, along with the version
+// of the schema. The first attribute holding an error is written as the ECS error object, with the message, type and
+// stack trace of the error. Groups are written as nested objects. Attributes with the keys of the fields written by
+// the handler, like "@timestamp", "log.level" or "message", are logged with an "attrs." prefix, so that they can't
+// overwrite the values written to those fields.
+type ECSHandler struct {
+	opts ECSHandlerOpts
+	mu   *sync.Mutex
+	w    io.Writer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the ECSHandler handles records at the given level.
+func (h *ECSHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as an ECS document and writes it on its own line.
+func (h *ECSHandler) Handle(ctx context.Context, record slog.Record) error {
+	document, err := json.Marshal(h.buildDocument(ctx, record))
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.w.Write(append(document, '\n'))
+	return err
+}
+
+// WithAttrs returns a new ECSHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *ECSHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &ECSHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new ECSHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *ECSHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &ECSHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// buildDocument creates the ECS document for a record.
+func (h *ECSHandler) buildDocument(ctx context.Context, record slog.Record) map[string]any {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+
+	document := map[string]any{
+		"log.level":   strings.ToLower(record.Level.String()),
+		"message":     record.Message,
+		"ecs.version": ECSVersion,
+	}
+	if h.opts.ServiceName != "" {
+		document["service.name"] = h.opts.ServiceName
+	}
+
+	// Add the time, unless it has been removed
+	if !record.Time.IsZero() {
+		if t, ok := replaceBuiltinTime(replace, record.Time); ok {
+			document["@timestamp"] = t
+		}
+	}
+
+	// Add the source location
+	if h.opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				document["log.origin"] = map[string]any{
+					"file":     map[string]any{"name": source.File, "line": source.Line},
+					"function": source.Function,
+				}
+			}
+		}
+	}
+
+	// Add the trace and span IDs from the context
+	if tc, ok := extractTrace(ctx, h.opts.TraceExtractors); ok {
+		document["trace.id"] = tc.TraceIDString()
+		document["span.id"] = tc.SpanIDString()
+	}
+
+	// Add the attributes, with the first error as the ECS error object
+	attrs, err := takeECSError(collectAttrs(h.goas, record, replace))
+	if err != nil {
+		document["error"] = ecsError(err)
+	}
+	for _, attr := range attrs {
+		if ecsReservedKey(attr.Key) {
+			document[reservedKeyPrefix+attr.Key] = valueToAny(attr.Value)
+			continue
+		}
+		document[attr.Key] = valueToAny(attr.Value)
+	}
+
+	return document
+}
+
+// ecsReservedKey checks whether a key is the key of one of the fields written by the ECSHandler, which attributes
+// must not overwrite. Since ECS consumers expand dotted keys into objects, keys in the same objects as these fields,
+// like "log.logger" or "error.code", are reserved as well.
+func ecsReservedKey(key string) bool {
+	switch key {
+	case "@timestamp", "message":
+		return true
+	}
+	switch strings.SplitN(key, ".", 2)[0] {
+	case "log", "service", "trace", "span", "ecs", "error":
+		return true
+	}
+	return false
+}
+
+// takeECSError finds the first attribute holding an error, including the ones in groups, and returns the attributes
+// without it along with the error. If there is none, the attributes are returned as they are.
+func takeECSError(attrs []slog.Attr) ([]slog.Attr, error) {
+	for i, attr := range attrs {
+		var err error
+		var rest []slog.Attr
+
+		switch attr.Value.Kind() {
+		case slog.KindAny:
+			// Nil pointers to errors aren't errors, and are logged as attributes
+			if !isNilPointer(attr.Value.Any()) {
+				err, _ = attr.Value.Any().(error)
+			}
+		case slog.KindGroup:
+			rest, err = takeECSError(attr.Value.Group())
+		}
+		if err == nil {
+			continue
+		}
+
+		// Remove the attribute, or replace the group with the one without the error
+		taken := make([]slog.Attr, 0, len(attrs))
+		taken = append(taken, attrs[:i]...)
+		if len(rest) > 0 {
+			taken = append(taken, slog.Attr{Key: attr.Key, Value: slog.GroupValue(rest...)})
+		}
+		return append(taken, attrs[i+1:]...), err
+	}
+
+	return attrs, nil
+}
+
+// ecsError converts an error into the fields of the ECS error object. The stack trace is taken from the "%+v"
+// formatting of the error, which errors that record stack traces (like the ones created by github.com/pkg/errors)
+// use to print them. Nil pointers to errors are written as "<nil>", since their methods usually can't be called on
+// them.
+func ecsError(err error) map[string]any {
+	if isNilPointer(err) {
+		return map[string]any{"message": "<nil>", "type": fmt.Sprintf("%T", err)}
+	}
+
+	fields := map[string]any{
+		"message": err.Error(),
+		"type":    fmt.Sprintf("%T", err),
+	}
+	if detailed := fmt.Sprintf("%+v", err); detailed != err.Error() {
+		fields["stack_trace"] = detailed
+	}
+	return fields
+}
+
+// NewECSHandler returns an ECSHandler that writes records to w as ECS documents.
+func NewECSHandler(w io.Writer, options ...ECSHandlerOpts) *ECSHandler {
+	// If options are provided, assign the first option to opts
+	var opts ECSHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if len(opts.TraceExtractors) == 0 {
+		opts.TraceExtractors = []TraceExtractor{W3CTraceExtractor}
+	}
+
+	return &ECSHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
@@ -0,0 +1,204 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// stackError is an error that prints a stack trace when formatted with "%+v".
+type stackError struct {
+	message string
+}
+
+// Error returns the message of the error.
+func (e stackError) Error() string {
+	return e.message
+}
+
+// Format prints the message of the error, followed by a stack trace if the "+" flag is set.
+func (e stackError) Format(s fmt.State, verb rune) {
+	_, _ = fmt.Fprint(s, e.message)
+	if verb == 'v' && s.Flag('+') {
+		_, _ = fmt.Fprint(s, "\nmain.main\n\t/app/main.go:10")
+	}
+}
+
+// TestNewECSHandler tests the ECSHandler returned by NewECSHandler with a record that has an error, groups and the
+// source location, which should be written to their ECS fields.
+func TestNewECSHandler(t *testing.T) {
+	// Create a logger that writes ECS documents to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewECSHandler(
+		&outputStream,
+		loggy.ECSHandlerOpts{
+			ServiceName:    "api",
+			HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: removeTime},
+		},
+	)
+	logger := slog.New(handler).WithGroup("http")
+
+	// Log a record with an error and a nested group
+	ctx, err := loggy.ContextWithTraceparent(
+		context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.ErrorContext(
+		ctx, "this is a test log",
+		"err", stackError{message: "connection reset"},
+		slog.Group("request", "method", "GET"),
+	)
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	document := logs[0]
+	assert.Equal(t, "error", document["log.level"])
+	assert.Equal(t, "this is a test log", document["message"])
+	assert.Equal(t, loggy.ECSVersion, document["ecs.version"])
+	assert.Equal(t, "api", document["service.name"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", document["trace.id"])
+	assert.Equal(t, "00f067aa0ba902b7", document["span.id"])
+	assert.NotContains(t, document, "@timestamp")
+	assert.Equal(t, map[string]any{"request": map[string]any{"method": "GET"}}, document["http"])
+	assert.Equal(
+		t,
+		map[string]any{
+			"message":     "connection reset",
+			"type":        "loggy_test.stackError",
+			"stack_trace": "connection reset\nmain.main\n\t/app/main.go:10",
+		},
+		document["error"],
+	)
+
+	origin := document["log.origin"].(map[string]any)
+	assert.Equal(t, "github.com/ksdfg/loggy_test.TestNewECSHandler", origin["function"])
+	assert.True(t, strings.HasSuffix(origin["file"].(map[string]any)["name"].(string), "ecs_test.go"))
+	assert.NotZero(t, origin["file"].(map[string]any)["line"])
+}
+
+// TestNewECSHandler_Errors tests the ECSHandler returned by NewECSHandler with a record that has two errors, of which
+// only the first one should be written as the ECS error object.
+func TestNewECSHandler_Errors(t *testing.T) {
+	// Create a logger that writes ECS documents to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewECSHandler(&outputStream))
+
+	// Log a record with two errors
+	logger.Warn("this is a test log", "error", fs.ErrNotExist, "cause", errors.New("disk unmounted"))
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	assert.Equal(t, "warn", logs[0]["log.level"])
+	assert.Contains(t, logs[0], "@timestamp")
+	assert.Equal(t, map[string]any{"message": "file does not exist", "type": "*errors.errorString"}, logs[0]["error"])
+	assert.Equal(t, "disk unmounted", logs[0]["cause"])
+}
+
+// TestNewECSHandler_ReservedKeys tests the ECSHandler returned by NewECSHandler with attributes that have the keys of
+// the fields written by the handler, which should be logged with a prefix instead of overwriting them.
+func TestNewECSHandler_ReservedKeys(t *testing.T) {
+	// Create a logger that writes ECS documents to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewECSHandler(&outputStream))
+
+	// Log a record with attributes named after the fields of the handler
+	logger.Error(
+		"this is a test log",
+		"@timestamp", "yesterday",
+		"log.level", "debug",
+		"message", "overwritten",
+		"error", "not an error",
+		"error.code", 42,
+		"log.logger", "custom",
+		slog.Group("service", "version", "1.0"),
+	)
+
+	// Check that the fields were kept, and the attributes were logged with a prefix
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	document := logs[0]
+	assert.Equal(t, "error", document["log.level"])
+	assert.Equal(t, "this is a test log", document["message"])
+	assert.NotEqual(t, "yesterday", document["@timestamp"])
+	assert.NotContains(t, document, "error")
+	assert.Equal(t, "yesterday", document["attrs.@timestamp"])
+	assert.Equal(t, "debug", document["attrs.log.level"])
+	assert.Equal(t, "overwritten", document["attrs.message"])
+	assert.Equal(t, "not an error", document["attrs.error"])
+	assert.Equal(t, float64(42), document["attrs.error.code"])
+	assert.Equal(t, "custom", document["attrs.log.logger"])
+	assert.Equal(t, map[string]any{"version": "1.0"}, document["attrs.service"])
+	assert.NotContains(t, document, "error.code")
+	assert.NotContains(t, document, "log.logger")
+	assert.NotContains(t, document, "service")
+}
+
+// TestNewECSHandler_Values tests the ECSHandler returned by NewECSHandler with non-finite floats and a nil pointer to
+// an error, which should be logged as strings instead of dropping the record or panicking.
+func TestNewECSHandler_Values(t *testing.T) {
+	// Create a logger that writes ECS documents to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewECSHandler(&outputStream))
+
+	// Log a record with non-finite floats and a nil pointer to an error
+	logger.Error("this is a test log", "nan", math.NaN(), "inf", math.Inf(-1), "err", (*pointerError)(nil))
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	assert.Equal(t, "NaN", logs[0]["nan"])
+	assert.Equal(t, "-Inf", logs[0]["inf"])
+	assert.Equal(t, "<nil>", logs[0]["err"])
+	assert.NotContains(t, logs[0], "error")
+}
+
+// TestNewConsoleLogHandler_ECS tests the NewConsoleLogHandler function with the ECS format, which should colourise
+// the output according to the level.
+func TestNewConsoleLogHandler_ECS(t *testing.T) {
+	// Capture the console output
+	output, err := captureConsoleOutput(
+		t, true, func() {
+			// Initialize the logger with the ECS format
+			opts := loggy.ConsoleLogWriterOpts{LogToStdout: true, Format: loggy.ConsoleFormatECS}
+			initializeLogger(opts)
+
+			// Log a warning message
+			slog.Warn("this is a test log")
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Define the expected output
+	expectedOutput := color.New(color.FgYellow).Sprintf(
+		"{\"ecs.version\":\"%s\",\"log.level\":\"warn\",\"message\":\"this is a test log\"}\n", loggy.ECSVersion,
+	)
+
+	// Assert that the output matches the expected output
+	assert.Equal(t, expectedOutput, output)
+}
@@ -3,16 +3,28 @@ package loggy_test
 import (
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/ksdfg/loggy"
 )
 
 func ExampleNewCombinedHandler() {
+	// Log every record at the same time and with relative source paths, so that the output is the same on every run
+	replaceAttr := loggy.DeterministicOpts{}.ReplaceAttr(nil)
+
 	// Create handlers for different log levels
-	debugTextLogHandler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
-	infoJSONLogHandler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})
-	warnTextLogHandler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn, AddSource: true})
-	errorJSONLogHandler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError, AddSource: true})
+	debugTextLogHandler := slog.NewTextHandler(
+		os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replaceAttr},
+	)
+	infoJSONLogHandler := slog.NewJSONHandler(
+		os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo, ReplaceAttr: replaceAttr},
+	)
+	warnTextLogHandler := slog.NewTextHandler(
+		os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn, AddSource: true, ReplaceAttr: replaceAttr},
+	)
+	errorJSONLogHandler := slog.NewJSONHandler(
+		os.Stdout, &slog.HandlerOptions{Level: slog.LevelError, AddSource: true, ReplaceAttr: replaceAttr},
+	)
 
 	// Add attributes to each handler so that we know which logs came from which handler
 	debugTextLogHandlerWithAttr := debugTextLogHandler.WithAttrs(
@@ -36,55 +48,80 @@ func ExampleNewCombinedHandler() {
 		errorJSONLogHandlerWithAttr,
 	)
 
-	// Create a new logger with the combined handler, and set it as the default
+	// Create a new logger with the combined handler
 	logger := slog.New(combinedHandler)
-	slog.SetDefault(logger)
 
 	// Log a debug message
-	slog.Debug("this is a debug log")
+	logger.Debug("this is a debug log")
 	// Log an info message
-	slog.Info("this is an info log")
+	logger.Info("this is an info log")
 	// Log a warning message
-	slog.Warn("this is a warning log")
+	logger.Warn("this is a warning log")
 	// Log an error message
-	slog.Error("this is an error log")
+	logger.Error("this is an error log")
 	// Output:
-	// time=2023-09-17T20:01:50.364+05:30 level=DEBUG msg="this is a debug log" logger=debugTextLogHandler
-	// time=2023-09-17T20:01:50.364+05:30 level=INFO msg="this is an info log" logger=debugTextLogHandler
-	// {"time":"2023-09-17T20:01:50.364653675+05:30","level":"INFO","msg":"this is an info log","logger":"infoJSONLogHandler"}
-	// time=2023-09-17T20:01:50.364+05:30 level=WARN msg="this is a warning log" logger=debugTextLogHandler
-	// {"time":"2023-09-17T20:01:50.364658189+05:30","level":"WARN","msg":"this is a warning log","logger":"infoJSONLogHandler"}
-	// time=2023-09-17T20:01:50.364+05:30 level=WARN source=/home/ksdfg/code/loggy/combined_handler_test.go:56 msg="this is a warning log" logger=warnTextLogHandler
-	// time=2023-09-17T20:01:50.364+05:30 level=ERROR msg="this is an error log" logger=debugTextLogHandler
-	// {"time":"2023-09-17T20:01:50.36466392+05:30","level":"ERROR","msg":"this is an error log","logger":"infoJSONLogHandler"}
-	// time=2023-09-17T20:01:50.364+05:30 level=ERROR source=/home/ksdfg/code/loggy/combined_handler_test.go:58 msg="this is an error log" logger=warnTextLogHandler
-	// {"time":"2023-09-17T20:01:50.36466392+05:30","level":"ERROR","source":{"function":"github.com/ksdfg/loggy_test.TestNewCombinedHandler","file":"/home/ksdfg/code/loggy/combined_handler_test.go","line":58},"msg":"this is an error log","logger":"errorJSONLogHandler"}
+	// time=1970-01-01T00:00:00.000Z level=DEBUG msg="this is a debug log" logger=debugTextLogHandler
+	// time=1970-01-01T00:00:00.000Z level=INFO msg="this is an info log" logger=debugTextLogHandler
+	// {"time":"1970-01-01T00:00:00Z","level":"INFO","msg":"this is an info log","logger":"infoJSONLogHandler"}
+	// time=1970-01-01T00:00:00.000Z level=WARN msg="this is a warning log" logger=debugTextLogHandler
+	// {"time":"1970-01-01T00:00:00Z","level":"WARN","msg":"this is a warning log","logger":"infoJSONLogHandler"}
+	// time=1970-01-01T00:00:00.000Z level=WARN source=example_test.go:59 msg="this is a warning log" logger=warnTextLogHandler
+	// time=1970-01-01T00:00:00.000Z level=ERROR msg="this is an error log" logger=debugTextLogHandler
+	// {"time":"1970-01-01T00:00:00Z","level":"ERROR","msg":"this is an error log","logger":"infoJSONLogHandler"}
+	// time=1970-01-01T00:00:00.000Z level=ERROR source=example_test.go:61 msg="this is an error log" logger=warnTextLogHandler
+	// {"time":"1970-01-01T00:00:00Z","level":"ERROR","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewCombinedHandler","file":"example_test.go","line":61},"msg":"this is an error log","logger":"errorJSONLogHandler"}
 }
 
 func ExampleNewConsoleLogHandler() {
-	// Create a new slog.Handler that writes JSON text logs with source info to stderr
+	// Create a new slog.Handler that writes JSON text logs with source info to stdout, with the same time, relative
+	// source paths and sorted attributes on every run
 	opts := loggy.ConsoleLogWriterOpts{
 		JSON:           true,
 		LogToStdout:    true,
+		Deterministic:  &loggy.DeterministicOpts{},
 		HandlerOptions: slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug},
 	}
 	handler := loggy.NewConsoleLogHandler(opts)
 
-	// Create a new logger with the above handler, and set it as the default
+	// Create a new logger with the above handler
 	logger := slog.New(handler)
-	slog.SetDefault(logger)
 
 	// Log a debug message
-	slog.Debug("this is a debug log")
-	// Log an info message
-	slog.Info("this is an info log")
+	logger.Debug("this is a debug log")
+	// Log an info message, with attributes that are written in order of their keys
+	logger.Info("this is an info log", "user", "ada", "attempt", 2)
 	// Log a warning message
-	slog.Warn("this is a warning log")
+	logger.Warn("this is a warning log")
 	// Log an error message
-	slog.Error("this is an error log")
+	logger.Error("this is an error log")
+	// Output:
+	// {"time":"1970-01-01T00:00:00Z","level":"DEBUG","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewConsoleLogHandler","file":"example_test.go","line":90},"msg":"this is a debug log"}
+	// {"time":"1970-01-01T00:00:00Z","level":"INFO","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewConsoleLogHandler","file":"example_test.go","line":92},"msg":"this is an info log","attempt":2,"user":"ada"}
+	// {"time":"1970-01-01T00:00:00Z","level":"WARN","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewConsoleLogHandler","file":"example_test.go","line":94},"msg":"this is a warning log"}
+	// {"time":"1970-01-01T00:00:00Z","level":"ERROR","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewConsoleLogHandler","file":"example_test.go","line":96},"msg":"this is an error log"}
+}
+
+func ExampleDeterministicOpts() {
+	// Create a JSON handler that logs every record a second after the previous one, and sorts their attributes
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	deterministic := loggy.DeterministicOpts{
+		Clock: loggy.ClockFunc(
+			func() time.Time {
+				now = now.Add(time.Second)
+				return now
+			},
+		),
+	}
+	handler := loggy.NewTransformHandler(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: deterministic.ReplaceAttr(nil)}),
+		loggy.SortAttrs(),
+	)
+	logger := slog.New(handler)
+
+	// Log records with attributes in different orders
+	logger.Info("first", "b", 1, "a", 2)
+	logger.With("c", 3).Info("second", slog.Group("g", "z", true, "y", false))
 	// Output:
-	// {"time":"2023-09-17T17:44:01.603539649+05:30","level":"DEBUG","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewStderrLogHandler","file":"/home/ksdfg/code/loggy/example_test.go","line":63},"msg":"this is a debug log"}
-	// {"time":"2023-09-17T17:44:01.60354488+05:30","level":"INFO","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewStderrLogHandler","file":"/home/ksdfg/code/loggy/example_test.go","line":65},"msg":"this is an info log"}
-	// {"time":"2023-09-17T17:44:01.603548573+05:30","level":"WARN","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewStderrLogHandler","file":"/home/ksdfg/code/loggy/example_test.go","line":67},"msg":"this is a warning log"}
-	// {"time":"2023-09-17T17:44:01.603551182+05:30","level":"ERROR","source":{"function":"github.com/ksdfg/loggy_test.ExampleNewStderrLogHandler","file":"/home/ksdfg/code/loggy/example_test.go","line":69},"msg":"this is an error log"}
+	// {"time":"2024-01-01T00:00:01Z","level":"INFO","msg":"first","a":2,"b":1}
+	// {"time":"2024-01-01T00:00:02Z","level":"INFO","msg":"second","c":3,"g":{"y":false,"z":true}}
 }
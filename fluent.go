@@ -0,0 +1,483 @@
+package loggy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// fluentDefaultTag is the tag used for records when no tag has been configured.
+	fluentDefaultTag = "loggy"
+
+	// fluentDefaultBatchSize is the default maximum number of records sent in a single forward message.
+	fluentDefaultBatchSize = 100
+
+	// fluentDefaultFlushInterval is the default interval at which buffered records are sent.
+	fluentDefaultFlushInterval = time.Second
+
+	// fluentDefaultAckTimeout is the default time to wait for an acknowledgement of a forward message.
+	fluentDefaultAckTimeout = 10 * time.Second
+
+	// fluentDefaultWriteTimeout is the default time to wait for a forward message to be written to the connection.
+	fluentDefaultWriteTimeout = 10 * time.Second
+
+	// fluentDefaultBufferLimit is the default maximum number of records buffered while they can't be sent.
+	fluentDefaultBufferLimit = 8192
+
+	// fluentExtEventTime is the MessagePack extension type that the forward protocol uses for event times.
+	fluentExtEventTime = 0
+)
+
+// FluentHandlerOpts represents the options for configuring the behaviour of the `FluentHandler`.
+type FluentHandlerOpts struct {
+	// Network is the network used to connect to fluentd or fluent-bit, either "tcp" or "unix". By default, records are
+	// sent over TCP.
+	Network string
+
+	// Address is the address of the forward input, e.g. "localhost:24224", or the path of its unix socket.
+	Address string
+
+	// Tag is the tag records are sent with. By default, it is "loggy".
+	Tag string
+
+	// TagKey is the key of a top level attribute whose value is used as the tag of a record instead of Tag. The
+	// attribute is removed from the record when it is used as the tag.
+	TagKey string
+
+	// BatchSize is the maximum number of records sent in a single forward message. Records are sent as soon as a
+	// batch is full. By default, it is 100.
+	BatchSize int
+
+	// FlushInterval is the interval at which buffered records are sent, even if their batch isn't full. By default, it
+	// is one second.
+	FlushInterval time.Duration
+
+	// RequireAck specifies whether every forward message must be acknowledged by the server, using the chunk option
+	// of the forward protocol. Messages that aren't acknowledged in time are sent again.
+	RequireAck bool
+
+	// AckTimeout is the time to wait for an acknowledgement. By default, it is ten seconds.
+	AckTimeout time.Duration
+
+	// WriteTimeout is the time to wait for a forward message to be written, so that a server that stops reading can't
+	// block sending, and closing the handler, forever. By default, it is ten seconds.
+	WriteTimeout time.Duration
+
+	// BufferLimit is the maximum number of records buffered while they can't be sent, e.g. while the server is
+	// restarting. When the buffer is full, the oldest records are dropped. By default, it is 8192.
+	BufferLimit int
+
+	// HandlerOptions contains additional options for the handler.
+	HandlerOptions slog.HandlerOptions
+}
+
+// fluentEntry is a record that has been encoded into a forward protocol entry and is waiting to be sent.
+type fluentEntry struct {
+	tag  string
+	data []byte
+}
+
+// fluentClient buffers entries and sends them to the server. It is shared between a FluentHandler and all the handlers
+// derived from it.
+type fluentClient struct {
+	opts FluentHandlerOpts
+
+	// mu guards the buffered entries, and whether the client has been closed
+	mu      sync.Mutex
+	entries []fluentEntry
+	closed  bool
+
+	// sendMu guards the connection and the reader of its acknowledgements, so that only one batch is sent at a time
+	sendMu sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+
+	flush     chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// FluentHandler is a handler that sends records to fluentd or fluent-bit using the forward mode of the Fluentd Forward
+// protocol.
+//
+// Records are buffered and sent in batches by a background goroutine, so Handle never waits for the network. If the
+// server can't be reached, records are kept in the buffer and the connection is dialled again on the next flush.
+type FluentHandler struct {
+	client *fluentClient
+	goas   []groupOrAttrs
+}
+
+// Enabled reports whether the FluentHandler handles records at the given level.
+func (h *FluentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.client.opts.HandlerOptions.Level != nil {
+		minLevel = h.client.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as a forward protocol entry and adds it to the buffer. If the batch of its tag is full, the
+// background goroutine is woken up to send it. If the handler has been closed, the record is dropped and
+// ErrHandlerClosed is returned.
+func (h *FluentHandler) Handle(_ context.Context, record slog.Record) error {
+	tag, data := h.encodeEntry(record)
+	return h.client.add(fluentEntry{tag: tag, data: data})
+}
+
+// WithAttrs returns a new FluentHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *FluentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &FluentHandler{client: h.client, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new FluentHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *FluentHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &FluentHandler{client: h.client, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// Flush sends all the buffered records, returning an error if any of them could not be sent. Records that could not be
+// sent are kept in the buffer.
+func (h *FluentHandler) Flush() error {
+	return h.client.flushEntries()
+}
+
+// Close stops the background goroutine, sends the buffered records and closes the connection. It is shared by all the
+// handlers derived from this one, so none of them can be used after it is closed.
+func (h *FluentHandler) Close() error {
+	var err error
+	h.client.closeOnce.Do(
+		func() {
+			h.client.mu.Lock()
+			h.client.closed = true
+			h.client.mu.Unlock()
+
+			close(h.client.done)
+			<-h.client.stopped
+
+			err = h.client.flushEntries()
+
+			h.client.sendMu.Lock()
+			defer h.client.sendMu.Unlock()
+			if h.client.conn != nil {
+				err = errors.Join(err, h.client.conn.Close())
+				h.client.conn = nil
+				h.client.reader = nil
+			}
+		},
+	)
+	return err
+}
+
+// encodeEntry encodes a record into a forward protocol entry - an array of its event time and its attributes - and
+// returns it along with the tag it should be sent with.
+func (h *FluentHandler) encodeEntry(record slog.Record) (string, []byte) {
+	opts := h.client.opts
+	replace := opts.HandlerOptions.ReplaceAttr
+
+	// Pick out the tag from the attributes, if configured
+	attrs := collectAttrs(h.goas, record, replace)
+	tag := opts.Tag
+	if opts.TagKey != "" {
+		for i, attr := range attrs {
+			if attr.Key == opts.TagKey && attr.Value.Kind() != slog.KindGroup {
+				tag = attr.Value.String()
+				attrs = append(attrs[:i:i], attrs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// Collect the built-in attributes that haven't been removed
+	builtins := make([]slog.Attr, 0, 3)
+	if attr := replaceBuiltin(replace, slog.Any(slog.LevelKey, record.Level)); attr.Key != "" {
+		builtins = append(builtins, attr)
+	}
+	if attr := replaceBuiltin(replace, slog.String(slog.MessageKey, record.Message)); attr.Key != "" {
+		builtins = append(builtins, attr)
+	}
+	if opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				attr.Value = slog.GroupValue(
+					slog.String("function", source.Function),
+					slog.String("file", source.File),
+					slog.Int("line", source.Line),
+				)
+			}
+			if attr.Key != "" {
+				builtins = append(builtins, attr)
+			}
+		}
+	}
+
+	// Use the current time if the time of the record has been removed
+	eventTime := record.Time
+	if t, ok := replaceBuiltinTime(replace, record.Time); ok {
+		eventTime = t
+	}
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+
+	// Encode the entry
+	data := appendMsgpackArrayHeader(nil, 2)
+	data = appendFluentEventTime(data, eventTime)
+	data = appendMsgpackAttrs(data, append(builtins, attrs...), appendMsgpackRFC3339Time)
+
+	return tag, data
+}
+
+// add adds an entry to the buffer, dropping the oldest entry if the buffer is full, and wakes up the background
+// goroutine if a batch is ready to be sent. Entries added after the client has been closed are dropped.
+func (c *fluentClient) add(entry fluentEntry) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrHandlerClosed
+	}
+	if len(c.entries) >= c.opts.BufferLimit {
+		c.entries = c.entries[1:]
+	}
+	c.entries = append(c.entries, entry)
+	full := len(c.entries) >= c.opts.BatchSize
+	c.mu.Unlock()
+
+	if full {
+		select {
+		case c.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run sends the buffered entries every flush interval, or as soon as a batch is full, until the client is closed.
+func (c *fluentClient) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		case <-c.flush:
+		}
+
+		// Errors are retried on the next flush, as there is nowhere to report them
+		_ = c.flushEntries()
+	}
+}
+
+// flushEntries sends all the buffered entries in batches of entries with the same tag. If a batch can't be sent, it is
+// put back at the front of the buffer along with all the entries after it.
+func (c *fluentClient) flushEntries() error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	// Take all the buffered entries
+	c.mu.Lock()
+	entries := c.entries
+	c.entries = nil
+	c.mu.Unlock()
+
+	for len(entries) > 0 {
+		// Take the longest run of entries with the same tag that fits in a batch
+		size := 1
+		for size < len(entries) && size < c.opts.BatchSize && entries[size].tag == entries[0].tag {
+			size++
+		}
+
+		// Put the unsent entries back in the buffer if the batch can't be sent
+		if err := c.send(entries[:size]); err != nil {
+			c.requeue(entries)
+			return err
+		}
+		entries = entries[size:]
+	}
+
+	return nil
+}
+
+// requeue puts entries that could not be sent back at the front of the buffer, dropping the oldest ones if the buffer
+// limit is exceeded.
+func (c *fluentClient) requeue(entries []fluentEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(entries[:len(entries):len(entries)], c.entries...)
+	if overflow := len(c.entries) - c.opts.BufferLimit; overflow > 0 {
+		c.entries = c.entries[overflow:]
+	}
+}
+
+// send sends a batch of entries with the same tag as a single forward message, and waits for it to be acknowledged if
+// required. The connection is dialled first if needed, and closed if anything goes wrong.
+func (c *fluentClient) send(entries []fluentEntry) error {
+	// Dial the connection if it isn't open
+	if c.conn == nil {
+		conn, err := net.Dial(c.opts.Network, c.opts.Address)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+	}
+
+	// Encode the message
+	message, chunk, err := encodeFluentMessage(entries, c.opts.RequireAck)
+	if err != nil {
+		return err
+	}
+
+	// Send it, and wait for the acknowledgement if needed
+	err = c.write(message, chunk)
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+	}
+	return err
+}
+
+// write writes a message to the connection and, if chunk is not empty, reads the acknowledgement for it with the reader
+// of the connection, which keeps any bytes it has buffered for the next acknowledgement.
+func (c *fluentClient) write(message []byte, chunk string) error {
+	// Write the message, giving up if the server doesn't read it in time
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	// Read the response, which should be a map with the chunk ID as the value of "ack"
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.opts.AckTimeout)); err != nil {
+		return err
+	}
+	response, err := decodeMsgpack(c.reader)
+	if err != nil {
+		return fmt.Errorf("loggy: reading fluent ack: %w", err)
+	}
+	if responseMap, ok := response.(map[string]any); !ok || responseMap["ack"] != chunk {
+		return fmt.Errorf("loggy: unexpected fluent ack %v for chunk %s", response, chunk)
+	}
+
+	return nil
+}
+
+// encodeFluentMessage encodes entries with the same tag into a forward mode message. If requireAck is true, a random
+// chunk ID is added to the options of the message and returned, so that the acknowledgement can be verified.
+func encodeFluentMessage(entries []fluentEntry, requireAck bool) ([]byte, string, error) {
+	// Generate the chunk ID
+	var chunk string
+	if requireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, "", err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	// Encode the tag and the entries
+	message := appendMsgpackArrayHeader(nil, 3)
+	message = appendMsgpackString(message, entries[0].tag)
+	message = appendMsgpackArrayHeader(message, len(entries))
+	for _, entry := range entries {
+		message = append(message, entry.data...)
+	}
+
+	// Encode the options
+	if chunk == "" {
+		message = appendMsgpackMapHeader(message, 1)
+	} else {
+		message = appendMsgpackMapHeader(message, 2)
+		message = appendMsgpackString(message, "chunk")
+		message = appendMsgpackString(message, chunk)
+	}
+	message = appendMsgpackString(message, "size")
+	message = appendMsgpackInt(message, int64(len(entries)))
+
+	return message, chunk, nil
+}
+
+// appendFluentEventTime appends a time to b as the EventTime extension of the forward protocol, which holds the
+// seconds and nanoseconds as big-endian 32-bit integers.
+func appendFluentEventTime(b []byte, t time.Time) []byte {
+	data := make([]byte, 0, 8)
+	data = binary.BigEndian.AppendUint32(data, uint32(t.Unix()))
+	data = binary.BigEndian.AppendUint32(data, uint32(t.Nanosecond()))
+	return appendMsgpackExt(b, fluentExtEventTime, data)
+}
+
+// NewFluentHandler returns a FluentHandler that sends records to the forward input at the configured address.
+//
+// The connection is dialled lazily, so the server doesn't need to be up when the handler is created. The handler
+// must be closed to send the records that are still buffered.
+func NewFluentHandler(opts FluentHandlerOpts) (*FluentHandler, error) {
+	// Validate the options
+	switch opts.Network {
+	case "":
+		opts.Network = "tcp"
+	case "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("loggy: unsupported fluent network %q", opts.Network)
+	}
+	if opts.Address == "" {
+		return nil, errors.New("loggy: fluent address is required")
+	}
+
+	// Set the defaults
+	if opts.Tag == "" {
+		opts.Tag = fluentDefaultTag
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = fluentDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = fluentDefaultFlushInterval
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = fluentDefaultAckTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = fluentDefaultWriteTimeout
+	}
+	if opts.BufferLimit <= 0 {
+		opts.BufferLimit = fluentDefaultBufferLimit
+	}
+
+	// Start sending records in the background
+	client := &fluentClient{
+		opts:    opts,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go client.run()
+
+	return &FluentHandler{client: client}, nil
+}
@@ -0,0 +1,340 @@
+package loggy_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/ksdfg/loggy"
+)
+
+// fluentEventTime decodes the EventTime extension of the forward protocol.
+type fluentEventTime struct {
+	time.Time
+}
+
+// MarshalMsgpack encodes the time as the seconds and nanoseconds since the epoch.
+func (t *fluentEventTime) MarshalMsgpack() ([]byte, error) {
+	data := binary.BigEndian.AppendUint32(nil, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(data, uint32(t.Nanosecond())), nil
+}
+
+// UnmarshalMsgpack decodes the seconds and nanoseconds since the epoch.
+func (t *fluentEventTime) UnmarshalMsgpack(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("invalid event time")
+	}
+	t.Time = time.Unix(int64(binary.BigEndian.Uint32(data[:4])), int64(binary.BigEndian.Uint32(data[4:])))
+	return nil
+}
+
+func init() {
+	msgpack.RegisterExt(0, (*fluentEventTime)(nil))
+}
+
+// fluentMessage is a decoded forward mode message.
+type fluentMessage struct {
+	tag     string
+	entries []fluentMessageEntry
+	options map[string]any
+}
+
+// fluentMessageEntry is a single decoded entry of a forward mode message.
+type fluentMessageEntry struct {
+	time   time.Time
+	record map[string]any
+}
+
+// serveFluent accepts a single connection on the listener, decodes count forward mode messages from it and sends
+// them to the returned channel. If ack is true, every message is acknowledged with its chunk ID.
+func serveFluent(t *testing.T, listener net.Listener, count int, ack bool) <-chan fluentMessage {
+	messages := make(chan fluentMessage, count)
+
+	go func() {
+		defer close(messages)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		decoder := msgpack.NewDecoder(conn)
+		decoder.UseLooseInterfaceDecoding(true)
+		for i := 0; i < count; i++ {
+			// Decode the message into its parts
+			var raw []any
+			if err := decoder.Decode(&raw); err != nil {
+				t.Error(err)
+				return
+			}
+			if len(raw) != 3 {
+				t.Errorf("forward message has %d elements", len(raw))
+				return
+			}
+
+			message := fluentMessage{tag: raw[0].(string), options: raw[2].(map[string]any)}
+			for _, rawEntry := range raw[1].([]any) {
+				entry := rawEntry.([]any)
+				message.entries = append(
+					message.entries,
+					fluentMessageEntry{time: entry[0].(*fluentEventTime).Time, record: entry[1].(map[string]any)},
+				)
+			}
+
+			// Acknowledge the message if needed
+			if ack {
+				response, err := msgpack.Marshal(map[string]any{"ack": message.options["chunk"]})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := conn.Write(response); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+
+			messages <- message
+		}
+	}()
+
+	return messages
+}
+
+// receiveFluent waits for a message from the fake server.
+func receiveFluent(t *testing.T, messages <-chan fluentMessage) fluentMessage {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a forward message")
+		return fluentMessage{}
+	}
+}
+
+// TestNewFluentHandler_Forward tests the FluentHandler returned by NewFluentHandler with a batch of records sent in a
+// single forward mode message.
+func TestNewFluentHandler_Forward(t *testing.T) {
+	// Start a fake fluent-bit forward input
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	messages := serveFluent(t, listener, 1, false)
+
+	// Create a logger that sends batches of two records
+	handler, err := loggy.NewFluentHandler(
+		loggy.FluentHandlerOpts{Address: listener.Addr().String(), Tag: "app.test", BatchSize: 2},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	// Log two records, which fill up a batch
+	before := time.Now()
+	logger.Info("first log", "count", 1)
+	logger.WithGroup("request").Warn("second log", "method", "GET")
+
+	// Check the message that was received
+	message := receiveFluent(t, messages)
+	assert.Equal(t, "app.test", message.tag)
+	assert.Equal(t, int64(2), message.options["size"])
+	if !assert.Len(t, message.entries, 2) {
+		return
+	}
+	assert.False(t, message.entries[0].time.Before(before.Truncate(time.Second)))
+	assert.Equal(t, map[string]any{"level": "INFO", "msg": "first log", "count": int64(1)}, message.entries[0].record)
+	assert.Equal(
+		t,
+		map[string]any{"level": "WARN", "msg": "second log", "request": map[string]any{"method": "GET"}},
+		message.entries[1].record,
+	)
+}
+
+// TestNewFluentHandler_TagKey tests the FluentHandler returned by NewFluentHandler with the tag of records taken from
+// one of their attributes.
+func TestNewFluentHandler_TagKey(t *testing.T) {
+	// Start a fake fluent-bit forward input
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	messages := serveFluent(t, listener, 2, false)
+
+	// Create a logger that takes tags from the "component" attribute
+	handler, err := loggy.NewFluentHandler(
+		loggy.FluentHandlerOpts{Address: listener.Addr().String(), Tag: "default", TagKey: "component"},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	logger := slog.New(handler)
+
+	// Log a record with and without the tag attribute, and send them
+	logger.Info("tagged log", "component", "db")
+	logger.Info("untagged log")
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that they were sent in separate messages with the right tags, and the tag attribute was removed
+	tagged := receiveFluent(t, messages)
+	assert.Equal(t, "db", tagged.tag)
+	assert.Equal(t, map[string]any{"level": "INFO", "msg": "tagged log"}, tagged.entries[0].record)
+	untagged := receiveFluent(t, messages)
+	assert.Equal(t, "default", untagged.tag)
+}
+
+// TestNewFluentHandler_Ack tests the FluentHandler returned by NewFluentHandler with acknowledgements required for
+// every message, which should be read from the same connection one after the other.
+func TestNewFluentHandler_Ack(t *testing.T) {
+	// Start a fake fluent-bit forward input that acknowledges messages
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	messages := serveFluent(t, listener, 2, true)
+
+	// Create a logger that requires acknowledgements
+	handler, err := loggy.NewFluentHandler(
+		loggy.FluentHandlerOpts{Address: listener.Addr().String(), RequireAck: true, AckTimeout: 5 * time.Second},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+
+	// Log two records and send them in separate messages
+	for _, msg := range []string{"first log", "second log"} {
+		slog.New(handler).Error(msg)
+		assert.NoError(t, handler.Flush())
+
+		// Check that the message was acknowledged and had a chunk ID
+		message := receiveFluent(t, messages)
+		assert.NotEmpty(t, message.options["chunk"])
+		assert.Equal(t, "loggy", message.tag)
+		if assert.Len(t, message.entries, 1) {
+			assert.Equal(t, msg, message.entries[0].record["msg"])
+		}
+	}
+}
+
+// TestFluentHandler_Close tests the Close method of the FluentHandler returned by NewFluentHandler, after which
+// records should be dropped with an error.
+func TestFluentHandler_Close(t *testing.T) {
+	handler, err := loggy.NewFluentHandler(loggy.FluentHandlerOpts{Address: "127.0.0.1:1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_ = handler.Close()
+
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "after close", 0)
+	assert.ErrorIs(t, handler.Handle(context.Background(), record), loggy.ErrHandlerClosed)
+}
+
+// TestNewFluentHandler_Reconnect tests the FluentHandler returned by NewFluentHandler with records logged while the
+// server is down, which should be buffered and sent once it is back up.
+func TestNewFluentHandler_Reconnect(t *testing.T) {
+	// Create a logger that sends records to a unix socket that nothing is listening on yet
+	socket := filepath.Join(t.TempDir(), "fluent.sock")
+	handler, err := loggy.NewFluentHandler(loggy.FluentHandlerOpts{Network: "unix", Address: socket})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+
+	// Log a record, which can't be sent
+	slog.New(handler).Info("buffered log")
+	assert.Error(t, handler.Flush())
+
+	// Start the server and send the buffered record again
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	messages := serveFluent(t, listener, 1, false)
+	assert.NoError(t, handler.Flush())
+
+	// Check that the buffered record was received
+	message := receiveFluent(t, messages)
+	if assert.Len(t, message.entries, 1) {
+		assert.Equal(t, "buffered log", message.entries[0].record["msg"])
+	}
+}
+
+// TestNewFluentHandler_WriteTimeout tests the FluentHandler returned by NewFluentHandler with a server that never
+// reads, which should make sending fail after the write timeout instead of blocking forever.
+func TestNewFluentHandler_WriteTimeout(t *testing.T) {
+	// Start a server that accepts a connection but never reads from it
+	socket := filepath.Join(t.TempDir(), "fluent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	// Create a logger with a short write timeout
+	handler, err := loggy.NewFluentHandler(
+		loggy.FluentHandlerOpts{Network: "unix", Address: socket, WriteTimeout: 100 * time.Millisecond},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Log more than the socket can buffer, and check that sending gives up
+	logger := slog.New(handler)
+	payload := strings.Repeat("x", 128*1024)
+	for i := 0; i < 32; i++ {
+		logger.Info("large log", "payload", payload)
+	}
+	start := time.Now()
+	assert.Error(t, handler.Flush())
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	// Check that the handler can still be closed
+	start = time.Now()
+	_ = handler.Close()
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+// TestNewFluentHandler_InvalidNetwork tests the NewFluentHandler function with a network that the forward protocol
+// can't be used over.
+func TestNewFluentHandler_InvalidNetwork(t *testing.T) {
+	_, err := loggy.NewFluentHandler(loggy.FluentHandlerOpts{Network: "udp", Address: "localhost:24224"})
+	assert.Error(t, err)
+}
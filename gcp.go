@@ -0,0 +1,238 @@
+package loggy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// gcpSourceLocationKey is the key of the source location of a record in a Cloud Logging structured log.
+	gcpSourceLocationKey = "logging.googleapis.com/sourceLocation"
+
+	// gcpTraceKey is the key of the trace of a record in a Cloud Logging structured log.
+	gcpTraceKey = "logging.googleapis.com/trace"
+
+	// gcpSpanIDKey is the key of the span ID of a record in a Cloud Logging structured log.
+	gcpSpanIDKey = "logging.googleapis.com/spanId"
+
+	// gcpTraceSampledKey is the key of whether the trace of a record is sampled in a Cloud Logging structured log.
+	gcpTraceSampledKey = "logging.googleapis.com/trace_sampled"
+
+	// GCPLabelsKey is the key of the labels of a record in a Cloud Logging structured log. A group attribute with this
+	// key at the top level of a record is logged as labels instead of as part of the payload.
+	GCPLabelsKey = "logging.googleapis.com/labels"
+)
+
+// GCPHandlerOpts represents the options for configuring the behaviour of the `GCPHandler`.
+type GCPHandlerOpts struct {
+	// ProjectID is the ID of the Google Cloud project that traces are logged in, which is needed to link logs to
+	// traces. By default, the GOOGLE_CLOUD_PROJECT environment variable is used.
+	ProjectID string
+
+	// Labels are added to the labels of every record.
+	Labels map[string]string
+
+	// TraceExtractors are used in order to find the trace and span IDs of a record in the context it was logged with.
+	// By default, only W3CTraceExtractor is used.
+	TraceExtractors []TraceExtractor
+
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the time and source of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// GCPHandler is a handler that writes records as Google Cloud Logging structured logs, one JSON object per line, which
+// the logging agents of GKE, Cloud Run and other Google Cloud services parse into log entries.
+//
+// The level of a record is mapped to its severity, the source location, trace and span IDs are written to their
+// special fields, and the "http" group logged by the HTTP middleware is written as an httpRequest object. All the
+// other attributes are part of the payload. Attributes with the keys of the special fields, like "severity",
+// "message", "time" or "logging.googleapis.com/trace", are logged with an "attrs." prefix, so that they can't overwrite
+// the values written to those fields.
+type GCPHandler struct {
+	opts GCPHandlerOpts
+	mu   *sync.Mutex
+	w    io.Writer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the GCPHandler handles records at the given level.
+func (h *GCPHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as a structured log and writes it on its own line.
+func (h *GCPHandler) Handle(ctx context.Context, record slog.Record) error {
+	entry, err := json.Marshal(h.buildEntry(ctx, record))
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.w.Write(append(entry, '\n'))
+	return err
+}
+
+// WithAttrs returns a new GCPHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *GCPHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &GCPHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new GCPHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *GCPHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &GCPHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// buildEntry creates the structured log for a record.
+func (h *GCPHandler) buildEntry(ctx context.Context, record slog.Record) map[string]any {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+
+	entry := map[string]any{
+		"severity": gcpSeverity(record.Level),
+		"message":  record.Message,
+	}
+
+	// Add the time, unless it has been removed
+	if !record.Time.IsZero() {
+		if t, ok := replaceBuiltinTime(replace, record.Time); ok {
+			entry["time"] = t
+		}
+	}
+
+	// Add the source location, with the line as a string as it is an int64 in the LogEntrySourceLocation message
+	if h.opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				entry[gcpSourceLocationKey] = map[string]any{
+					"file":     source.File,
+					"line":     strconv.Itoa(source.Line),
+					"function": source.Function,
+				}
+			}
+		}
+	}
+
+	// Add the trace and span IDs from the context
+	if tc, ok := extractTrace(ctx, h.opts.TraceExtractors); ok {
+		entry[gcpTraceKey] = tc.TraceIDString()
+		if h.opts.ProjectID != "" {
+			entry[gcpTraceKey] = fmt.Sprintf("projects/%s/traces/%s", h.opts.ProjectID, tc.TraceIDString())
+		}
+		entry[gcpSpanIDKey] = tc.SpanIDString()
+		entry[gcpTraceSampledKey] = tc.Sampled()
+	}
+
+	// Add the static labels
+	labels := make(map[string]string, len(h.opts.Labels))
+	for key, value := range h.opts.Labels {
+		labels[key] = value
+	}
+
+	// Add the attributes, taking out the labels and the HTTP request
+	for _, attr := range collectAttrs(h.goas, record, replace) {
+		switch {
+		case attr.Key == GCPLabelsKey && attr.Value.Kind() == slog.KindGroup:
+			flattenAttrs(
+				"", ".", attr.Value.Group(), func(key string, value slog.Value) { labels[key] = valueToString(value) },
+			)
+		case attr.Key == HTTPGroup && attr.Value.Kind() == slog.KindGroup:
+			httpRequest, rest := gcpHTTPRequest(attr.Value.Group())
+			entry["httpRequest"] = httpRequest
+			if len(rest) > 0 {
+				entry[HTTPGroup] = valueToAny(slog.GroupValue(rest...))
+			}
+		case gcpReservedKey(attr.Key):
+			entry[reservedKeyPrefix+attr.Key] = valueToAny(attr.Value)
+		default:
+			entry[attr.Key] = valueToAny(attr.Value)
+		}
+	}
+	if len(labels) > 0 {
+		entry[GCPLabelsKey] = labels
+	}
+
+	return entry
+}
+
+// gcpReservedKey checks whether a key is the key of a special field of a Cloud Logging structured log, which
+// attributes must not overwrite.
+func gcpReservedKey(key string) bool {
+	switch key {
+	case "severity", "message", "time", "timestamp", "timestampSeconds", "timestampNanos", "httpRequest":
+		return true
+	}
+	return strings.HasPrefix(key, "logging.googleapis.com/")
+}
+
+// gcpHTTPRequest converts the attributes of the "http" group logged by the HTTP middleware into the fields of a
+// Cloud Logging HttpRequest, returning the attributes that have no equivalent field separately.
+func gcpHTTPRequest(attrs []slog.Attr) (map[string]any, []slog.Attr) {
+	httpRequest := make(map[string]any, len(attrs))
+	var rest []slog.Attr
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "method":
+			httpRequest["requestMethod"] = valueToString(attr.Value)
+		case "url":
+			httpRequest["requestUrl"] = valueToString(attr.Value)
+		case "status":
+			httpRequest["status"] = valueToAny(attr.Value)
+		case "bytes":
+			// The size is an int64, which is encoded as a string in JSON
+			httpRequest["responseSize"] = valueToString(attr.Value)
+		case "duration":
+			if attr.Value.Kind() == slog.KindDuration {
+				httpRequest["latency"] = strconv.FormatFloat(attr.Value.Duration().Seconds(), 'f', -1, 64) + "s"
+			} else {
+				rest = append(rest, attr)
+			}
+		case "remote_addr":
+			httpRequest["remoteIp"] = valueToString(attr.Value)
+		case "user_agent":
+			httpRequest["userAgent"] = valueToString(attr.Value)
+		default:
+			rest = append(rest, attr)
+		}
+	}
+	return httpRequest, rest
+}
+
+// NewGCPHandler returns a GCPHandler that writes records to w as Google Cloud Logging structured logs.
+func NewGCPHandler(w io.Writer, options ...GCPHandlerOpts) *GCPHandler {
+	// If options are provided, assign the first option to opts
+	var opts GCPHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.ProjectID == "" {
+		opts.ProjectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if len(opts.TraceExtractors) == 0 {
+		opts.TraceExtractors = []TraceExtractor{W3CTraceExtractor}
+	}
+
+	return &GCPHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
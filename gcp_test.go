@@ -0,0 +1,221 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewGCPHandler tests the GCPHandler returned by NewGCPHandler with a record logged with a trace in its context,
+// labels and the source location, which should be written to the special fields of Cloud Logging.
+func TestNewGCPHandler(t *testing.T) {
+	// Create a logger that writes structured logs to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewGCPHandler(
+		&outputStream,
+		loggy.GCPHandlerOpts{
+			ProjectID:      "my-project",
+			Labels:         map[string]string{"env": "prod"},
+			HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: removeTime},
+		},
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log a record with a trace and labels
+	ctx, err := loggy.ContextWithTraceparent(
+		context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Log(
+		ctx, loggy.LevelFatal, "this is a test log",
+		slog.Group(loggy.GCPLabelsKey, "tenant", "acme"),
+		slog.Group("user", "id", 42),
+	)
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	entry := logs[0]
+	assert.Equal(t, "CRITICAL", entry["severity"])
+	assert.Equal(t, "this is a test log", entry["message"])
+	assert.NotContains(t, entry, "time")
+	assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry["logging.googleapis.com/trace"])
+	assert.Equal(t, "00f067aa0ba902b7", entry["logging.googleapis.com/spanId"])
+	assert.Equal(t, true, entry["logging.googleapis.com/trace_sampled"])
+	assert.Equal(t, map[string]any{"env": "prod", "tenant": "acme"}, entry["logging.googleapis.com/labels"])
+	assert.Equal(t, "api", entry["service"])
+	assert.Equal(t, map[string]any{"id": float64(42)}, entry["user"])
+
+	sourceLocation := entry["logging.googleapis.com/sourceLocation"].(map[string]any)
+	assert.True(t, strings.HasSuffix(sourceLocation["file"].(string), "gcp_test.go"))
+	assert.Equal(t, "github.com/ksdfg/loggy_test.TestNewGCPHandler", sourceLocation["function"])
+	assert.IsType(t, "", sourceLocation["line"])
+}
+
+// TestNewGCPHandler_HTTPRequest tests the GCPHandler returned by NewGCPHandler with the access records logged by the
+// HTTP middleware, which should be written as httpRequest objects.
+func TestNewGCPHandler_HTTPRequest(t *testing.T) {
+	// Create a middleware that logs structured logs to a buffer
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(loggy.NewGCPHandler(&outputStream))
+	handler := middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }),
+	)
+
+	// Serve a request
+	request := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	request.Header.Set("User-Agent", "test-agent")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Check the HTTP request
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	assert.Equal(t, "WARNING", logs[0]["severity"])
+	httpRequest := logs[0]["httpRequest"].(map[string]any)
+	assert.Equal(t, "GET", httpRequest["requestMethod"])
+	assert.Equal(t, "/users/42", httpRequest["requestUrl"])
+	assert.Equal(t, float64(404), httpRequest["status"])
+	assert.Equal(t, "0", httpRequest["responseSize"])
+	assert.Equal(t, "192.0.2.1:1234", httpRequest["remoteIp"])
+	assert.Equal(t, "test-agent", httpRequest["userAgent"])
+	assert.Regexp(t, `^[0-9.e-]+s$`, httpRequest["latency"])
+
+	// Check that the route, which has no equivalent field, was kept in the payload
+	assert.Equal(t, map[string]any{"route": "/users/42"}, logs[0]["http"])
+}
+
+// TestNewGCPHandler_ReservedKeys tests the GCPHandler returned by NewGCPHandler with attributes that have the keys
+// of special fields, which should be logged with a prefix instead of overwriting them.
+func TestNewGCPHandler_ReservedKeys(t *testing.T) {
+	// Create a logger that writes structured logs to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewGCPHandler(&outputStream))
+
+	// Log a record in a traced context, with attributes named after special fields
+	ctx, err := loggy.ContextWithTraceparent(
+		context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.ErrorContext(
+		ctx, "this is a test log",
+		"severity", "low",
+		"message", "overwritten",
+		"time", "yesterday",
+		"timestampSeconds", 1,
+		"timestampNanos", 2,
+		"logging.googleapis.com/trace", "fake",
+		loggy.GCPLabelsKey, "not a group",
+	)
+
+	// Check that the special fields were kept, and the attributes were logged with a prefix
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	entry := logs[0]
+	assert.Equal(t, "ERROR", entry["severity"])
+	assert.Equal(t, "this is a test log", entry["message"])
+	assert.NotEqual(t, "yesterday", entry["time"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["logging.googleapis.com/trace"])
+	assert.NotContains(t, entry, "logging.googleapis.com/labels")
+	assert.Equal(t, "low", entry["attrs.severity"])
+	assert.Equal(t, "overwritten", entry["attrs.message"])
+	assert.Equal(t, "yesterday", entry["attrs.time"])
+	assert.NotContains(t, entry, "timestampSeconds")
+	assert.NotContains(t, entry, "timestampNanos")
+	assert.Equal(t, float64(1), entry["attrs.timestampSeconds"])
+	assert.Equal(t, float64(2), entry["attrs.timestampNanos"])
+	assert.Equal(t, "fake", entry["attrs.logging.googleapis.com/trace"])
+	assert.Equal(t, "not a group", entry["attrs.logging.googleapis.com/labels"])
+}
+
+// pointerError is an error whose Error method can't be called on a nil pointer.
+type pointerError struct {
+	message string
+}
+
+// Error returns the message of the error.
+func (e *pointerError) Error() string {
+	return e.message
+}
+
+// TestNewGCPHandler_NilValues tests the GCPHandler returned by NewGCPHandler with nil pointers to a fmt.Stringer and
+// an error, which should be written as "<nil>" instead of panicking.
+func TestNewGCPHandler_NilValues(t *testing.T) {
+	// Create a logger that writes structured logs to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewGCPHandler(&outputStream))
+
+	// Log a record with nil pointers
+	logger.Info("this is a test log", "url", (*url.URL)(nil), "cause", (*pointerError)(nil))
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "<nil>", logs[0]["url"])
+		assert.Equal(t, "<nil>", logs[0]["cause"])
+	}
+}
+
+// TestNewGCPHandler_NonFinite tests the GCPHandler returned by NewGCPHandler with non-finite floats, which should be
+// logged as strings instead of dropping the record.
+func TestNewGCPHandler_NonFinite(t *testing.T) {
+	// Create a logger that writes structured logs to a buffer
+	var outputStream bytes.Buffer
+	logger := slog.New(loggy.NewGCPHandler(&outputStream))
+
+	// Log a record with non-finite floats
+	logger.Info("this is a test log", "nan", math.NaN(), slog.Group("limits", "max", math.Inf(1), "min", math.Inf(-1)))
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "NaN", logs[0]["nan"])
+		assert.Equal(t, map[string]any{"max": "+Inf", "min": "-Inf"}, logs[0]["limits"])
+	}
+}
+
+// TestNewConsoleLogHandler_GCP tests the NewConsoleLogHandler function with the GCP format, which should colourise
+// the output according to the severity.
+func TestNewConsoleLogHandler_GCP(t *testing.T) {
+	// Capture the console output
+	output, err := captureConsoleOutput(
+		t, true, func() {
+			// Initialize the logger with the GCP format
+			opts := loggy.ConsoleLogWriterOpts{LogToStdout: true, Format: loggy.ConsoleFormatGCP}
+			initializeLogger(opts)
+
+			// Log an error message
+			slog.Error("this is a test log")
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Define the expected output
+	expectedOutput := color.New(color.FgRed).Sprint("{\"message\":\"this is a test log\",\"severity\":\"ERROR\"}\n")
+
+	// Assert that the output matches the expected output
+	assert.Equal(t, expectedOutput, output)
+}
@@ -0,0 +1,417 @@
+package loggy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GELFCompression is the compression algorithm used for GELF messages sent over UDP.
+type GELFCompression int
+
+const (
+	// GELFCompressionGzip compresses messages with gzip. This is the default.
+	GELFCompressionGzip GELFCompression = iota
+	// GELFCompressionZlib compresses messages with zlib.
+	GELFCompressionZlib
+	// GELFCompressionNone sends messages without compressing them.
+	GELFCompressionNone
+)
+
+const (
+	// gelfDefaultChunkSize is the default maximum size of a UDP datagram sent to graylog, which fits in the MTU of
+	// most networks.
+	gelfDefaultChunkSize = 1420
+
+	// gelfChunkHeaderSize is the size of the header that is added to every chunk of a chunked message.
+	gelfChunkHeaderSize = 12
+
+	// gelfMaxChunks is the maximum number of chunks that graylog accepts for a single message.
+	gelfMaxChunks = 128
+)
+
+// gelfChunkMagic are the magic bytes that mark a UDP datagram as a chunk of a larger GELF message.
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// GELFHandlerOpts represents the options for configuring the behaviour of the `GELFHandler`.
+type GELFHandlerOpts struct {
+	// Network is the network used to send messages to graylog, either "udp" or "tcp". By default, messages are sent
+	// over UDP.
+	Network string
+
+	// Address is the address of the graylog GELF input, e.g. "localhost:12201".
+	Address string
+
+	// Host is the name of the host sending the messages. By default, the hostname reported by the kernel is used.
+	Host string
+
+	// Compression specifies how messages sent over UDP are compressed. Messages sent over TCP are never compressed, as
+	// graylog does not support compression over TCP.
+	Compression GELFCompression
+
+	// ChunkSize is the maximum size of a single UDP datagram. Messages larger than this are split into chunks. By
+	// default, it is 1420 bytes.
+	ChunkSize int
+
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the time and source of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// gelfConn is a connection to graylog that is shared between a GELFHandler and all the handlers derived from it.
+type gelfConn struct {
+	mu      sync.Mutex
+	network string
+	address string
+	conn    net.Conn
+	closed  bool
+}
+
+// GELFHandler is a handler that sends records to graylog as GELF 1.1 messages.
+//
+// Attributes are sent as additional fields, prefixed with an underscore. Attributes inside groups are flattened,
+// with their keys qualified by the names of the groups joined by underscores.
+type GELFHandler struct {
+	opts GELFHandlerOpts
+	conn *gelfConn
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the GELFHandler handles records at the given level.
+func (h *GELFHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as a GELF message and sends it to graylog.
+func (h *GELFHandler) Handle(_ context.Context, record slog.Record) error {
+	message, err := json.Marshal(h.buildMessage(record))
+	if err != nil {
+		return err
+	}
+
+	return h.conn.send(message, h.opts)
+}
+
+// WithAttrs returns a new GELFHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *GELFHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &GELFHandler{opts: h.opts, conn: h.conn, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new GELFHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *GELFHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &GELFHandler{opts: h.opts, conn: h.conn, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// Close closes the connection to graylog. It is shared by all the handlers derived from this one, so none of them can
+// be used after it is closed: records handled afterwards are dropped, and ErrHandlerClosed is returned.
+func (h *GELFHandler) Close() error {
+	h.conn.mu.Lock()
+	defer h.conn.mu.Unlock()
+
+	h.conn.closed = true
+	if h.conn.conn == nil {
+		return nil
+	}
+
+	err := h.conn.conn.Close()
+	h.conn.conn = nil
+	return err
+}
+
+// buildMessage creates the GELF payload for a record.
+func (h *GELFHandler) buildMessage(record slog.Record) map[string]any {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+
+	// Add the mandatory fields
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          h.opts.Host,
+		"short_message": record.Message,
+		"level":         gelfLevel(record.Level),
+	}
+
+	// Messages spanning multiple lines are sent in full as the full message, with only the first line as the short one
+	if short, _, found := strings.Cut(record.Message, "\n"); found {
+		message["short_message"] = short
+		message["full_message"] = record.Message
+	}
+
+	// Add the timestamp as seconds since the epoch, unless it has been removed
+	if !record.Time.IsZero() {
+		if t, ok := replaceBuiltinTime(replace, record.Time); ok {
+			message["timestamp"] = float64(t.UnixMicro()) / 1e6
+		}
+	}
+
+	// Add the source as additional fields
+	if h.opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				message["_file"] = source.File
+				message["_line"] = source.Line
+				message["_function"] = source.Function
+			}
+		}
+	}
+
+	// Add all the attributes as additional fields
+	flattenAttrs(
+		"", "_", collectAttrs(h.goas, record, replace),
+		func(key string, value slog.Value) {
+			message[gelfFieldName(key)] = gelfFieldValue(value)
+		},
+	)
+
+	return message
+}
+
+// send sends a GELF message over the connection, dialling it first if needed.
+func (c *gelfConn) send(message []byte, opts GELFHandlerOpts) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// TCP messages are null delimited and never compressed
+	if c.network == "tcp" {
+		payload := append(message, 0)
+
+		// Retry once with a new connection if the old one has been closed by graylog. If part of the message was
+		// written, it is dropped instead, as graylog would get a truncated message followed by the whole of it.
+		n, err := c.write(payload)
+		if err != nil && n == 0 && !errors.Is(err, ErrHandlerClosed) {
+			_, err = c.write(payload)
+		}
+		if err != nil && n > 0 {
+			return fmt.Errorf("loggy: GELF message dropped after writing %d of its %d bytes: %w", n, len(payload), err)
+		}
+		return err
+	}
+
+	// UDP messages are compressed, and chunked if they don't fit in a single datagram
+	payload, err := gelfCompress(message, opts.Compression)
+	if err != nil {
+		return err
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= gelfChunkHeaderSize {
+		chunkSize = gelfDefaultChunkSize
+	}
+	if len(payload) <= chunkSize {
+		_, err := c.write(payload)
+		return err
+	}
+
+	chunks, err := gelfChunks(payload, chunkSize)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := c.write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write writes a single payload to the connection, dialling it first if needed, and returns the number of bytes
+// written. If writing fails, the connection is closed so that it is dialled again for the next write. The mutex must
+// be held by the caller.
+func (c *gelfConn) write(payload []byte) (int, error) {
+	// Closed connections are not dialled again
+	if c.closed {
+		return 0, ErrHandlerClosed
+	}
+
+	if c.conn == nil {
+		conn, err := net.Dial(c.network, c.address)
+		if err != nil {
+			return 0, err
+		}
+		c.conn = conn
+	}
+
+	n, err := c.conn.Write(payload)
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	return n, err
+}
+
+// gelfCompress compresses a message with the given compression algorithm.
+func gelfCompress(message []byte, compression GELFCompression) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch compression {
+	case GELFCompressionNone:
+		return message, nil
+	case GELFCompressionZlib:
+		writer := zlib.NewWriter(&buf)
+		if _, err := writer.Write(message); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(message); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gelfChunks splits a payload into GELF chunks no larger than chunkSize, each with the chunk header prepended.
+func gelfChunks(payload []byte, chunkSize int) ([][]byte, error) {
+	dataSize := chunkSize - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("loggy: GELF message of %d bytes needs %d chunks, more than the %d allowed",
+			len(payload), count, gelfMaxChunks)
+	}
+
+	// All the chunks of a message share a random ID
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := payload[i*dataSize : min((i+1)*dataSize, len(payload))]
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+len(data))
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data...)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// gelfLevel maps a slog level to the syslog severity that GELF uses.
+func gelfLevel(level slog.Level) int {
+	switch {
+	case level >= LevelFatal:
+		return 2 // critical
+	case level >= slog.LevelError:
+		return 3 // error
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// gelfFieldName converts an attribute key into the name of a GELF additional field, which is prefixed with an
+// underscore and may only contain letters, numbers, underscores, dashes and dots.
+func gelfFieldName(key string) string {
+	name := strings.Map(
+		func(r rune) rune {
+			if r == '_' || r == '-' || r == '.' || r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		},
+		key,
+	)
+
+	// "_id" is reserved by graylog
+	if name == "id" {
+		return "__id"
+	}
+	return "_" + name
+}
+
+// gelfFieldValue converts a resolved value into a GELF additional field value, which can only be a number or a string.
+func gelfFieldValue(value slog.Value) any {
+	switch value.Kind() {
+	case slog.KindInt64:
+		return value.Int64()
+	case slog.KindUint64:
+		return value.Uint64()
+	case slog.KindFloat64:
+		if math.IsNaN(value.Float64()) || math.IsInf(value.Float64(), 0) {
+			return value.String()
+		}
+		return value.Float64()
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	default:
+		return value.String()
+	}
+}
+
+// NewGELFHandler returns a GELFHandler that sends records to the graylog GELF input at the configured address.
+//
+// The connection is dialled immediately, so that misconfiguration is reported early. If a TCP connection is dropped,
+// it is dialled again when the next record is sent.
+func NewGELFHandler(opts GELFHandlerOpts) (*GELFHandler, error) {
+	// Validate the network
+	switch opts.Network {
+	case "":
+		opts.Network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("loggy: unsupported GELF network %q", opts.Network)
+	}
+	if opts.Address == "" {
+		return nil, errors.New("loggy: GELF address is required")
+	}
+
+	// Default to the hostname of the machine
+	if opts.Host == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		opts.Host = hostname
+	}
+
+	// Dial the connection
+	conn := &gelfConn{network: opts.Network, address: opts.Address}
+	netConn, err := net.Dial(opts.Network, opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn.conn = netConn
+
+	return &GELFHandler{opts: opts, conn: conn}, nil
+}
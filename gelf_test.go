@@ -0,0 +1,313 @@
+package loggy_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// listenGELFUDP starts a UDP listener on a random local port to act as a graylog GELF input.
+func listenGELFUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// readGELFDatagram reads a single datagram from the UDP listener.
+func readGELFDatagram(t *testing.T, conn net.PacketConn) []byte {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf[:n]
+}
+
+// decodeGELFMessage decompresses a GELF payload, detecting gzip and zlib by their magic bytes, and unmarshals it.
+func decodeGELFMessage(t *testing.T, payload []byte) map[string]any {
+	var reader io.Reader = bytes.NewReader(payload)
+
+	switch {
+	case payload[0] == 0x1f && payload[1] == 0x8b:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gzipReader
+	case payload[0] == 0x78:
+		zlibReader, err := zlib.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = zlibReader
+	}
+
+	var message map[string]any
+	if err := json.NewDecoder(reader).Decode(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	return message
+}
+
+// TestNewGELFHandler_UDP tests the GELFHandler returned by NewGELFHandler with a record sent as a single gzip
+// compressed UDP datagram.
+func TestNewGELFHandler_UDP(t *testing.T) {
+	// Start a fake graylog input
+	server := listenGELFUDP(t)
+
+	// Create a logger that sends messages to the fake input
+	handler, err := loggy.NewGELFHandler(loggy.GELFHandlerOpts{Address: server.LocalAddr().String(), Host: "test-host"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	// Log a warning with attributes in a group
+	logger.With("service", "api").WithGroup("request").Warn("this is a test log", "id", 42, "ok", true)
+
+	// Check the message that was received
+	message := decodeGELFMessage(t, readGELFDatagram(t, server))
+	assert.Equal(t, "1.1", message["version"])
+	assert.Equal(t, "test-host", message["host"])
+	assert.Equal(t, "this is a test log", message["short_message"])
+	assert.Equal(t, float64(4), message["level"])
+	assert.Equal(t, "api", message["_service"])
+	assert.Equal(t, float64(42), message["_request_id"])
+	assert.Equal(t, "true", message["_request_ok"])
+	assert.NotNil(t, message["timestamp"])
+}
+
+// TestNewGELFHandler_UDP_Zlib tests the GELFHandler returned by NewGELFHandler with zlib compression and a multiline
+// message.
+func TestNewGELFHandler_UDP_Zlib(t *testing.T) {
+	// Start a fake graylog input
+	server := listenGELFUDP(t)
+
+	// Create a logger that sends zlib compressed messages to the fake input
+	handler, err := loggy.NewGELFHandler(
+		loggy.GELFHandlerOpts{
+			Address:     server.LocalAddr().String(),
+			Host:        "test-host",
+			Compression: loggy.GELFCompressionZlib,
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+
+	// Log an error with a multiline message and an attribute that graylog reserves
+	slog.New(handler).Error("first line\nsecond line", "id", "abc")
+
+	// Check that the short message only has the first line, and the reserved field was renamed
+	message := decodeGELFMessage(t, readGELFDatagram(t, server))
+	assert.Equal(t, "first line", message["short_message"])
+	assert.Equal(t, "first line\nsecond line", message["full_message"])
+	assert.Equal(t, float64(3), message["level"])
+	assert.Equal(t, "abc", message["__id"])
+}
+
+// TestNewGELFHandler_UDP_Chunked tests the GELFHandler returned by NewGELFHandler with a message that is too large to
+// fit in a single datagram.
+func TestNewGELFHandler_UDP_Chunked(t *testing.T) {
+	// Start a fake graylog input
+	server := listenGELFUDP(t)
+
+	// Create a logger that sends uncompressed messages in small chunks
+	handler, err := loggy.NewGELFHandler(
+		loggy.GELFHandlerOpts{
+			Address:     server.LocalAddr().String(),
+			Host:        "test-host",
+			Compression: loggy.GELFCompressionNone,
+			ChunkSize:   100,
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+
+	// Log a message that needs multiple chunks
+	longValue := strings.Repeat("a", 500)
+	slog.New(handler).Info("this is a test log", "long", longValue)
+
+	// Read the first chunk to find out how many chunks there are
+	first := readGELFDatagram(t, server)
+	assert.Equal(t, []byte{0x1e, 0x0f}, first[:2])
+	assert.Equal(t, byte(0), first[10])
+	count := int(first[11])
+	assert.Greater(t, count, 1)
+
+	// Read the remaining chunks and reassemble the message in order
+	chunks := make([][]byte, count)
+	chunks[0] = first[12:]
+	for i := 1; i < count; i++ {
+		chunk := readGELFDatagram(t, server)
+		assert.Equal(t, first[2:10], chunk[2:10])
+		assert.LessOrEqual(t, len(chunk), 100)
+		chunks[chunk[10]] = chunk[12:]
+	}
+
+	// Check the reassembled message
+	message := decodeGELFMessage(t, bytes.Join(chunks, nil))
+	assert.Equal(t, "this is a test log", message["short_message"])
+	assert.Equal(t, longValue, message["_long"])
+}
+
+// TestNewGELFHandler_TCP tests the GELFHandler returned by NewGELFHandler with null delimited messages sent over TCP.
+func TestNewGELFHandler_TCP(t *testing.T) {
+	// Start a fake graylog TCP input
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+
+	// Read the first two null delimited messages from the first connection in the background
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		var messages []string
+		for len(messages) < 2 {
+			message, err := reader.ReadString(0)
+			if err != nil {
+				break
+			}
+			messages = append(messages, strings.TrimSuffix(message, "\x00"))
+		}
+		received <- messages
+	}()
+
+	// Create a logger that sends messages to the fake input
+	handler, err := loggy.NewGELFHandler(
+		loggy.GELFHandlerOpts{Network: "tcp", Address: listener.Addr().String(), Host: "test-host"},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	// Log two messages
+	logger.Info("first log")
+	logger.Info("second log")
+
+	// Check both messages were received as plain JSON
+	messages := <-received
+	if !assert.Len(t, messages, 2) {
+		return
+	}
+	for i, expected := range []string{"first log", "second log"} {
+		var message map[string]any
+		if err := json.Unmarshal([]byte(messages[i]), &message); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, expected, message["short_message"])
+	}
+}
+
+// TestGELFHandler_Close tests the Close method of the GELFHandler returned by NewGELFHandler, after which records
+// should be dropped with an error instead of dialling the connection again.
+func TestGELFHandler_Close(t *testing.T) {
+	// Start a fake graylog TCP input that counts its connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() { _, _ = io.Copy(io.Discard, conn) }()
+		}
+	}()
+
+	// Create a handler, and close it
+	handler, err := loggy.NewGELFHandler(loggy.GELFHandlerOpts{Network: "tcp", Address: listener.Addr().String()})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that handling a record fails without dialling again
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "after close", 0)
+	assert.ErrorIs(t, handler.Handle(context.Background(), record), loggy.ErrHandlerClosed)
+	time.Sleep(50 * time.Millisecond)
+	assert.LessOrEqual(t, accepted.Load(), int32(1))
+}
+
+// TestNewGELFHandler_Enabled tests the Enabled method of the GELFHandler returned by NewGELFHandler with a level set
+// in the handler options.
+func TestNewGELFHandler_Enabled(t *testing.T) {
+	// Create a handler that only handles warnings and above
+	server := listenGELFUDP(t)
+	handler, err := loggy.NewGELFHandler(
+		loggy.GELFHandlerOpts{
+			Address:        server.LocalAddr().String(),
+			HandlerOptions: slog.HandlerOptions{Level: slog.LevelWarn},
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer handler.Close()
+
+	// Check the levels that are enabled
+	assert.Equal(t, false, handler.Enabled(context.Background(), slog.LevelInfo))
+	assert.Equal(t, true, handler.Enabled(context.Background(), slog.LevelWarn))
+}
+
+// TestNewGELFHandler_InvalidNetwork tests the NewGELFHandler function with a network that GELF can't be sent over.
+func TestNewGELFHandler_InvalidNetwork(t *testing.T) {
+	_, err := loggy.NewGELFHandler(loggy.GELFHandlerOpts{Network: "unix", Address: "/tmp/graylog.sock"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,254 @@
+package loggy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// RequestIDHeader is the header that request IDs are read from and written to by default.
+	RequestIDHeader = "X-Request-ID"
+
+	// HTTPGroup is the key of the group holding the details of the request in access records.
+	HTTPGroup = "http"
+
+	// RequestIDKey is the key of the attribute holding the request ID in records logged by request scoped loggers.
+	RequestIDKey = "request_id"
+
+	// maxRequestIDLength is the maximum length of request IDs sent by clients that are propagated.
+	maxRequestIDLength = 128
+)
+
+// HTTPMiddlewareOpts represents the options for configuring the behaviour of the middleware returned by
+// `NewHTTPMiddleware`.
+type HTTPMiddlewareOpts struct {
+	// RequestIDHeader is the header that the request ID is read from, if the client sent one, and written to in the
+	// response. By default, it is "X-Request-ID". Request IDs sent by clients are only propagated if they are at most
+	// 128 characters long and only contain letters, digits, '-', '_', '.' and ':'. Otherwise, a new one is generated,
+	// so that clients can't inject arbitrary content into the logs and response headers.
+	RequestIDHeader string
+
+	// GenerateRequestID generates IDs for requests that don't have one. By default, random 128-bit hex strings are
+	// generated.
+	GenerateRequestID func() string
+
+	// Route returns the route that a request matched, e.g. "/users/{id}", so that access records can be grouped by
+	// it. By default, the path of the request is used.
+	Route func(r *http.Request) string
+
+	// Level returns the level of the access record for a response status code. By default, 5xx responses are logged
+	// at ERROR, 4xx responses at WARN and all other responses at INFO.
+	Level func(status int) slog.Level
+
+	// Message is the message of access records. By default, it is "http request".
+	Message string
+}
+
+// loggerKey is the key that the request scoped logger is stored under in a context.
+type loggerKey struct{}
+
+// requestIDKey is the key that the request ID is stored under in a context.
+type requestIDKey struct{}
+
+// ContextWithLogger returns a copy of ctx that carries the given logger.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stored in ctx with ContextWithLogger, e.g. the request scoped logger stored by
+// the middleware returned by NewHTTPMiddleware. If there is none, the default logger is returned.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by the middleware returned by NewHTTPMiddleware, or an
+// empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// responseRecorder wraps a http.ResponseWriter to record the status code and the number of bytes written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader records the status code and writes it to the wrapped writer. Informational 1xx codes are only written,
+// since they can be followed by the final status code of the response.
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written, along with an implicit 200 status code if none has been written yet.
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the wrapped writer, if it supports flushing.
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, so that http.ResponseController can access its other features.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// httpStatusLevel is the default level of access records: ERROR for server errors, WARN for client errors and INFO
+// for everything else.
+func httpStatusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// validRequestID checks whether a request ID sent by a client is short enough and only contains safe characters.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		c := requestID[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// generateRequestID generates a random 128-bit hex string.
+func generateRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// NewHTTPMiddleware returns net/http middleware that logs one access record for every request using the given
+// handler.
+//
+// For every request, the middleware reads the request ID from the request headers or generates a new one, writes it
+// to the response headers, and stores it in the request context along with a request scoped logger that adds it to
+// every record. The logger can be retrieved with LoggerFromContext. The context also carries a buffer for
+// BacktraceHandlers (see WithBacktrace), so that the debug records of failing requests can be logged. The access record
+// is logged without the buffer, so that BacktraceHandlers pass it on instead of holding it back, and only the errors
+// logged while serving the request flush the buffered records.
+//
+// The access record is logged after the request has been served, with the method, URL, route, status code, number of
+// bytes written, duration, remote address and user agent of the request in a group with the key "http". It is also
+// logged if the handler panics, with a 500 status code if no response was written, before the panic continues to
+// unwind the stack.
+func NewHTTPMiddleware(handler slog.Handler, options ...HTTPMiddlewareOpts) func(http.Handler) http.Handler {
+	// If options are provided, assign the first option to opts
+	var opts HTTPMiddlewareOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.RequestIDHeader == "" {
+		opts.RequestIDHeader = RequestIDHeader
+	}
+	if opts.GenerateRequestID == nil {
+		opts.GenerateRequestID = generateRequestID
+	}
+	if opts.Route == nil {
+		opts.Route = func(r *http.Request) string { return r.URL.Path }
+	}
+	if opts.Level == nil {
+		opts.Level = httpStatusLevel
+	}
+	if opts.Message == "" {
+		opts.Message = "http request"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+
+				// Propagate the request ID, or generate one if the client didn't send a valid one
+				requestID := r.Header.Get(opts.RequestIDHeader)
+				if !validRequestID(requestID) {
+					requestID = opts.GenerateRequestID()
+				}
+				w.Header().Set(opts.RequestIDHeader, requestID)
+
+				// Store the request ID and a request scoped logger in the context
+				logger := slog.New(handler).With(slog.String(RequestIDKey, requestID))
+				ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+				ctx = ContextWithLogger(ctx, logger)
+				r = r.WithContext(WithBacktrace(ctx))
+
+				// Log the access record once the request has been served, even if the handler panics, without recovering
+				// the panic so that it keeps unwinding the stack
+				recorder := &responseRecorder{ResponseWriter: w}
+				served := false
+				defer func() {
+					if recorder.status == 0 {
+						if served {
+							recorder.status = http.StatusOK
+						} else {
+							recorder.status = http.StatusInternalServerError
+						}
+					}
+
+					logger.LogAttrs(
+						ctx,
+						opts.Level(recorder.status),
+						opts.Message,
+						slog.Group(
+							HTTPGroup,
+							slog.String("method", r.Method),
+							slog.String("url", r.URL.RequestURI()),
+							slog.String("route", opts.Route(r)),
+							slog.Int("status", recorder.status),
+							slog.Int64("bytes", recorder.bytes),
+							slog.Duration("duration", time.Since(start)),
+							slog.String("remote_addr", r.RemoteAddr),
+							slog.String("user_agent", r.UserAgent()),
+						),
+					)
+				}()
+
+				// Serve the request, recording the response
+				next.ServeHTTP(recorder, r)
+				served = true
+			},
+		)
+	}
+}
@@ -0,0 +1,257 @@
+package loggy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// decodeJSONLogs decodes every line written by a JSON handler.
+func decodeJSONLogs(t *testing.T, output string) []map[string]any {
+	var logs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var log map[string]any
+		if err := json.Unmarshal([]byte(line), &log); err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// TestNewHTTPMiddleware tests the middleware returned by NewHTTPMiddleware with a request that has no request ID,
+// which should get a generated one, and be logged along with the record logged by the request scoped logger.
+func TestNewHTTPMiddleware(t *testing.T) {
+	// Create a middleware that logs to a buffer
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(
+		slog.NewJSONHandler(&outputStream, nil),
+		loggy.HTTPMiddlewareOpts{
+			GenerateRequestID: func() string { return "generated-id" },
+			Route:             func(r *http.Request) string { return "/users/{id}" },
+		},
+	)
+
+	// Create a handler that logs with the request scoped logger and writes a response
+	handler := middleware(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				loggy.LoggerFromContext(r.Context()).Info("fetching user")
+				assert.Equal(t, "generated-id", loggy.RequestIDFromContext(r.Context()))
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("hello"))
+			},
+		),
+	)
+
+	// Serve a request
+	request := httptest.NewRequest(http.MethodPost, "/users/42?verbose=true", nil)
+	request.Header.Set("User-Agent", "test-agent")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	// Check the response has the request ID
+	assert.Equal(t, "generated-id", response.Header().Get("X-Request-ID"))
+
+	// Check the logs
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	assert.Equal(t, "fetching user", logs[0]["msg"])
+	assert.Equal(t, "generated-id", logs[0]["request_id"])
+
+	accessLog := logs[1]
+	assert.Equal(t, "INFO", accessLog["level"])
+	assert.Equal(t, "http request", accessLog["msg"])
+	assert.Equal(t, "generated-id", accessLog["request_id"])
+	httpGroup := accessLog["http"].(map[string]any)
+	assert.Equal(t, "POST", httpGroup["method"])
+	assert.Equal(t, "/users/42?verbose=true", httpGroup["url"])
+	assert.Equal(t, "/users/{id}", httpGroup["route"])
+	assert.Equal(t, float64(201), httpGroup["status"])
+	assert.Equal(t, float64(5), httpGroup["bytes"])
+	assert.Equal(t, "192.0.2.1:1234", httpGroup["remote_addr"])
+	assert.Equal(t, "test-agent", httpGroup["user_agent"])
+	assert.Contains(t, httpGroup, "duration")
+}
+
+// TestNewHTTPMiddleware_PropagateRequestID tests the middleware returned by NewHTTPMiddleware with a request that
+// already has a request ID in a custom header.
+func TestNewHTTPMiddleware_PropagateRequestID(t *testing.T) {
+	// Create a middleware that reads request IDs from a custom header
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(
+		slog.NewJSONHandler(&outputStream, nil), loggy.HTTPMiddlewareOpts{RequestIDHeader: "X-Correlation-ID"},
+	)
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Serve a request with a request ID
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("X-Correlation-ID", "client-id")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	// Check the request ID was propagated, and the implicit status was logged
+	assert.Equal(t, "client-id", response.Header().Get("X-Correlation-ID"))
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "client-id", logs[0]["request_id"])
+		assert.Equal(t, float64(200), logs[0]["http"].(map[string]any)["status"])
+	}
+}
+
+// TestNewHTTPMiddleware_InvalidRequestID tests the middleware returned by NewHTTPMiddleware with requests that have
+// request IDs that are too long or contain unsafe characters, which should be replaced by generated ones.
+func TestNewHTTPMiddleware_InvalidRequestID(t *testing.T) {
+	for name, requestID := range map[string]string{
+		"too long":   strings.Repeat("a", 129),
+		"newline":    "client-id\nlevel=ERROR",
+		"quote":      `client-id"`,
+		"whitespace": "client id",
+	} {
+		t.Run(
+			name, func(t *testing.T) {
+				// Create a middleware that generates a known request ID
+				var outputStream bytes.Buffer
+				middleware := loggy.NewHTTPMiddleware(
+					slog.NewJSONHandler(&outputStream, nil),
+					loggy.HTTPMiddlewareOpts{GenerateRequestID: func() string { return "generated-id" }},
+				)
+				handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+				// Serve a request with the invalid request ID
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				request.Header.Set("X-Request-ID", requestID)
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+
+				// Check that the request ID was replaced
+				assert.Equal(t, "generated-id", response.Header().Get("X-Request-ID"))
+				logs := decodeJSONLogs(t, outputStream.String())
+				if assert.Len(t, logs, 1) {
+					assert.Equal(t, "generated-id", logs[0]["request_id"])
+				}
+			},
+		)
+	}
+}
+
+// TestNewHTTPMiddleware_Panic tests the middleware returned by NewHTTPMiddleware with a handler that panics, which
+// should still be logged in an access record with a 500 status code before the panic continues.
+func TestNewHTTPMiddleware_Panic(t *testing.T) {
+	// Create a middleware around a handler that panics
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(slog.NewJSONHandler(&outputStream, nil))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	// Serve a request, which should still panic
+	assert.PanicsWithValue(
+		t, "boom", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		},
+	)
+
+	// Check the access record
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "ERROR", logs[0]["level"])
+		assert.Equal(t, float64(500), logs[0]["http"].(map[string]any)["status"])
+	}
+}
+
+// TestNewHTTPMiddleware_Level tests the middleware returned by NewHTTPMiddleware with responses of different status
+// codes, which should be logged at different levels.
+func TestNewHTTPMiddleware_Level(t *testing.T) {
+	for status, level := range map[int]string{
+		http.StatusOK:                  "INFO",
+		http.StatusMovedPermanently:    "INFO",
+		http.StatusNotFound:            "WARN",
+		http.StatusInternalServerError: "ERROR",
+	} {
+		// Create a middleware around a handler that responds with the status
+		var outputStream bytes.Buffer
+		middleware := loggy.NewHTTPMiddleware(slog.NewJSONHandler(&outputStream, nil))
+		responseStatus := status
+		handler := middleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(responseStatus) }),
+		)
+
+		// Serve a request
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		// Check the level of the access record
+		logs := decodeJSONLogs(t, outputStream.String())
+		if assert.Len(t, logs, 1) {
+			assert.Equal(t, level, logs[0]["level"], status)
+		}
+	}
+}
+
+// TestNewHTTPMiddleware_Informational tests the middleware returned by NewHTTPMiddleware with a handler that writes
+// an informational status code before the final one, which should be the one that is logged.
+func TestNewHTTPMiddleware_Informational(t *testing.T) {
+	// Create a middleware around a handler that sends early hints before responding
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(slog.NewJSONHandler(&outputStream, nil))
+	handler := middleware(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusAccepted)
+			},
+		),
+	)
+
+	// Serve a request
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Check that the final status code was logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, float64(http.StatusAccepted), logs[0]["http"].(map[string]any)["status"])
+	}
+}
+
+// TestNewHTTPMiddleware_Flush tests the middleware returned by NewHTTPMiddleware with a handler that flushes the
+// response, which should still be possible through the wrapped response writer.
+func TestNewHTTPMiddleware_Flush(t *testing.T) {
+	// Create a middleware around a handler that flushes the response
+	var outputStream bytes.Buffer
+	middleware := loggy.NewHTTPMiddleware(slog.NewJSONHandler(&outputStream, nil))
+	handler := middleware(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("data"))
+				assert.NoError(t, http.NewResponseController(w).Flush())
+			},
+		),
+	)
+
+	// Serve a request
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Check that the response was flushed
+	assert.True(t, response.Flushed)
+}
+
+// TestLoggerFromContext_Default tests the LoggerFromContext function with a context that has no logger, which should
+// return the default logger.
+func TestLoggerFromContext_Default(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, slog.Default(), loggy.LoggerFromContext(request.Context()))
+}
@@ -0,0 +1,264 @@
+package loggy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LogfmtHandlerOpts represents the options for configuring the behaviour of the `LogfmtHandler`.
+type LogfmtHandlerOpts struct {
+	// GroupSeparator is used to join the keys of groups with the keys of the attributes in them. By default, it is ".".
+	GroupSeparator string
+
+	// SortKeys specifies whether to sort the attributes of records by their keys. The built-in attributes (time, level,
+	// source and message) always come first, in that order. By default, attributes are written in the order they were
+	// added.
+	SortKeys bool
+
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the built-in attributes of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// LogfmtHandler is a handler that writes records as logfmt lines, with strict quoting rules so that every line can be
+// parsed back with ParseLogfmt.
+//
+// Every line is a list of key=value pairs separated by single spaces. Groups are flattened, with their keys joined to
+// the keys of the attributes in them by the group separator. Characters that are not allowed in keys (spaces, '=',
+// '"' and control or invalid characters) are replaced by underscores, and empty keys are written as "_".
+//
+// Values are written bare if they are non-empty and only consist of printable characters other than spaces, '=', '"'
+// and '\'. All the other values are quoted and escaped like Go string literals, as done by strconv.Quote.
+type LogfmtHandler struct {
+	opts LogfmtHandlerOpts
+	mu   *sync.Mutex
+	w    io.Writer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the LogfmtHandler handles records at the given level.
+func (h *LogfmtHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as a logfmt line and writes it.
+func (h *LogfmtHandler) Handle(_ context.Context, record slog.Record) error {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+	var b []byte
+
+	// Add the built-in attributes, unless they have been removed
+	if !record.Time.IsZero() {
+		b = appendLogfmtAttr(b, replaceBuiltin(replace, slog.Time(slog.TimeKey, record.Time)))
+	}
+	b = appendLogfmtAttr(b, replaceBuiltin(replace, slog.Any(slog.LevelKey, record.Level)))
+	if h.opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			b = appendLogfmtAttr(b, replaceBuiltin(replace, slog.Any(slog.SourceKey, source)))
+		}
+	}
+	b = appendLogfmtAttr(b, replaceBuiltin(replace, slog.String(slog.MessageKey, record.Message)))
+
+	// Add the attributes, flattening the groups
+	var attrs []slog.Attr
+	flattenAttrs(
+		"", h.opts.GroupSeparator, collectAttrs(h.goas, record, replace),
+		func(key string, value slog.Value) { attrs = append(attrs, slog.Attr{Key: key, Value: value}) },
+	)
+	if h.opts.SortKeys {
+		sort.SliceStable(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	}
+	for _, attr := range attrs {
+		b = appendLogfmtAttr(b, attr)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(append(b, '\n'))
+	return err
+}
+
+// WithAttrs returns a new LogfmtHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *LogfmtHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &LogfmtHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new LogfmtHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *LogfmtHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &LogfmtHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// appendLogfmtAttr appends an attribute as a key=value pair, preceded by a space if it isn't the first one. Empty
+// attributes are skipped.
+func appendLogfmtAttr(b []byte, attr slog.Attr) []byte {
+	if attr.Equal(slog.Attr{}) {
+		return b
+	}
+	if len(b) > 0 {
+		b = append(b, ' ')
+	}
+	b = appendLogfmtKey(b, attr.Key)
+	b = append(b, '=')
+	return appendLogfmtValue(b, logfmtValueString(attr.Value.Resolve()))
+}
+
+// appendLogfmtKey appends a key, replacing the characters that are not allowed in keys by underscores.
+func appendLogfmtKey(b []byte, key string) []byte {
+	if key == "" {
+		return append(b, '_')
+	}
+	for _, r := range key {
+		if !logfmtBareRune(r) || r == utf8.RuneError {
+			r = '_'
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	return b
+}
+
+// appendLogfmtValue appends a value, quoting it if it can't be written bare.
+func appendLogfmtValue(b []byte, value string) []byte {
+	if logfmtNeedsQuoting(value) {
+		return strconv.AppendQuote(b, value)
+	}
+	return append(b, value...)
+}
+
+// logfmtNeedsQuoting reports whether a value has to be quoted.
+func logfmtNeedsQuoting(value string) bool {
+	if value == "" || !utf8.ValidString(value) {
+		return true
+	}
+	for _, r := range value {
+		if !logfmtBareRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// logfmtBareRune reports whether a rune can be written in a key or an unquoted value.
+func logfmtBareRune(r rune) bool {
+	return r != '=' && r != '"' && r != '\\' && !unicode.IsSpace(r) && unicode.IsPrint(r)
+}
+
+// logfmtValueString converts a resolved value into the string it is written as.
+func logfmtValueString(value slog.Value) string {
+	switch value.Kind() {
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if source, ok := value.Any().(*slog.Source); ok {
+			return fmt.Sprintf("%s:%d", source.File, source.Line)
+		}
+		return valueToString(value)
+	default:
+		return valueToString(value)
+	}
+}
+
+// ParseLogfmt parses a logfmt line, like the ones written by the LogfmtHandler, into its key=value pairs, in the
+// order they appear in the line. All the values are strings, with quoted values unquoted. Keys without a value, i.e.
+// without an '=' after them, have an empty value.
+func ParseLogfmt(line string) ([]slog.Attr, error) {
+	var attrs []slog.Attr
+	line = strings.TrimRight(line, "\r\n")
+
+	for i := 0; i < len(line); {
+		// Skip the spaces between pairs
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		// Read the key, up to the '=' or the next space
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			if line[i] == '"' {
+				return nil, fmt.Errorf("loggy: unexpected quote in logfmt key at offset %d", i)
+			}
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("loggy: missing logfmt key at offset %d", i)
+		}
+		if i == len(line) || line[i] != '=' {
+			attrs = append(attrs, slog.String(key, ""))
+			continue
+		}
+		i++
+
+		// Read a bare value, up to the next space
+		if i == len(line) || line[i] != '"' {
+			start = i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			attrs = append(attrs, slog.String(key, line[start:i]))
+			continue
+		}
+
+		// Read a quoted value, up to the closing quote that isn't escaped
+		start = i
+		i++
+		for i < len(line) && line[i] != '"' {
+			if line[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(line) {
+			return nil, errors.New("loggy: unterminated quoted logfmt value")
+		}
+		i++
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			return nil, fmt.Errorf("loggy: unexpected character after quoted logfmt value at offset %d", i)
+		}
+
+		value, err := strconv.Unquote(line[start:i])
+		if err != nil {
+			return nil, fmt.Errorf("loggy: invalid quoted logfmt value for key %q: %w", key, err)
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+
+	return attrs, nil
+}
+
+// NewLogfmtHandler returns a LogfmtHandler that writes records to w as logfmt lines.
+func NewLogfmtHandler(w io.Writer, options ...LogfmtHandlerOpts) *LogfmtHandler {
+	// If options are provided, assign the first option to opts
+	var opts LogfmtHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.GroupSeparator == "" {
+		opts.GroupSeparator = "."
+	}
+
+	return &LogfmtHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
@@ -0,0 +1,149 @@
+package loggy_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// attrStrings converts attributes into key=value strings, so that they can be compared.
+func attrStrings(attrs []slog.Attr) []string {
+	strs := make([]string, len(attrs))
+	for i, attr := range attrs {
+		strs[i] = attr.String()
+	}
+	return strs
+}
+
+// TestNewLogfmtHandler tests the LogfmtHandler returned by NewLogfmtHandler with values that need to be quoted and
+// keys that need to be sanitised, along with nested groups.
+func TestNewLogfmtHandler(t *testing.T) {
+	// Create a logger that writes logfmt lines to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewLogfmtHandler(
+		&outputStream, loggy.LogfmtHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime}},
+	)
+	logger := slog.New(handler).With("service", "api").WithGroup("request")
+
+	// Log a record with all sorts of values
+	logger.Info(
+		"this is a test log",
+		"path", "/users/42",
+		"query", "a=b",
+		"body", "line 1\nline 2",
+		"quote", `say "hi"`,
+		"empty", "",
+		"emoji", "🙂",
+		"bell", "\a",
+		"my key", 1,
+		slog.Group("user", "id", 42, "admin", true),
+	)
+
+	// Check the output
+	expectedOutput := "level=INFO msg=\"this is a test log\" service=api request.path=/users/42 " +
+		"request.query=\"a=b\" request.body=\"line 1\\nline 2\" request.quote=\"say \\\"hi\\\"\" request.empty=\"\" " +
+		"request.emoji=🙂 request.bell=\"\\a\" request.my_key=1 request.user.id=42 request.user.admin=true\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+}
+
+// TestNewLogfmtHandler_Opts tests the LogfmtHandler returned by NewLogfmtHandler with sorted keys and a custom group
+// separator.
+func TestNewLogfmtHandler_Opts(t *testing.T) {
+	// Create a logger that writes logfmt lines with sorted keys to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewLogfmtHandler(
+		&outputStream,
+		loggy.LogfmtHandlerOpts{
+			GroupSeparator: "_",
+			SortKeys:       true,
+			HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime},
+		},
+	)
+
+	// Log a record with unsorted attributes
+	slog.New(handler).Warn("this is a test log", "b", 2, slog.Group("a", "y", 1, "x", 0), "c", 3)
+
+	// Check the output
+	assert.Equal(t, "level=WARN msg=\"this is a test log\" a_x=0 a_y=1 b=2 c=3\n", outputStream.String())
+}
+
+// TestParseLogfmt tests the ParseLogfmt function with a line written by the LogfmtHandler, which should be parsed
+// back into the same keys and values.
+func TestParseLogfmt(t *testing.T) {
+	// Create a logger that writes logfmt lines to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewLogfmtHandler(
+		&outputStream, loggy.LogfmtHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime}},
+	)
+
+	// Log a record with values that need to be quoted
+	slog.New(handler).Error(
+		"this is a test log", "body", "line 1\nline 2\t\"quoted\" \\", "empty", "", "invalid", "\xff", "n", 1.5,
+	)
+
+	// Parse the line
+	attrs, err := loggy.ParseLogfmt(outputStream.String())
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{
+			"level=ERROR",
+			"msg=this is a test log",
+			"body=line 1\nline 2\t\"quoted\" \\",
+			"empty=",
+			"invalid=\xff",
+			"n=1.5",
+		},
+		attrStrings(attrs),
+	)
+}
+
+// TestParseLogfmt_Invalid tests the ParseLogfmt function with lines that are not valid logfmt.
+func TestParseLogfmt_Invalid(t *testing.T) {
+	for _, line := range []string{
+		`msg="unterminated`,
+		`msg="trailing"garbage`,
+		`"key"=value`,
+		`=value`,
+		`msg="\q"`,
+	} {
+		_, err := loggy.ParseLogfmt(line)
+		assert.Error(t, err, line)
+	}
+
+	// Keys without values are allowed
+	attrs, err := loggy.ParseLogfmt("debug level=INFO")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"debug=", "level=INFO"}, attrStrings(attrs))
+}
+
+// TestNewConsoleLogHandler_Logfmt tests the NewConsoleLogHandler function with the logfmt format, which should
+// colourise the output according to the level.
+func TestNewConsoleLogHandler_Logfmt(t *testing.T) {
+	// Capture the console output
+	output, err := captureConsoleOutput(
+		t, true, func() {
+			// Initialize the logger with the logfmt format
+			opts := loggy.ConsoleLogWriterOpts{LogToStdout: true, Format: loggy.ConsoleFormatLogfmt}
+			initializeLogger(opts)
+
+			// Log an error message
+			slog.Error("this is a test log", "body", "a\nb")
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Define the expected output
+	expectedOutput := color.New(color.FgRed).Sprint("level=ERROR msg=\"this is a test log\" body=\"a\\nb\"\n")
+
+	// Assert that the output matches the expected output
+	assert.Equal(t, expectedOutput, output)
+}
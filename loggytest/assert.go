@@ -0,0 +1,72 @@
+package loggytest
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// AssertLogged asserts that the Recorder has stored at least one record with the given level, message and
+// attributes, as done by Record.Matches. If it hasn't, the test is marked as failed with the records that were stored,
+// and AssertLogged returns false.
+func AssertLogged(t testing.TB, r *Recorder, level slog.Level, msg string, args ...any) bool {
+	t.Helper()
+
+	if len(r.Find(level, msg, args...)) > 0 {
+		return true
+	}
+	t.Errorf("expected a record matching %s, got:\n%s", describeRecord(level, msg, args), describeRecords(r.Records()))
+	return false
+}
+
+// AssertNotLogged asserts that the Recorder hasn't stored any record with the given level, message and attributes, as
+// done by Record.Matches. If it has, the test is marked as failed with the matching records, and AssertNotLogged
+// returns false.
+func AssertNotLogged(t testing.TB, r *Recorder, level slog.Level, msg string, args ...any) bool {
+	t.Helper()
+
+	found := r.Find(level, msg, args...)
+	if len(found) == 0 {
+		return true
+	}
+	t.Errorf("expected no record matching %s, got:\n%s", describeRecord(level, msg, args), describeRecords(found))
+	return false
+}
+
+// AssertCount asserts that the Recorder has stored exactly n records at the given level. If it hasn't, the test is
+// marked as failed with the records that were stored, and AssertCount returns false.
+func AssertCount(t testing.TB, r *Recorder, level slog.Level, n int) bool {
+	t.Helper()
+
+	records := r.Records()
+	count := 0
+	for _, record := range records {
+		if record.Level == level {
+			count++
+		}
+	}
+	if count == n {
+		return true
+	}
+	t.Errorf("expected %d records at %s, got %d:\n%s", n, level, count, describeRecords(records))
+	return false
+}
+
+// describeRecord describes the record that an assertion looks for.
+func describeRecord(level slog.Level, msg string, args []any) string {
+	return Record{Level: level, Message: msg, Attrs: argsToValues(args)}.String()
+}
+
+// describeRecords lists records, one per line.
+func describeRecords(records []Record) string {
+	if len(records) == 0 {
+		return "\t(no records)"
+	}
+
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[i] = fmt.Sprintf("\t%s", record)
+	}
+	return strings.Join(lines, "\n")
+}
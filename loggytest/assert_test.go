@@ -0,0 +1,92 @@
+package loggytest_test
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy/loggytest"
+)
+
+// fakeTB is a testing.TB that records the failures and logs of a test, so that the helpers can be tested failing.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	logs     []string
+	cleanups []func()
+}
+
+// Helper does nothing.
+func (f *fakeTB) Helper() {}
+
+// Errorf records a failure.
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+// Log records a log.
+func (f *fakeTB) Log(args ...any) {
+	f.logs = append(f.logs, fmt.Sprint(args...))
+}
+
+// Cleanup records a function to be called when the test finishes.
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// finish calls the cleanup functions, as done when a test finishes.
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+// TestAssertLogged tests the AssertLogged function, which should fail with the stored records if none of them match.
+func TestAssertLogged(t *testing.T) {
+	recorder := loggytest.NewRecorder()
+	recorder.Logger().Warn("disk almost full", "free", 10)
+
+	// A matching record
+	tb := &fakeTB{}
+	assert.True(t, loggytest.AssertLogged(tb, recorder, slog.LevelWarn, "disk almost full", "free", 10))
+	assert.Empty(t, tb.errors)
+
+	// A record with a different attribute
+	assert.False(t, loggytest.AssertLogged(tb, recorder, slog.LevelWarn, "disk almost full", "free", 5))
+	assert.Equal(
+		t,
+		[]string{
+			"expected a record matching level=WARN msg=\"disk almost full\" free=5, got:\n" +
+				"\tlevel=WARN msg=\"disk almost full\" free=10",
+		},
+		tb.errors,
+	)
+}
+
+// TestAssertNotLogged tests the AssertNotLogged function, which should fail with the matching records if there are
+// any.
+func TestAssertNotLogged(t *testing.T) {
+	recorder := loggytest.NewRecorder()
+	recorder.Logger().Error("failed", "attempt", 1)
+
+	tb := &fakeTB{}
+	assert.True(t, loggytest.AssertNotLogged(tb, recorder, slog.LevelError, "failed", "attempt", 2))
+	assert.False(t, loggytest.AssertNotLogged(tb, recorder, slog.LevelError, "failed"))
+	assert.Equal(
+		t,
+		[]string{"expected no record matching level=ERROR msg=\"failed\", got:\n\tlevel=ERROR msg=\"failed\" attempt=1"},
+		tb.errors,
+	)
+}
+
+// TestAssertCount tests the AssertCount function, which should fail if the number of records at a level is different.
+func TestAssertCount(t *testing.T) {
+	recorder := loggytest.NewRecorder()
+
+	tb := &fakeTB{}
+	assert.True(t, loggytest.AssertCount(tb, recorder, slog.LevelInfo, 0))
+	assert.False(t, loggytest.AssertCount(tb, recorder, slog.LevelInfo, 1))
+	assert.Equal(t, []string{"expected 1 records at INFO, got 0:\n\t(no records)"}, tb.errors)
+}
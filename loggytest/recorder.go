@@ -0,0 +1,234 @@
+// Package loggytest provides handlers for testing code that logs with log/slog: a Recorder that stores structured
+// records along with assertion helpers for them, and a handler that writes records to the log of a test.
+package loggytest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a record stored by a Recorder.
+type Record struct {
+	// Time is the time of the record.
+	Time time.Time
+
+	// Level is the level of the record.
+	Level slog.Level
+
+	// Message is the message of the record.
+	Message string
+
+	// Attrs are the resolved attributes of the record, including the ones added to the handler it was logged with.
+	// The keys of attributes in groups are their paths, with the keys of the groups and the attribute joined with dots,
+	// e.g. "user.id".
+	Attrs map[string]slog.Value
+}
+
+// Attr returns the value of the attribute with the given path, and whether the record has it.
+func (r Record) Attr(key string) (slog.Value, bool) {
+	value, ok := r.Attrs[key]
+	return value, ok
+}
+
+// String returns the record as a line of text, with its attributes sorted by their keys.
+func (r Record) String() string {
+	keys := make([]string, 0, len(r.Attrs))
+	for key := range r.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "level=%s msg=%q", r.Level, r.Message)
+	for _, key := range keys {
+		fmt.Fprintf(&builder, " %s=%v", key, r.Attrs[key])
+	}
+	return builder.String()
+}
+
+// Matches reports whether the record has the given level and message, and all the given attributes. The attributes
+// are given as alternating keys and values, or as slog.Attrs, like the arguments of slog.Logger.Log. Values are
+// compared after being converted to slog.Values, so that e.g. an int matches an int64 attribute.
+func (r Record) Matches(level slog.Level, msg string, args ...any) bool {
+	if r.Level != level || r.Message != msg {
+		return false
+	}
+
+	for key, expected := range argsToValues(args) {
+		actual, ok := r.Attrs[key]
+		if !ok || !actual.Equal(expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// recorderState is the state shared between a Recorder and the handlers derived from it.
+type recorderState struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// RecorderOpts represents the options for configuring the behaviour of the `Recorder`.
+type RecorderOpts struct {
+	// Level is the minimum level of the records that are stored. By default, it is slog.LevelDebug, so that all
+	// records are stored.
+	Level slog.Leveler
+}
+
+// Recorder is a handler that stores the records logged with it, so that tests can make assertions about them instead
+// of capturing and parsing the output of another handler. Handlers derived from a Recorder with WithAttrs and
+// WithGroup store their records in the same Recorder.
+type Recorder struct {
+	opts   RecorderOpts
+	state  *recorderState
+	prefix string
+	attrs  map[string]slog.Value
+}
+
+// Enabled reports whether the Recorder stores records at the given level.
+func (r *Recorder) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= r.opts.Level.Level()
+}
+
+// Handle stores the record.
+func (r *Recorder) Handle(_ context.Context, record slog.Record) error {
+	stored := Record{
+		Time:    record.Time,
+		Level:   record.Level,
+		Message: record.Message,
+		Attrs:   make(map[string]slog.Value, len(r.attrs)+record.NumAttrs()),
+	}
+	for key, value := range r.attrs {
+		stored.Attrs[key] = value
+	}
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			addAttr(stored.Attrs, r.prefix, attr)
+			return true
+		},
+	)
+
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	r.state.records = append(r.state.records, stored)
+	return nil
+}
+
+// WithAttrs returns a new Recorder whose attributes consist of both the receiver's attributes and the arguments. It
+// stores records in the same place as the receiver.
+func (r *Recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return r
+	}
+
+	newAttrs := make(map[string]slog.Value, len(r.attrs)+len(attrs))
+	for key, value := range r.attrs {
+		newAttrs[key] = value
+	}
+	for _, attr := range attrs {
+		addAttr(newAttrs, r.prefix, attr)
+	}
+	return &Recorder{opts: r.opts, state: r.state, prefix: r.prefix, attrs: newAttrs}
+}
+
+// WithGroup returns a new Recorder with the given group appended to the receiver's existing groups. It stores records
+// in the same place as the receiver.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (r *Recorder) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return r
+	}
+	return &Recorder{opts: r.opts, state: r.state, prefix: r.prefix + name + ".", attrs: r.attrs}
+}
+
+// Records returns the records stored so far, in the order they were logged.
+func (r *Recorder) Records() []Record {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	return append([]Record(nil), r.state.records...)
+}
+
+// Find returns the stored records that match the given level, message and attributes, as done by Record.Matches.
+func (r *Recorder) Find(level slog.Level, msg string, args ...any) []Record {
+	var found []Record
+	for _, record := range r.Records() {
+		if record.Matches(level, msg, args...) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// Reset removes all the stored records.
+func (r *Recorder) Reset() {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	r.state.records = nil
+}
+
+// Logger returns a logger that logs to the Recorder.
+func (r *Recorder) Logger() *slog.Logger {
+	return slog.New(r)
+}
+
+// addAttr resolves an attribute and stores it in attrs under its path, storing the attributes of groups under their
+// own paths. Empty attributes and groups are dropped, and groups with empty keys are inlined, as done by the handlers
+// of the log/slog package.
+func addAttr(attrs map[string]slog.Value, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix = prefix + attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			addAttr(attrs, groupPrefix, groupAttr)
+		}
+		return
+	}
+
+	attrs[prefix+attr.Key] = attr.Value
+}
+
+// argsToValues converts alternating keys and values, and slog.Attrs, into values stored under their paths, the same
+// way that slog.Logger.Log converts its arguments into attributes.
+func argsToValues(args []any) map[string]slog.Value {
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+
+	values := make(map[string]slog.Value, record.NumAttrs())
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			addAttr(values, "", attr)
+			return true
+		},
+	)
+	return values
+}
+
+// NewRecorder returns a Recorder that stores the records logged with it.
+func NewRecorder(options ...RecorderOpts) *Recorder {
+	// If options are provided, assign the first option to opts
+	var opts RecorderOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Level == nil {
+		opts.Level = slog.LevelDebug
+	}
+
+	return &Recorder{opts: opts, state: &recorderState{}}
+}
@@ -0,0 +1,110 @@
+package loggytest_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy/loggytest"
+)
+
+// userValue is a slog.LogValuer, used to test that values are resolved.
+type userValue struct {
+	id int
+}
+
+// LogValue returns the user as a group.
+func (u userValue) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("id", u.id), slog.String("name", "ada"))
+}
+
+// TestNewRecorder tests the Recorder returned by NewRecorder, which should store records with their attributes
+// resolved and keyed by their paths.
+func TestNewRecorder(t *testing.T) {
+	// Log records with attributes in groups, inline groups and LogValuers
+	recorder := loggytest.NewRecorder()
+	logger := recorder.Logger().With("service", "api").WithGroup("request")
+	logger.Debug("loading user", "user", userValue{id: 42}, slog.Group("", "inline", true), slog.Group("empty"))
+	logger.Warn("slow", "duration", time.Second)
+
+	// Check the stored records
+	records := recorder.Records()
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	assert.Equal(t, slog.LevelDebug, records[0].Level)
+	assert.Equal(t, "loading user", records[0].Message)
+	assert.False(t, records[0].Time.IsZero())
+	assert.Equal(
+		t,
+		map[string]slog.Value{
+			"service":           slog.StringValue("api"),
+			"request.user.id":   slog.Int64Value(42),
+			"request.user.name": slog.StringValue("ada"),
+			"request.inline":    slog.BoolValue(true),
+		},
+		records[0].Attrs,
+	)
+	value, ok := records[1].Attr("request.duration")
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, value.Duration())
+	assert.Equal(t, `level=WARN msg="slow" request.duration=1s service=api`, records[1].String())
+
+	// Check that records can be found by their attributes
+	assert.Len(t, recorder.Find(slog.LevelDebug, "loading user", slog.Group("request", "user", userValue{42})), 1)
+	assert.Len(t, recorder.Find(slog.LevelDebug, "loading user", "request.user.id", 42), 1)
+	assert.Len(t, recorder.Find(slog.LevelDebug, "loading user", "request.user.id", 43), 0)
+	assert.Len(t, recorder.Find(slog.LevelInfo, "loading user"), 0)
+
+	// Check that resetting removes the records
+	recorder.Reset()
+	assert.Empty(t, recorder.Records())
+}
+
+// TestNewRecorder_Level tests the Recorder returned by NewRecorder with a minimum level.
+func TestNewRecorder_Level(t *testing.T) {
+	recorder := loggytest.NewRecorder(loggytest.RecorderOpts{Level: slog.LevelWarn})
+	logger := recorder.Logger()
+	logger.Info("ignored")
+	logger.Error("stored")
+
+	records := recorder.Records()
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "stored", records[0].Message)
+	}
+}
+
+// TestRecorder_Conformance tests the Recorder returned by NewRecorder with slogtest, with the paths of the attributes
+// of the stored records split back into groups.
+func TestRecorder_Conformance(t *testing.T) {
+	recorder := loggytest.NewRecorder()
+	err := slogtest.TestHandler(
+		recorder, func() []map[string]any {
+			var results []map[string]any
+			for _, record := range recorder.Records() {
+				result := map[string]any{slog.LevelKey: record.Level, slog.MessageKey: record.Message}
+				if !record.Time.IsZero() {
+					result[slog.TimeKey] = record.Time
+				}
+				for key, value := range record.Attrs {
+					path := strings.Split(key, ".")
+					group := result
+					for _, name := range path[:len(path)-1] {
+						if _, ok := group[name].(map[string]any); !ok {
+							group[name] = map[string]any{}
+						}
+						group = group[name].(map[string]any)
+					}
+					group[path[len(path)-1]] = value.Any()
+				}
+				results = append(results, result)
+			}
+			return results
+		},
+	)
+	assert.NoError(t, err)
+}
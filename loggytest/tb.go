@@ -0,0 +1,58 @@
+package loggytest
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tbState tracks whether the test that a tbWriter logs to has finished.
+type tbState struct {
+	mu   sync.Mutex
+	done bool
+}
+
+// tbWriter is a writer that logs every write to a test.
+type tbWriter struct {
+	t     testing.TB
+	state *tbState
+}
+
+// Write logs p to the test, without the trailing newline, unless the test has finished.
+func (w tbWriter) Write(p []byte) (int, error) {
+	// Logging after a test has finished panics, which can happen when goroutines started by the test outlive it. The
+	// lock is held while logging, so that the test can't finish between checking and logging.
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+	if !w.state.done {
+		w.t.Helper()
+		w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
+	return len(p), nil
+}
+
+// NewTBHandler returns a handler that writes records to the log of a test with t.Log, as lines of text written by
+// slog.TextHandler, so that they are shown along with the test that logged them when it fails or runs verbosely.
+// Records logged after the test has finished are dropped. If opts is nil, records at all levels are logged.
+func NewTBHandler(t testing.TB, opts *slog.HandlerOptions) slog.Handler {
+	if opts == nil {
+		opts = &slog.HandlerOptions{Level: slog.LevelDebug}
+	}
+
+	state := &tbState{}
+	t.Cleanup(
+		func() {
+			state.mu.Lock()
+			defer state.mu.Unlock()
+			state.done = true
+		},
+	)
+
+	return slog.NewTextHandler(tbWriter{t: t, state: state}, opts)
+}
+
+// NewTBLogger returns a logger that writes records at all levels to the log of a test. See NewTBHandler.
+func NewTBLogger(t testing.TB) *slog.Logger {
+	return slog.New(NewTBHandler(t, nil))
+}
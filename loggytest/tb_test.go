@@ -0,0 +1,76 @@
+package loggytest_test
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy/loggytest"
+)
+
+// removeTime removes the time from records, so that the output is predictable.
+func removeTime(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 && attr.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return attr
+}
+
+// TestNewTBHandler tests the handler returned by NewTBHandler, which should log every record to the test until it has
+// finished.
+func TestNewTBHandler(t *testing.T) {
+	tb := &fakeTB{}
+	logger := slog.New(loggytest.NewTBHandler(tb, &slog.HandlerOptions{ReplaceAttr: removeTime})).With("id", 1)
+
+	// Log records while the test is running, and after it has finished
+	logger.Debug("ignored")
+	logger.Info("running")
+	tb.finish()
+	logger.Info("finished")
+
+	assert.Equal(t, []string{"level=INFO msg=running id=1"}, tb.logs)
+}
+
+// TestNewTBLogger tests the logger returned by NewTBLogger, which should log records at all levels.
+func TestNewTBLogger(t *testing.T) {
+	tb := &fakeTB{}
+	loggytest.NewTBLogger(tb).Debug("debugging")
+
+	if assert.Len(t, tb.logs, 1) {
+		assert.Contains(t, tb.logs[0], "level=DEBUG msg=debugging")
+	}
+}
+
+// TestNewTBLogger_Goroutine tests the logger returned by NewTBLogger with a goroutine that keeps logging while the
+// test finishes, which should drop the records logged afterwards instead of panicking.
+func TestNewTBLogger_Goroutine(t *testing.T) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	// Start logging in a goroutine that outlives the subtest
+	t.Run(
+		"subtest", func(t *testing.T) {
+			logger := loggytest.NewTBLogger(t)
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						logger.Info("still running")
+						time.Sleep(100 * time.Microsecond)
+					}
+				}
+			}()
+			time.Sleep(10 * time.Millisecond)
+		},
+	)
+
+	// Keep logging for a while after the subtest has finished
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-stopped
+}
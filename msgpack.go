@@ -0,0 +1,544 @@
+package loggy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// msgpackExtTimestamp is the extension type that MessagePack reserves for timestamps.
+const msgpackExtTimestamp = -1
+
+// appendMsgpackNil appends a MessagePack nil to b.
+func appendMsgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+// appendMsgpackBool appends a MessagePack boolean to b.
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+// appendMsgpackInt appends a MessagePack integer to b, using the smallest encoding that fits it.
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+// appendMsgpackUint appends a MessagePack unsigned integer to b, using the smallest encoding that fits it.
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+// appendMsgpackFloat appends a MessagePack 64-bit float to b.
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+// appendMsgpackString appends a MessagePack string to b.
+func appendMsgpackString(b []byte, v string) []byte {
+	switch n := len(v); {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, v...)
+}
+
+// appendMsgpackBinary appends MessagePack binary data to b.
+func appendMsgpackBinary(b []byte, v []byte) []byte {
+	switch n := len(v); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, v...)
+}
+
+// appendMsgpackArrayHeader appends the header of a MessagePack array with n elements to b.
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+// appendMsgpackMapHeader appends the header of a MessagePack map with n key-value pairs to b.
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// appendMsgpackExt appends a MessagePack extension of the given type to b.
+func appendMsgpackExt(b []byte, extType int8, data []byte) []byte {
+	switch n := len(data); n {
+	case 1:
+		b = append(b, 0xd4)
+	case 2:
+		b = append(b, 0xd5)
+	case 4:
+		b = append(b, 0xd6)
+	case 8:
+		b = append(b, 0xd7)
+	case 16:
+		b = append(b, 0xd8)
+	default:
+		switch {
+		case n <= math.MaxUint8:
+			b = append(b, 0xc7, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xc8), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xc9), uint32(n))
+		}
+	}
+	b = append(b, byte(extType))
+	return append(b, data...)
+}
+
+// appendMsgpackAttrs appends resolved attributes to b as a MessagePack map, with groups as nested maps.
+func appendMsgpackAttrs(b []byte, attrs []slog.Attr, timeFunc func([]byte, time.Time) []byte) []byte {
+	b = appendMsgpackMapHeader(b, len(attrs))
+	for _, attr := range attrs {
+		b = appendMsgpackString(b, attr.Key)
+		b = appendMsgpackValue(b, attr.Value, timeFunc)
+	}
+	return b
+}
+
+// appendMsgpackValue appends a resolved slog.Value to b. Times are appended using timeFunc, as not every consumer of
+// MessagePack understands the timestamp extension.
+func appendMsgpackValue(b []byte, value slog.Value, timeFunc func([]byte, time.Time) []byte) []byte {
+	switch value.Kind() {
+	case slog.KindString:
+		return appendMsgpackString(b, value.String())
+	case slog.KindInt64:
+		return appendMsgpackInt(b, value.Int64())
+	case slog.KindUint64:
+		return appendMsgpackUint(b, value.Uint64())
+	case slog.KindFloat64:
+		return appendMsgpackFloat(b, value.Float64())
+	case slog.KindBool:
+		return appendMsgpackBool(b, value.Bool())
+	case slog.KindDuration:
+		return appendMsgpackInt(b, int64(value.Duration()))
+	case slog.KindTime:
+		return timeFunc(b, value.Time())
+	case slog.KindGroup:
+		return appendMsgpackAttrs(b, value.Group(), timeFunc)
+	}
+
+	// Values of any other kind are encoded as what they are closest to, with nil pointers to errors and fmt.Stringers
+	// encoded as "<nil>" since their methods usually can't be called on them
+	switch v := value.Any().(type) {
+	case nil:
+		return appendMsgpackNil(b)
+	case []byte:
+		return appendMsgpackBinary(b, v)
+	case error:
+		if isNilPointer(v) {
+			return appendMsgpackString(b, "<nil>")
+		}
+		return appendMsgpackString(b, v.Error())
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return appendMsgpackString(b, "<nil>")
+		}
+		return appendMsgpackString(b, v.String())
+	default:
+		return appendMsgpackString(b, fmt.Sprintf("%+v", v))
+	}
+}
+
+// appendMsgpackTime appends a time to b using the MessagePack timestamp extension, in the smallest of its formats that
+// fits it.
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		return appendMsgpackExt(b, msgpackExtTimestamp, binary.BigEndian.AppendUint32(nil, uint32(sec)))
+	case sec >= 0 && sec>>34 == 0:
+		return appendMsgpackExt(b, msgpackExtTimestamp, binary.BigEndian.AppendUint64(nil, nsec<<34|uint64(sec)))
+	default:
+		data := binary.BigEndian.AppendUint32(make([]byte, 0, 12), uint32(nsec))
+		return appendMsgpackExt(b, msgpackExtTimestamp, binary.BigEndian.AppendUint64(data, uint64(sec)))
+	}
+}
+
+// appendMsgpackRFC3339Time appends a time to b as an RFC 3339 string.
+func appendMsgpackRFC3339Time(b []byte, t time.Time) []byte {
+	return appendMsgpackString(b, t.Format(time.RFC3339Nano))
+}
+
+// msgpackExt is a decoded MessagePack extension that isn't a timestamp.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackReader is the reader that MessagePack values are decoded from.
+type msgpackReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// decodeMsgpack decodes a single MessagePack value from r.
+//
+// Maps are decoded into map[string]any, arrays into []any, integers into int64 or uint64, floats into float64,
+// timestamps into time.Time and any other extensions into msgpackExt.
+func decodeMsgpack(r msgpackReader) (any, error) {
+	return decodeMsgpackValue(r, 0)
+}
+
+// decodeMsgpackValue decodes a single MessagePack value from r, nested in depth maps or arrays.
+func decodeMsgpackValue(r msgpackReader, depth int) (any, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return decodeMsgpackMap(r, int(code&0x0f), depth)
+	case code&0xf0 == 0x90:
+		return decodeMsgpackArray(r, int(code&0x0f), depth)
+	case code&0xe0 == 0xa0:
+		data, err := readMsgpackBytes(r, int(code&0x1f))
+		return string(data), err
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLength(r, code-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readMsgpackLength(r, code-0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackExt(r, n)
+	case 0xca:
+		data, err := readMsgpackBytes(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 0xcb:
+		data, err := readMsgpackBytes(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		data, err := readMsgpackBytes(r, 1<<(code-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackUint(data), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		data, err := readMsgpackBytes(r, 1<<(code-0xd0))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackInt(data), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeMsgpackExt(r, 1<<(code-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, code-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readMsgpackBytes(r, n)
+		return string(data), err
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, code-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, code-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, n, depth)
+	}
+
+	return nil, fmt.Errorf("loggy: invalid MessagePack code 0x%x", code)
+}
+
+// decodeMsgpackAttrs decodes a MessagePack map into attributes, keeping the order of its keys, with nested maps as
+// groups. r must support unreading the last byte that was read.
+func decodeMsgpackAttrs(r binaryReader) ([]slog.Attr, error) {
+	return decodeMsgpackGroup(r, 0)
+}
+
+// decodeMsgpackGroup decodes a MessagePack map nested in depth maps into attributes, like decodeMsgpackAttrs.
+func decodeMsgpackGroup(r binaryReader, depth int) ([]slog.Attr, error) {
+	if err := checkBinaryDepth(depth); err != nil {
+		return nil, err
+	}
+
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the size of the map
+	var n int
+	switch {
+	case code&0xf0 == 0x80:
+		n = int(code & 0x0f)
+	case code == 0xde, code == 0xdf:
+		if n, err = readMsgpackLength(r, code-0xde+1); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("loggy: expected a MessagePack map, got code 0x%x", code)
+	}
+
+	if err := checkBinaryLength(r, uint64(n)); err != nil {
+		return nil, err
+	}
+
+	attrs := make([]slog.Attr, 0, min(n, binaryMaxPrealloc))
+	for i := 0; i < n; i++ {
+		key, err := decodeMsgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Peek at the value to decode maps as groups
+		code, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.UnreadByte(); err != nil {
+			return nil, err
+		}
+
+		var value slog.Value
+		if code&0xf0 == 0x80 || code == 0xde || code == 0xdf {
+			groupAttrs, err := decodeMsgpackGroup(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value = slog.GroupValue(groupAttrs...)
+		} else {
+			v, err := decodeMsgpackValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value = binaryValue(v)
+		}
+		attrs = append(attrs, slog.Attr{Key: fmt.Sprint(key), Value: value})
+	}
+
+	return attrs, nil
+}
+
+// decodeMsgpackMap decodes a MessagePack map with n key-value pairs, nested in depth maps or arrays. Keys that aren't
+// strings are formatted as strings.
+func decodeMsgpackMap(r msgpackReader, n int, depth int) (map[string]any, error) {
+	if err := checkBinaryDepth(depth); err != nil {
+		return nil, err
+	}
+	if err := checkBinaryLength(r, uint64(n)); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any, min(n, binaryMaxPrealloc))
+	for i := 0; i < n; i++ {
+		key, err := decodeMsgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeMsgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		if keyString, ok := key.(string); ok {
+			m[keyString] = value
+		} else {
+			m[fmt.Sprint(key)] = value
+		}
+	}
+	return m, nil
+}
+
+// decodeMsgpackArray decodes a MessagePack array with n elements, nested in depth maps or arrays.
+func decodeMsgpackArray(r msgpackReader, n int, depth int) ([]any, error) {
+	if err := checkBinaryDepth(depth); err != nil {
+		return nil, err
+	}
+	if err := checkBinaryLength(r, uint64(n)); err != nil {
+		return nil, err
+	}
+
+	a := make([]any, 0, min(n, binaryMaxPrealloc))
+	for i := 0; i < n; i++ {
+		value, err := decodeMsgpackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, value)
+	}
+	return a, nil
+}
+
+// decodeMsgpackExt decodes the type and n bytes of data of a MessagePack extension, turning timestamps into times.
+func decodeMsgpackExt(r msgpackReader, n int) (any, error) {
+	extType, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readMsgpackBytes(r, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(extType) != msgpackExtTimestamp {
+		return msgpackExt{Type: int8(extType), Data: data}, nil
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		value := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(value&0x3ffffffff), int64(value>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data[:4]))), nil
+	default:
+		return nil, errors.New("loggy: invalid MessagePack timestamp")
+	}
+}
+
+// readMsgpackLength reads a big-endian length of 1 << size bytes.
+func readMsgpackLength(r msgpackReader, size byte) (int, error) {
+	data, err := readMsgpackBytes(r, 1<<size)
+	if err != nil {
+		return 0, err
+	}
+	n := readMsgpackUint(data)
+	if n > math.MaxInt32 {
+		return 0, fmt.Errorf("loggy: MessagePack length of %d is too long", n)
+	}
+	return int(n), nil
+}
+
+// readMsgpackBytes reads exactly n bytes from r.
+func readMsgpackBytes(r msgpackReader, n int) ([]byte, error) {
+	if err := checkBinaryLength(r, uint64(n)); err != nil {
+		return nil, err
+	}
+
+	// Read long values from streams as they arrive, so that a corrupt length can't allocate more memory than the data
+	// that is actually there
+	if _, ok := r.(interface{ Len() int }); !ok && n > binaryMaxPrealloc {
+		data, err := io.ReadAll(io.LimitReader(r, int64(n)))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return data, nil
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readMsgpackUint reads a big-endian unsigned integer of 1, 2, 4 or 8 bytes.
+func readMsgpackUint(data []byte) uint64 {
+	switch len(data) {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data))
+	default:
+		return binary.BigEndian.Uint64(data)
+	}
+}
+
+// readMsgpackInt reads a big-endian signed integer of 1, 2, 4 or 8 bytes.
+func readMsgpackInt(data []byte) int64 {
+	switch len(data) {
+	case 1:
+		return int64(int8(data[0]))
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(data)))
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(data)))
+	default:
+		return int64(binary.BigEndian.Uint64(data))
+	}
+}
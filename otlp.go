@@ -0,0 +1,666 @@
+package loggy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OTLPEncoding is the encoding used for the requests sent to an OTLP/HTTP collector.
+type OTLPEncoding int
+
+const (
+	// OTLPEncodingProtobuf encodes requests as binary protocol buffers. This is the default.
+	OTLPEncodingProtobuf OTLPEncoding = iota
+	// OTLPEncodingJSON encodes requests as JSON, using the JSON mapping of the OTLP protocol buffers.
+	OTLPEncodingJSON
+)
+
+const (
+	// otlpDefaultEndpoint is the default URL of the logs endpoint of an OTLP/HTTP collector.
+	otlpDefaultEndpoint = "http://localhost:4318/v1/logs"
+
+	// otlpDefaultBatchSize is the default maximum number of records exported in a single request.
+	otlpDefaultBatchSize = 512
+
+	// otlpDefaultFlushInterval is the default interval at which buffered records are exported.
+	otlpDefaultFlushInterval = 5 * time.Second
+
+	// otlpDefaultMaxRetries is the default number of times a failed export is retried.
+	otlpDefaultMaxRetries = 5
+
+	// otlpDefaultRetryBackoff is the default time to wait before retrying a failed export for the first time.
+	otlpDefaultRetryBackoff = 500 * time.Millisecond
+
+	// otlpDefaultMaxRetryBackoff is the default maximum time to wait between retries.
+	otlpDefaultMaxRetryBackoff = 30 * time.Second
+
+	// otlpDefaultBufferLimit is the default maximum number of buffered records.
+	otlpDefaultBufferLimit = 8192
+
+	// otlpDefaultCloseTimeout is the default maximum time that Close spends exporting the buffered records.
+	otlpDefaultCloseTimeout = 10 * time.Second
+
+	// otlpScopeName is the name of the instrumentation scope that records are exported with.
+	otlpScopeName = "github.com/ksdfg/loggy"
+)
+
+// OTLPHandlerOpts represents the options for configuring the behaviour of the `OTLPHandler`.
+type OTLPHandlerOpts struct {
+	// Endpoint is the URL of the logs endpoint of the collector. By default, it is
+	// "http://localhost:4318/v1/logs".
+	Endpoint string
+
+	// Headers are added to every request sent to the collector, e.g. for authentication.
+	Headers map[string]string
+
+	// Encoding specifies how requests are encoded. By default, they are encoded as protocol buffers.
+	Encoding OTLPEncoding
+
+	// ServiceName is exported as the service.name resource attribute.
+	ServiceName string
+
+	// ResourceAttributes are exported as attributes of the resource that produced the records.
+	ResourceAttributes []slog.Attr
+
+	// TraceExtractors are used in order to find the trace and span IDs of a record in the context it was logged with.
+	// By default, only W3CTraceExtractor is used.
+	TraceExtractors []TraceExtractor
+
+	// BatchSize is the maximum number of records exported in a single request. Records are exported as soon as a
+	// batch is full. By default, it is 512.
+	BatchSize int
+
+	// FlushInterval is the interval at which buffered records are exported, even if the batch isn't full. By default,
+	// it is five seconds.
+	FlushInterval time.Duration
+
+	// MaxRetries is the number of times an export is retried if the collector is unavailable or throttling requests,
+	// before the batch is dropped. By default, it is 5. Set it to a negative number to disable retries.
+	MaxRetries int
+
+	// RetryBackoff is the time to wait before the first retry, which is doubled for every retry after it. If the
+	// collector responds with a Retry-After header, that is used instead. By default, it is 500 milliseconds.
+	RetryBackoff time.Duration
+
+	// MaxRetryBackoff is the maximum time to wait between retries. By default, it is 30 seconds.
+	MaxRetryBackoff time.Duration
+
+	// BufferLimit is the maximum number of records buffered while they are waiting to be exported, e.g. while an
+	// export is being retried. When the buffer is full, the oldest records are dropped. By default, it is 8192.
+	BufferLimit int
+
+	// CloseTimeout is the maximum time that Close spends exporting the buffered records, including retries, before
+	// they are dropped. By default, it is ten seconds. Use Shutdown to close the handler with a context instead.
+	CloseTimeout time.Duration
+
+	// Client is the HTTP client used to send requests. By default, a client with a ten second timeout is used.
+	Client *http.Client
+
+	// HandlerOptions contains additional options for the handler.
+	HandlerOptions slog.HandlerOptions
+}
+
+// otlpLogRecord is a record converted into the fields of an OTLP LogRecord, waiting to be exported.
+type otlpLogRecord struct {
+	timeUnixNano         uint64
+	observedTimeUnixNano uint64
+	severityNumber       int
+	severityText         string
+	body                 string
+	attrs                []slog.Attr
+	traceID              []byte
+	spanID               []byte
+	flags                uint32
+}
+
+// otlpExporter buffers records and exports them to the collector. It is shared between an OTLPHandler and all the
+// handlers derived from it.
+type otlpExporter struct {
+	opts OTLPHandlerOpts
+
+	// mu guards the buffered records, and whether the exporter has been closed
+	mu      sync.Mutex
+	records []otlpLogRecord
+	closed  bool
+
+	// sendMu ensures only one request is sent at a time. It isn't held while waiting to retry an export.
+	sendMu sync.Mutex
+
+	// ctx is cancelled once the exporter has been shut down, to stop the retries of exports in the background
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	flush     chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// OTLPHandler is a handler that exports records to an OpenTelemetry collector as OTLP LogRecords over HTTP.
+//
+// Records are buffered and exported in batches by a background goroutine, so Handle never waits for the network.
+type OTLPHandler struct {
+	exporter *otlpExporter
+	goas     []groupOrAttrs
+}
+
+// Enabled reports whether the OTLPHandler handles records at the given level.
+func (h *OTLPHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.exporter.opts.HandlerOptions.Level != nil {
+		minLevel = h.exporter.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle converts the record into an OTLP LogRecord and adds it to the buffer. If the batch is full, the background
+// goroutine is woken up to export it.
+func (h *OTLPHandler) Handle(ctx context.Context, record slog.Record) error {
+	opts := h.exporter.opts
+	replace := opts.HandlerOptions.ReplaceAttr
+
+	logRecord := otlpLogRecord{
+		observedTimeUnixNano: uint64(time.Now().UnixNano()),
+		severityNumber:       otlpSeverityNumber(record.Level),
+		severityText:         record.Level.String(),
+		body:                 record.Message,
+		attrs:                collectAttrs(h.goas, record, replace),
+	}
+
+	// Add the time of the record, unless it has been removed
+	if t, ok := replaceBuiltinTime(replace, record.Time); ok && !t.IsZero() {
+		logRecord.timeUnixNano = uint64(t.UnixNano())
+	}
+
+	// Add the source using the semantic conventions for code attributes
+	if opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			logRecord.attrs = append(
+				logRecord.attrs,
+				slog.String("code.function", source.Function),
+				slog.String("code.filepath", source.File),
+				slog.Int("code.lineno", source.Line),
+			)
+		}
+	}
+
+	// Add the trace and span IDs from the context
+	if tc, ok := extractTrace(ctx, opts.TraceExtractors); ok {
+		logRecord.traceID = tc.TraceID[:]
+		logRecord.spanID = tc.SpanID[:]
+		logRecord.flags = uint32(tc.Flags)
+	}
+
+	return h.exporter.add(logRecord)
+}
+
+// WithAttrs returns a new OTLPHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *OTLPHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &OTLPHandler{exporter: h.exporter, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new OTLPHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *OTLPHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &OTLPHandler{exporter: h.exporter, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// Flush exports all the buffered records, returning an error if any of the batches could not be exported.
+func (h *OTLPHandler) Flush() error {
+	return h.exporter.exportRecords(h.exporter.ctx)
+}
+
+// Close stops the background goroutine and exports the buffered records, giving up on them after the close timeout.
+// It is shared by all the handlers derived from this one, so none of them can be used after it is closed: records
+// handled afterwards are dropped, and ErrHandlerClosed is returned.
+func (h *OTLPHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.exporter.opts.CloseTimeout)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
+
+// Shutdown is like Close, but gives up on exporting the buffered records, and on retrying the export that is in
+// progress, when the context is done instead of after the close timeout.
+func (h *OTLPHandler) Shutdown(ctx context.Context) error {
+	e := h.exporter
+
+	var err error
+	e.closeOnce.Do(
+		func() {
+			e.mu.Lock()
+			e.closed = true
+			e.mu.Unlock()
+
+			// Stop retrying the export in progress once the context is done
+			stop := context.AfterFunc(ctx, e.cancel)
+			defer stop()
+			defer e.cancel()
+
+			close(e.done)
+			<-e.stopped
+			err = e.exportRecords(ctx)
+		},
+	)
+	return err
+}
+
+// add adds a record to the buffer, dropping the oldest record if the buffer is full, and wakes up the background
+// goroutine if a batch is ready to be exported. Records added after the exporter has been closed are dropped.
+func (e *otlpExporter) add(record otlpLogRecord) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return ErrHandlerClosed
+	}
+	if len(e.records) >= e.opts.BufferLimit {
+		e.records = e.records[1:]
+	}
+	e.records = append(e.records, record)
+	full := len(e.records) >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run exports the buffered records every flush interval, or as soon as a batch is full, until the exporter is closed.
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+
+		// Batches that fail are dropped after being retried, and there is nowhere to report the error
+		_ = e.exportRecords(e.ctx)
+	}
+}
+
+// exportRecords exports all the buffered records in batches, returning the errors of all the batches that could not
+// be exported. Retries stop when the context is done.
+func (e *otlpExporter) exportRecords(ctx context.Context) error {
+	// Take all the buffered records
+	e.mu.Lock()
+	records := e.records
+	e.records = nil
+	e.mu.Unlock()
+
+	var errs []error
+	for len(records) > 0 {
+		size := min(len(records), e.opts.BatchSize)
+		if err := e.export(ctx, records[:size]); err != nil {
+			errs = append(errs, err)
+		}
+		records = records[size:]
+	}
+
+	return errors.Join(errs...)
+}
+
+// export sends a batch of records to the collector, retrying with exponential backoff if the collector is unavailable
+// or throttling requests, until the context is done.
+func (e *otlpExporter) export(ctx context.Context, records []otlpLogRecord) error {
+	// Encode the request
+	var body []byte
+	var contentType string
+	switch e.opts.Encoding {
+	case OTLPEncodingJSON:
+		var err error
+		body, err = json.Marshal(e.jsonRequest(records))
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	default:
+		body = e.protobufRequest(records)
+		contentType = "application/x-protobuf"
+	}
+
+	backoff := e.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		// Send the request
+		retryAfter, err := e.send(ctx, body, contentType)
+		if err == nil {
+			return nil
+		}
+
+		// Give up if the error can't be retried, or there are no retries left
+		var retryable otlpRetryableError
+		if !errors.As(err, &retryable) || attempt >= e.opts.MaxRetries {
+			return err
+		}
+
+		// Wait for as long as the collector asked, or back off exponentially
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(min(wait, e.opts.MaxRetryBackoff))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		}
+		backoff = min(backoff*2, e.opts.MaxRetryBackoff)
+	}
+}
+
+// otlpRetryableError is an error of an export that can be retried.
+type otlpRetryableError struct {
+	err error
+}
+
+// Error returns the message of the underlying error.
+func (e otlpRetryableError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e otlpRetryableError) Unwrap() error {
+	return e.err
+}
+
+// send sends an encoded request to the collector. If the request fails in a way that can be retried, the error is an
+// otlpRetryableError, and the duration from the Retry-After header of the response is returned if there was one.
+func (e *otlpExporter) send(ctx context.Context, body []byte, contentType string) (time.Duration, error) {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for key, value := range e.opts.Headers {
+		request.Header.Set(key, value)
+	}
+
+	// Network errors can always be retried
+	response, err := e.opts.Client.Do(request)
+	if err != nil {
+		return 0, otlpRetryableError{err: err}
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return 0, nil
+	}
+
+	// Only throttling and unavailability can be retried
+	err = fmt.Errorf("loggy: OTLP export failed with status %s", response.Status)
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return parseRetryAfter(response.Header.Get("Retry-After")), otlpRetryableError{err: err}
+	default:
+		return 0, err
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date. It
+// returns zero if the value is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// resourceAttrs returns the attributes of the resource records are exported with.
+func (e *otlpExporter) resourceAttrs() []slog.Attr {
+	attrs := resolveAttrs(nil, e.opts.ResourceAttributes, nil)
+	if e.opts.ServiceName != "" {
+		attrs = append([]slog.Attr{slog.String("service.name", e.opts.ServiceName)}, attrs...)
+	}
+	return attrs
+}
+
+// jsonRequest builds an ExportLogsServiceRequest for a batch of records using the JSON mapping of OTLP.
+func (e *otlpExporter) jsonRequest(records []otlpLogRecord) map[string]any {
+	logRecords := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		logRecord := map[string]any{
+			"observedTimeUnixNano": strconv.FormatUint(record.observedTimeUnixNano, 10),
+			"severityNumber":       record.severityNumber,
+			"severityText":         record.severityText,
+			"body":                 map[string]any{"stringValue": record.body},
+			"attributes":           otlpJSONKeyValues(record.attrs),
+		}
+		if record.timeUnixNano != 0 {
+			logRecord["timeUnixNano"] = strconv.FormatUint(record.timeUnixNano, 10)
+		}
+		if record.traceID != nil {
+			logRecord["traceId"] = hex.EncodeToString(record.traceID)
+			logRecord["spanId"] = hex.EncodeToString(record.spanID)
+			logRecord["flags"] = record.flags
+		}
+		logRecords = append(logRecords, logRecord)
+	}
+
+	return map[string]any{
+		"resourceLogs": []map[string]any{
+			{
+				"resource": map[string]any{"attributes": otlpJSONKeyValues(e.resourceAttrs())},
+				"scopeLogs": []map[string]any{
+					{
+						"scope":      map[string]any{"name": otlpScopeName},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpJSONKeyValues converts resolved attributes into OTLP KeyValues using the JSON mapping.
+func otlpJSONKeyValues(attrs []slog.Attr) []map[string]any {
+	keyValues := make([]map[string]any, 0, len(attrs))
+	for _, attr := range attrs {
+		keyValues = append(keyValues, map[string]any{"key": attr.Key, "value": otlpJSONAnyValue(attr.Value)})
+	}
+	return keyValues
+}
+
+// otlpJSONAnyValue converts a resolved value into an OTLP AnyValue using the JSON mapping, in which 64-bit integers
+// are strings, bytes are base64 encoded and non-finite doubles are strings.
+func otlpJSONAnyValue(value slog.Value) map[string]any {
+	switch value.Kind() {
+	case slog.KindInt64:
+		return map[string]any{"intValue": strconv.FormatInt(value.Int64(), 10)}
+	case slog.KindUint64:
+		if value.Uint64() > math.MaxInt64 {
+			return map[string]any{"stringValue": value.String()}
+		}
+		return map[string]any{"intValue": strconv.FormatUint(value.Uint64(), 10)}
+	case slog.KindFloat64:
+		// Non-finite doubles are written as the strings that the proto3 JSON mapping uses for them
+		switch f := value.Float64(); {
+		case math.IsNaN(f):
+			return map[string]any{"doubleValue": "NaN"}
+		case math.IsInf(f, 1):
+			return map[string]any{"doubleValue": "Infinity"}
+		case math.IsInf(f, -1):
+			return map[string]any{"doubleValue": "-Infinity"}
+		default:
+			return map[string]any{"doubleValue": f}
+		}
+	case slog.KindBool:
+		return map[string]any{"boolValue": value.Bool()}
+	case slog.KindGroup:
+		return map[string]any{"kvlistValue": map[string]any{"values": otlpJSONKeyValues(value.Group())}}
+	case slog.KindAny:
+		if data, ok := value.Any().([]byte); ok {
+			return map[string]any{"bytesValue": base64.StdEncoding.EncodeToString(data)}
+		}
+	}
+
+	return map[string]any{"stringValue": valueToString(value)}
+}
+
+// protobufRequest encodes an ExportLogsServiceRequest for a batch of records as protocol buffers.
+func (e *otlpExporter) protobufRequest(records []otlpLogRecord) []byte {
+	// Encode the records
+	var scopeLogs []byte
+	scopeLogs = appendProtoMessageField(scopeLogs, 1, appendProtoStringField(nil, 1, otlpScopeName))
+	for _, record := range records {
+		var logRecord []byte
+		logRecord = appendProtoFixed64Field(logRecord, 1, record.timeUnixNano)
+		logRecord = appendProtoVarintField(logRecord, 2, uint64(record.severityNumber))
+		logRecord = appendProtoStringField(logRecord, 3, record.severityText)
+		logRecord = appendProtoMessageField(logRecord, 5, appendProtoStringField(nil, 1, record.body))
+		logRecord = appendOTLPKeyValues(logRecord, 6, record.attrs)
+		logRecord = appendProtoFixed32Field(logRecord, 8, record.flags)
+		logRecord = appendProtoBytesField(logRecord, 9, record.traceID)
+		logRecord = appendProtoBytesField(logRecord, 10, record.spanID)
+		logRecord = appendProtoFixed64Field(logRecord, 11, record.observedTimeUnixNano)
+		scopeLogs = appendProtoMessageField(scopeLogs, 2, logRecord)
+	}
+
+	// Wrap them in the resource and the request
+	var resourceLogs []byte
+	resourceLogs = appendProtoMessageField(resourceLogs, 1, appendOTLPKeyValues(nil, 1, e.resourceAttrs()))
+	resourceLogs = appendProtoMessageField(resourceLogs, 2, scopeLogs)
+
+	return appendProtoMessageField(nil, 1, resourceLogs)
+}
+
+// appendOTLPKeyValues appends resolved attributes to b as repeated OTLP KeyValue fields with the given field number.
+func appendOTLPKeyValues(b []byte, field int, attrs []slog.Attr) []byte {
+	for _, attr := range attrs {
+		var keyValue []byte
+		keyValue = appendProtoStringField(keyValue, 1, attr.Key)
+		keyValue = appendProtoMessageField(keyValue, 2, appendOTLPAnyValue(nil, attr.Value))
+		b = appendProtoMessageField(b, field, keyValue)
+	}
+	return b
+}
+
+// appendOTLPAnyValue appends the fields of an OTLP AnyValue for a resolved value to b. The fields of the value are
+// written even if they are zero, as they are members of a oneof.
+func appendOTLPAnyValue(b []byte, value slog.Value) []byte {
+	switch value.Kind() {
+	case slog.KindBool:
+		b = appendProtoTag(b, 2, protoWireVarint)
+		if value.Bool() {
+			return appendProtoVarint(b, 1)
+		}
+		return appendProtoVarint(b, 0)
+	case slog.KindInt64:
+		b = appendProtoTag(b, 3, protoWireVarint)
+		return appendProtoVarint(b, uint64(value.Int64()))
+	case slog.KindUint64:
+		if value.Uint64() <= math.MaxInt64 {
+			b = appendProtoTag(b, 3, protoWireVarint)
+			return appendProtoVarint(b, value.Uint64())
+		}
+	case slog.KindFloat64:
+		b = appendProtoTag(b, 4, protoWireFixed64)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(value.Float64()))
+	case slog.KindGroup:
+		return appendProtoMessageField(b, 6, appendOTLPKeyValues(nil, 1, value.Group()))
+	case slog.KindAny:
+		if data, ok := value.Any().([]byte); ok {
+			return appendProtoMessageField(b, 7, data)
+		}
+	}
+
+	return appendProtoMessageField(b, 1, []byte(valueToString(value)))
+}
+
+// otlpSeverityNumber maps a slog level to an OTLP severity number. The levels defined by slog are 4 apart, just like
+// the OTLP severity ranges, so DEBUG maps to 5, INFO to 9, WARN to 13, ERROR to 17 and ERROR+4 to FATAL.
+func otlpSeverityNumber(level slog.Level) int {
+	return min(max(int(level)+9, 1), 24)
+}
+
+// NewOTLPHandler returns an OTLPHandler that exports records to the OTLP/HTTP collector at the configured endpoint.
+//
+// The handler must be closed to export the records that are still buffered.
+func NewOTLPHandler(opts OTLPHandlerOpts) *OTLPHandler {
+	// Set the defaults
+	if opts.Endpoint == "" {
+		opts.Endpoint = otlpDefaultEndpoint
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = otlpDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = otlpDefaultFlushInterval
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = otlpDefaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = otlpDefaultRetryBackoff
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = otlpDefaultMaxRetryBackoff
+	}
+	if opts.BufferLimit <= 0 {
+		opts.BufferLimit = otlpDefaultBufferLimit
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = otlpDefaultCloseTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(opts.TraceExtractors) == 0 {
+		opts.TraceExtractors = []TraceExtractor{W3CTraceExtractor}
+	}
+
+	// Start exporting records in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	exporter := &otlpExporter{
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go exporter.run()
+
+	return &OTLPHandler{exporter: exporter}
+}
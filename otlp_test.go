@@ -0,0 +1,420 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// otlpCollector is a fake OTLP/HTTP collector that records the requests it receives, and responds to them with the
+// configured statuses in order before responding with 200 OK to the rest.
+type otlpCollector struct {
+	mu          sync.Mutex
+	statuses    []int
+	retryAfter  string
+	requests    []*http.Request
+	bodies      [][]byte
+	requestTime []time.Time
+}
+
+// ServeHTTP records the request and responds to it.
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, body)
+	c.requestTime = append(c.requestTime, time.Now())
+
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		if c.retryAfter != "" {
+			w.Header().Set("Retry-After", c.retryAfter)
+		}
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// jsonBodies decodes the bodies of all the requests received by the collector as JSON.
+func (c *otlpCollector) jsonBodies(t *testing.T) []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	decoded := make([]map[string]any, 0, len(c.bodies))
+	for _, body := range c.bodies {
+		var request map[string]any
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, request)
+	}
+	return decoded
+}
+
+// tracedKey is the context key that marks a context as traced in the tests of the OTLPHandler.
+type tracedKey struct{}
+
+// otlpLogRecords returns the log records of the first scope of the first resource in a JSON request.
+func otlpLogRecords(request map[string]any) []any {
+	resourceLogs := request["resourceLogs"].([]any)[0].(map[string]any)
+	scopeLogs := resourceLogs["scopeLogs"].([]any)[0].(map[string]any)
+	return scopeLogs["logRecords"].([]any)
+}
+
+// TestNewOTLPHandler_JSON tests the OTLPHandler returned by NewOTLPHandler with records exported using the JSON
+// encoding.
+func TestNewOTLPHandler_JSON(t *testing.T) {
+	// Start a fake collector
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that exports records as JSON, with trace IDs taken from the context
+	traceID := [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	spanID := [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{
+			Endpoint:           server.URL + "/v1/logs",
+			Encoding:           loggy.OTLPEncodingJSON,
+			ServiceName:        "test-service",
+			ResourceAttributes: []slog.Attr{slog.String("deployment.environment", "test")},
+			Headers:            map[string]string{"Authorization": "Bearer token"},
+			TraceExtractors: []loggy.TraceExtractor{
+				loggy.TraceExtractorFunc(
+					func(ctx context.Context) (loggy.TraceContext, bool) {
+						return loggy.TraceContext{TraceID: traceID, SpanID: spanID, Flags: 1}, ctx.Value(tracedKey{}) != nil
+					},
+				),
+			},
+		},
+	)
+	logger := slog.New(handler)
+
+	// Log a warning with a group, in a traced context
+	ctx := context.WithValue(context.Background(), tracedKey{}, true)
+	logger.WarnContext(ctx, "this is a test log", "count", 3, slog.Group("http", "method", "GET"))
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check the request
+	requests := collector.jsonBodies(t)
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	assert.Equal(t, "application/json", collector.requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", collector.requests[0].Header.Get("Authorization"))
+
+	// Check the resource attributes
+	resource := requests[0]["resourceLogs"].([]any)[0].(map[string]any)["resource"].(map[string]any)
+	assert.Equal(
+		t,
+		[]any{
+			map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "test-service"}},
+			map[string]any{"key": "deployment.environment", "value": map[string]any{"stringValue": "test"}},
+		},
+		resource["attributes"],
+	)
+
+	// Check the log record
+	logRecords := otlpLogRecords(requests[0])
+	if !assert.Len(t, logRecords, 1) {
+		return
+	}
+	logRecord := logRecords[0].(map[string]any)
+	assert.Equal(t, float64(13), logRecord["severityNumber"])
+	assert.Equal(t, "WARN", logRecord["severityText"])
+	assert.Equal(t, map[string]any{"stringValue": "this is a test log"}, logRecord["body"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logRecord["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", logRecord["spanId"])
+	assert.Equal(t, float64(1), logRecord["flags"])
+	assert.NotEmpty(t, logRecord["timeUnixNano"])
+	assert.Equal(
+		t,
+		[]any{
+			map[string]any{"key": "count", "value": map[string]any{"intValue": "3"}},
+			map[string]any{
+				"key": "http",
+				"value": map[string]any{
+					"kvlistValue": map[string]any{
+						"values": []any{
+							map[string]any{"key": "method", "value": map[string]any{"stringValue": "GET"}},
+						},
+					},
+				},
+			},
+		},
+		logRecord["attributes"],
+	)
+}
+
+// TestNewOTLPHandler_JSONNonFinite tests the OTLPHandler returned by NewOTLPHandler with non-finite floats exported
+// using the JSON encoding, which should be written as the strings of the proto3 JSON mapping.
+func TestNewOTLPHandler_JSONNonFinite(t *testing.T) {
+	// Start a fake collector
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Log non-finite floats
+	handler := loggy.NewOTLPHandler(loggy.OTLPHandlerOpts{Endpoint: server.URL, Encoding: loggy.OTLPEncodingJSON})
+	slog.New(handler).Info("non-finite", "nan", math.NaN(), "inf", math.Inf(1), "-inf", math.Inf(-1))
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that the record was exported with the floats as strings
+	requests := collector.jsonBodies(t)
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	logRecords := otlpLogRecords(requests[0])
+	if !assert.Len(t, logRecords, 1) {
+		return
+	}
+	assert.Equal(
+		t,
+		[]any{
+			map[string]any{"key": "nan", "value": map[string]any{"doubleValue": "NaN"}},
+			map[string]any{"key": "inf", "value": map[string]any{"doubleValue": "Infinity"}},
+			map[string]any{"key": "-inf", "value": map[string]any{"doubleValue": "-Infinity"}},
+		},
+		logRecords[0].(map[string]any)["attributes"],
+	)
+}
+
+// TestNewOTLPHandler_Protobuf tests the OTLPHandler returned by NewOTLPHandler with records exported using the
+// protobuf encoding.
+func TestNewOTLPHandler_Protobuf(t *testing.T) {
+	// Start a fake collector
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that exports records as protobuf
+	handler := loggy.NewOTLPHandler(loggy.OTLPHandlerOpts{Endpoint: server.URL, ServiceName: "test-service"})
+
+	// Log a record and export it
+	slog.New(handler).Error("this is a test log")
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that the request is an ExportLogsServiceRequest with the record in it
+	if !assert.Len(t, collector.bodies, 1) {
+		return
+	}
+	assert.Equal(t, "application/x-protobuf", collector.requests[0].Header.Get("Content-Type"))
+	body := collector.bodies[0]
+	assert.Equal(t, byte(0x0a), body[0])
+	assert.True(t, bytes.Contains(body, []byte("test-service")))
+	assert.True(t, bytes.Contains(body, []byte("this is a test log")))
+	assert.True(t, bytes.Contains(body, []byte{0x10, 17}), "severity number should be ERROR")
+}
+
+// TestNewOTLPHandler_Batches tests the OTLPHandler returned by NewOTLPHandler with more records than fit in a batch.
+func TestNewOTLPHandler_Batches(t *testing.T) {
+	// Start a fake collector
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that exports batches of two records
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL, Encoding: loggy.OTLPEncodingJSON, BatchSize: 2},
+	)
+	logger := slog.New(handler)
+
+	// Log three records and export them
+	logger.Info("first log")
+	logger.Info("second log")
+	logger.Info("third log")
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that no request had more than two records, and all of them were exported
+	var total int
+	for _, request := range collector.jsonBodies(t) {
+		logRecords := otlpLogRecords(request)
+		assert.LessOrEqual(t, len(logRecords), 2)
+		total += len(logRecords)
+	}
+	assert.Equal(t, 3, total)
+}
+
+// TestNewOTLPHandler_RetryAfter tests the OTLPHandler returned by NewOTLPHandler with a collector that throttles the
+// first request and asks for it to be retried after a second.
+func TestNewOTLPHandler_RetryAfter(t *testing.T) {
+	// Start a fake collector that throttles the first request
+	collector := &otlpCollector{statuses: []int{http.StatusTooManyRequests}, retryAfter: "1"}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger with a short retry backoff, which the collector overrides
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL, RetryBackoff: time.Millisecond},
+	)
+
+	// Log a record and export it
+	slog.New(handler).Info("this is a test log")
+	err := handler.Close()
+
+	// Check that the request was retried after the time the collector asked for
+	assert.NoError(t, err)
+	if assert.Len(t, collector.requestTime, 2) {
+		assert.GreaterOrEqual(t, collector.requestTime[1].Sub(collector.requestTime[0]), time.Second)
+	}
+}
+
+// TestNewOTLPHandler_Backoff tests the OTLPHandler returned by NewOTLPHandler with a collector that is unavailable
+// for longer than the handler retries for.
+func TestNewOTLPHandler_Backoff(t *testing.T) {
+	// Start a fake collector that is unavailable for the first three requests
+	collector := &otlpCollector{
+		statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that only retries twice
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL, MaxRetries: 2, RetryBackoff: time.Millisecond},
+	)
+
+	// Log a record and export it
+	slog.New(handler).Info("this is a test log")
+	err := handler.Close()
+
+	// Check that the export was attempted three times before giving up
+	assert.Error(t, err)
+	assert.Len(t, collector.requests, 3)
+}
+
+// TestNewOTLPHandler_PermanentError tests the OTLPHandler returned by NewOTLPHandler with a collector that rejects
+// the request, which should not be retried.
+func TestNewOTLPHandler_PermanentError(t *testing.T) {
+	// Start a fake collector that rejects the first request
+	collector := &otlpCollector{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that exports to the collector
+	handler := loggy.NewOTLPHandler(loggy.OTLPHandlerOpts{Endpoint: server.URL, RetryBackoff: time.Millisecond})
+
+	// Log a record and export it
+	slog.New(handler).Info("this is a test log")
+	err := handler.Close()
+
+	// Check that the export failed without being retried
+	assert.Error(t, err)
+	assert.Len(t, collector.requests, 1)
+}
+
+// TestNewOTLPHandler_BufferLimit tests the OTLPHandler returned by NewOTLPHandler with more records than its buffer
+// can hold, which should drop the oldest records.
+func TestNewOTLPHandler_BufferLimit(t *testing.T) {
+	// Start a fake collector
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that buffers at most two records
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL, Encoding: loggy.OTLPEncodingJSON, BufferLimit: 2},
+	)
+	logger := slog.New(handler)
+
+	// Log three records and export them
+	logger.Info("first")
+	logger.Info("second")
+	logger.Info("third")
+	if err := handler.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check that only the two newest records were exported
+	requests := collector.jsonBodies(t)
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	var messages []any
+	for _, record := range otlpLogRecords(requests[0]) {
+		messages = append(messages, record.(map[string]any)["body"].(map[string]any)["stringValue"])
+	}
+	assert.Equal(t, []any{"second", "third"}, messages)
+}
+
+// TestOTLPHandler_Shutdown tests that OTLPHandler.Shutdown stops retrying an export when its context is done, and
+// that records handled after it are rejected.
+func TestOTLPHandler_Shutdown(t *testing.T) {
+	// Start a fake collector that is unavailable and asks for requests to be retried much later
+	collector := &otlpCollector{
+		statuses:   []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		retryAfter: "60",
+	}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that exports to the collector
+	handler := loggy.NewOTLPHandler(loggy.OTLPHandlerOpts{Endpoint: server.URL})
+	logger := slog.New(handler)
+
+	// Log a record and shut down the handler with a short deadline
+	logger.Info("this is a test log")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := handler.Shutdown(ctx)
+
+	// Check that the export gave up at the deadline instead of waiting to be retried
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Check that records handled after the handler was shut down are rejected
+	err = handler.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "too late", 0))
+	assert.ErrorIs(t, err, loggy.ErrHandlerClosed)
+}
+
+// TestOTLPHandler_CloseTimeout tests that OTLPHandler.Close stops retrying an export after the close timeout.
+func TestOTLPHandler_CloseTimeout(t *testing.T) {
+	// Start a fake collector that is unavailable and asks for requests to be retried much later
+	collector := &otlpCollector{statuses: []int{http.StatusServiceUnavailable}, retryAfter: "60"}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// Create a logger that gives up on exporting records shortly after being closed
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL, CloseTimeout: 100 * time.Millisecond},
+	)
+
+	// Log a record and close the handler
+	slog.New(handler).Info("this is a test log")
+	start := time.Now()
+	err := handler.Close()
+
+	// Check that the export gave up at the close timeout
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,169 @@
+package loggy
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// FieldPreset describes the keys and level values that a log backend expects for the built-in attributes of a record,
+// so that records can be rewritten to its schema with a ReplaceAttr function.
+//
+// Presets only rename the built-in attributes and map the level and source values, the rest of the attributes are
+// logged as is.
+type FieldPreset struct {
+	// TimeKey is the key of the time of the record. If it is empty, the key is not changed.
+	TimeKey string
+
+	// LevelKey is the key of the level of the record. If it is empty, the key is not changed.
+	LevelKey string
+
+	// MessageKey is the key of the message of the record. If it is empty, the key is not changed.
+	MessageKey string
+
+	// SourceKey is the key of the source location of the record. If it is empty, the key is not changed.
+	SourceKey string
+
+	// LevelValue returns the value that a level is logged as. If it is nil, the level is logged as is.
+	LevelValue func(level slog.Level) string
+
+	// SourceValue returns the value that a source location is logged as. If it is nil, the source location is logged
+	// as is.
+	SourceValue func(source *slog.Source) slog.Value
+}
+
+var (
+	// ECSPreset renames the built-in attributes to the fields of the Elastic Common Schema, with lowercase levels and
+	// the source location as the log.origin object, the same way as the ECSHandler.
+	ECSPreset = FieldPreset{
+		TimeKey:     "@timestamp",
+		LevelKey:    "log.level",
+		MessageKey:  "message",
+		SourceKey:   "log.origin",
+		LevelValue:  func(level slog.Level) string { return strings.ToLower(level.String()) },
+		SourceValue: ecsOrigin,
+	}
+
+	// GCPPreset renames the built-in attributes to the fields of Google Cloud Logging structured logs, with levels
+	// mapped to Cloud Logging severities.
+	GCPPreset = FieldPreset{
+		TimeKey:    "timestamp",
+		LevelKey:   "severity",
+		MessageKey: "message",
+		SourceKey:  "logging.googleapis.com/sourceLocation",
+		LevelValue: gcpSeverity,
+	}
+
+	// DatadogPreset renames the built-in attributes to the reserved attributes of Datadog, with levels mapped to
+	// Datadog statuses.
+	DatadogPreset = FieldPreset{
+		TimeKey:    "timestamp",
+		LevelKey:   "status",
+		MessageKey: "message",
+		SourceKey:  "logger",
+		LevelValue: datadogStatus,
+	}
+)
+
+// ReplaceAttr returns a function to be used as slog.HandlerOptions.ReplaceAttr, which renames the built-in attributes
+// of records and maps their levels according to the preset. This works with any handler that supports ReplaceAttr,
+// e.g. a slog.JSONHandler writing to a file.
+//
+// If next is not nil, it is called on every attribute before the preset is applied, with the original keys.
+func (p FieldPreset) ReplaceAttr(
+	next func(groups []string, attr slog.Attr) slog.Attr,
+) func(groups []string, attr slog.Attr) slog.Attr {
+	return func(groups []string, attr slog.Attr) slog.Attr {
+		if next != nil {
+			attr = next(groups, attr)
+		}
+
+		// Only the built-in attributes are at the top level with these keys
+		if len(groups) > 0 {
+			return attr
+		}
+
+		switch attr.Key {
+		case slog.TimeKey:
+			attr.Key = presetKey(p.TimeKey, attr.Key)
+		case slog.LevelKey:
+			attr.Key = presetKey(p.LevelKey, attr.Key)
+			if level, ok := attr.Value.Any().(slog.Level); ok && p.LevelValue != nil {
+				attr.Value = slog.StringValue(p.LevelValue(level))
+			}
+		case slog.MessageKey:
+			attr.Key = presetKey(p.MessageKey, attr.Key)
+		case slog.SourceKey:
+			attr.Key = presetKey(p.SourceKey, attr.Key)
+			if source, ok := attr.Value.Any().(*slog.Source); ok && p.SourceValue != nil {
+				attr.Value = p.SourceValue(source)
+			}
+		}
+		return attr
+	}
+}
+
+// levelKey returns the key that the level is logged with.
+func (p FieldPreset) levelKey() string {
+	return presetKey(p.LevelKey, slog.LevelKey)
+}
+
+// levelValue returns the value that a level is logged as.
+func (p FieldPreset) levelValue(level slog.Level) string {
+	if p.LevelValue == nil {
+		return level.String()
+	}
+	return p.LevelValue(level)
+}
+
+// presetKey returns the key of a preset, or the original key if the preset doesn't change it.
+func presetKey(key, original string) string {
+	if key == "" {
+		return original
+	}
+	return key
+}
+
+// ecsOrigin maps a source location to the log.origin object of the Elastic Common Schema.
+func ecsOrigin(source *slog.Source) slog.Value {
+	return slog.GroupValue(
+		slog.Group("file", slog.String("name", source.File), slog.Int("line", source.Line)),
+		slog.String("function", source.Function),
+	)
+}
+
+// gcpSeverity maps a level to a Google Cloud Logging severity. Levels between the standard ones are mapped to the
+// severity of the level below them, except for the ones between INFO and WARN, which are mapped to NOTICE.
+func gcpSeverity(level slog.Level) string {
+	switch {
+	case level >= LevelFatal:
+		return "CRITICAL"
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level > slog.LevelInfo:
+		return "NOTICE"
+	case level == slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// datadogStatus maps a level to a Datadog log status.
+func datadogStatus(level slog.Level) string {
+	switch {
+	case level >= LevelFatal:
+		return "critical"
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warning"
+	case level > slog.LevelInfo:
+		return "notice"
+	case level == slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
@@ -0,0 +1,126 @@
+package loggy_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestFieldPreset_ReplaceAttr tests the ReplaceAttr function of the presets with a JSON handler, which should rename
+// the built-in attributes and map the levels, while leaving the attributes in groups alone.
+func TestFieldPreset_ReplaceAttr(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		preset         loggy.FieldPreset
+		level          slog.Level
+		expectedOutput string
+	}{
+		"ECS": {
+			preset:         loggy.ECSPreset,
+			level:          slog.LevelWarn,
+			expectedOutput: "{\"log.level\":\"warn\",\"message\":\"this is a test log\",\"g\":{\"level\":\"x\"}}\n",
+		},
+		"GCP": {
+			preset:         loggy.GCPPreset,
+			level:          loggy.LevelFatal,
+			expectedOutput: "{\"severity\":\"CRITICAL\",\"message\":\"this is a test log\",\"g\":{\"level\":\"x\"}}\n",
+		},
+		"GCP notice": {
+			preset:         loggy.GCPPreset,
+			level:          slog.LevelInfo + 2,
+			expectedOutput: "{\"severity\":\"NOTICE\",\"message\":\"this is a test log\",\"g\":{\"level\":\"x\"}}\n",
+		},
+		"Datadog": {
+			preset:         loggy.DatadogPreset,
+			level:          slog.LevelDebug,
+			expectedOutput: "{\"status\":\"debug\",\"message\":\"this is a test log\",\"g\":{\"level\":\"x\"}}\n",
+		},
+	} {
+		// Create a JSON handler that removes the time, and then applies the preset
+		var outputStream strings.Builder
+		handler := slog.NewJSONHandler(
+			&outputStream,
+			&slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: testCase.preset.ReplaceAttr(removeTime)},
+		)
+
+		// Log a message with an attribute in a group that has the same key as a built-in attribute
+		slog.New(handler).Log(context.Background(), testCase.level, "this is a test log", slog.Group("g", "level", "x"))
+
+		// Check the output
+		assert.Equal(t, testCase.expectedOutput, outputStream.String(), name)
+	}
+}
+
+// TestFieldPreset_Time tests the ReplaceAttr function of the ECS preset, which should rename the time of records.
+func TestFieldPreset_Time(t *testing.T) {
+	// Create a JSON handler that applies the preset
+	var outputStream strings.Builder
+	handler := slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: loggy.ECSPreset.ReplaceAttr(nil)})
+
+	// Log a message
+	slog.New(handler).Info("this is a test log")
+
+	// Check the time was renamed
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Contains(t, logs[0], "@timestamp")
+		assert.NotContains(t, logs[0], "time")
+	}
+}
+
+// TestFieldPreset_Source tests the ReplaceAttr function of the ECS preset, which should log the source location of
+// records as the log.origin object.
+func TestFieldPreset_Source(t *testing.T) {
+	// Create a JSON handler that adds the source location, and applies the preset
+	var outputStream strings.Builder
+	handler := slog.NewJSONHandler(
+		&outputStream, &slog.HandlerOptions{AddSource: true, ReplaceAttr: loggy.ECSPreset.ReplaceAttr(removeTime)},
+	)
+
+	// Log a message
+	slog.New(handler).Info("this is a test log")
+
+	// Check the source location
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	origin := logs[0]["log.origin"].(map[string]any)
+	assert.Contains(t, origin["function"], "TestFieldPreset_Source")
+	file := origin["file"].(map[string]any)
+	assert.Contains(t, file["name"], "preset_test.go")
+	assert.NotZero(t, file["line"])
+}
+
+// TestNewConsoleLogHandler_Preset tests the NewConsoleLogHandler function with a preset, which should still colourise
+// the output according to the mapped levels.
+func TestNewConsoleLogHandler_Preset(t *testing.T) {
+	// Capture the console output
+	output, err := captureConsoleOutput(
+		t, true, func() {
+			// Initialize the logger with the GCP preset
+			opts := loggy.ConsoleLogWriterOpts{LogToStdout: true, JSON: true, Preset: &loggy.GCPPreset}
+			initializeLogger(opts)
+
+			// Log a warning and an error message
+			slog.Warn("this is a test log")
+			slog.Error("this is a test log")
+		},
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Define the expected output
+	expectedOutput := color.New(color.FgYellow).Sprint("{\"severity\":\"WARNING\",\"message\":\"this is a test log\"}\n") +
+		color.New(color.FgRed).Sprint("{\"severity\":\"ERROR\",\"message\":\"this is a test log\"}\n")
+
+	// Assert that the output matches the expected output
+	assert.Equal(t, expectedOutput, output)
+}
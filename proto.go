@@ -0,0 +1,399 @@
+package loggy
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// ProtoSchema is the protobuf schema of the records written by the ProtoHandler, the loggy.v1.Record message, which
+// can be used to generate code for reading them in other languages. It is also in proto/loggy/v1/record.proto.
+//
+//go:embed proto/loggy/v1/record.proto
+var ProtoSchema string
+
+// protoBufferPool holds the buffers that records are encoded in, to avoid allocating one for every record.
+var protoBufferPool = sync.Pool{New: func() any { b := make([]byte, 0, 1024); return &b }}
+
+var (
+	// protoMinTime is the earliest time that can be written in nanoseconds since the Unix epoch.
+	protoMinTime = time.Unix(0, math.MinInt64)
+
+	// protoMaxTime is the latest time that can be written in nanoseconds since the Unix epoch.
+	protoMaxTime = time.Unix(0, math.MaxInt64)
+)
+
+// ProtoHandlerOpts represents the options for configuring the behaviour of the `ProtoHandler`.
+type ProtoHandlerOpts struct {
+	// HandlerOptions contains additional options for the handler. ReplaceAttr is called for the time and source of
+	// every record, and for all the attributes.
+	HandlerOptions slog.HandlerOptions
+}
+
+// ProtoHandler is a handler that writes records as loggy.v1.Record protobuf messages (see ProtoSchema), each one
+// preceded by its size as a varint, so that logs can be shipped between services written in any language with a
+// stable, versioned wire format. Records can be turned back into slog.Records with a ProtoDecoder.
+//
+// Attributes are written with typed values, with durations, times and byte slices in their own fields and groups as
+// nested attributes. Values of any other type are written as strings.
+type ProtoHandler struct {
+	opts ProtoHandlerOpts
+	mu   *sync.Mutex
+	w    io.Writer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the ProtoHandler handles records at the given level.
+func (h *ProtoHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle encodes the record as a protobuf message and writes it, preceded by its size.
+func (h *ProtoHandler) Handle(_ context.Context, record slog.Record) error {
+	bufPtr := protoBufferPool.Get().(*[]byte)
+	defer func() {
+		// Don't keep large buffers around
+		if cap(*bufPtr) <= 64<<10 {
+			protoBufferPool.Put(bufPtr)
+		}
+	}()
+
+	// Encode the message, and then its size in the space after it, so that they can be written together
+	message := h.appendRecord((*bufPtr)[:0], record)
+	b := appendProtoVarint(message, uint64(len(message)))
+	b = append(b, message...)
+	*bufPtr = b
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b[len(message):])
+	return err
+}
+
+// WithAttrs returns a new ProtoHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *ProtoHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &ProtoHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new ProtoHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *ProtoHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &ProtoHandler{opts: h.opts, mu: h.mu, w: h.w, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// appendRecord appends a record to b as a loggy.v1.Record message.
+func (h *ProtoHandler) appendRecord(b []byte, record slog.Record) []byte {
+	replace := h.opts.HandlerOptions.ReplaceAttr
+
+	// Add the time, unless it has been removed. The field is written even if it is zero, since a record logged at the
+	// Unix epoch still has a time.
+	if !record.Time.IsZero() {
+		if t, ok := replaceBuiltinTime(replace, record.Time); ok {
+			b = binary.LittleEndian.AppendUint64(appendProtoTag(b, 1, protoWireFixed64), uint64(protoUnixNano(t)))
+		}
+	}
+
+	// Add the level and message
+	if record.Level != 0 {
+		b = appendProtoZigzag(appendProtoTag(b, 2, protoWireVarint), int64(record.Level))
+	}
+	b = appendProtoStringField(b, 3, record.Message)
+
+	// Add the source location
+	if h.opts.HandlerOptions.AddSource {
+		if source := recordSource(record); source != nil {
+			attr := replaceBuiltin(replace, slog.Any(slog.SourceKey, source))
+			if source, ok := attr.Value.Any().(*slog.Source); ok {
+				message := appendProtoStringField(nil, 1, source.Function)
+				message = appendProtoStringField(message, 2, source.File)
+				message = appendProtoVarintField(message, 3, uint64(source.Line))
+				b = appendProtoMessageField(b, 4, message)
+			}
+		}
+	}
+
+	// Add the attributes
+	return appendProtoAttrs(b, 5, collectAttrs(h.goas, record, replace))
+}
+
+// protoUnixNano returns the time in nanoseconds since the Unix epoch, clamped to the range of an int64, since
+// time.Time.UnixNano is undefined for times outside of it.
+func protoUnixNano(t time.Time) int64 {
+	switch {
+	case t.Before(protoMinTime):
+		return math.MinInt64
+	case t.After(protoMaxTime):
+		return math.MaxInt64
+	default:
+		return t.UnixNano()
+	}
+}
+
+// appendProtoAttrs appends resolved attributes to b as repeated loggy.v1.Attr messages in the given field.
+func appendProtoAttrs(b []byte, field int, attrs []slog.Attr) []byte {
+	for _, attr := range attrs {
+		message := appendProtoStringField(nil, 1, attr.Key)
+		message = appendProtoMessageField(message, 2, appendProtoValue(nil, attr.Value))
+		b = appendProtoMessageField(b, field, message)
+	}
+	return b
+}
+
+// appendProtoValue appends the fields of a loggy.v1.Value message for a resolved slog.Value to b. Since the fields
+// are part of a oneof, they are written even if they hold a zero value.
+func appendProtoValue(b []byte, value slog.Value) []byte {
+	switch value.Kind() {
+	case slog.KindString:
+		return appendProtoMessageField(b, 1, []byte(value.String()))
+	case slog.KindInt64:
+		return appendProtoVarint(appendProtoTag(b, 2, protoWireVarint), uint64(value.Int64()))
+	case slog.KindUint64:
+		return appendProtoVarint(appendProtoTag(b, 3, protoWireVarint), value.Uint64())
+	case slog.KindFloat64:
+		return binary.LittleEndian.AppendUint64(appendProtoTag(b, 4, protoWireFixed64), math.Float64bits(value.Float64()))
+	case slog.KindBool:
+		v := uint64(0)
+		if value.Bool() {
+			v = 1
+		}
+		return appendProtoVarint(appendProtoTag(b, 5, protoWireVarint), v)
+	case slog.KindDuration:
+		return appendProtoVarint(appendProtoTag(b, 6, protoWireVarint), uint64(value.Duration()))
+	case slog.KindTime:
+		nsec := protoUnixNano(value.Time())
+		return binary.LittleEndian.AppendUint64(appendProtoTag(b, 7, protoWireFixed64), uint64(nsec))
+	case slog.KindGroup:
+		return appendProtoMessageField(b, 9, appendProtoAttrs(nil, 1, value.Group()))
+	}
+
+	// Values of any other kind are encoded as what they are closest to
+	switch v := value.Any().(type) {
+	case nil:
+		return b
+	case []byte:
+		return appendProtoMessageField(b, 8, v)
+	default:
+		return appendProtoMessageField(b, 1, []byte(valueToString(value)))
+	}
+}
+
+// NewProtoHandler returns a ProtoHandler that writes records to w as length-delimited protobuf messages.
+func NewProtoHandler(w io.Writer, options ...ProtoHandlerOpts) *ProtoHandler {
+	// If options are provided, assign the first option to opts
+	var opts ProtoHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	return &ProtoHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
+
+// ProtoDecoder reads the length-delimited messages written by a ProtoHandler and decodes them back into records.
+//
+// The time, level and message of the decoded records are the ones that were logged, and the attributes are in the
+// order they were logged in, with their types. Since the program counter of a record can't be restored, the source
+// location is added as the first attribute of the record, under slog.SourceKey, as a *slog.Source. Unknown fields are
+// skipped, so that records written with newer versions of the schema can still be read.
+type ProtoDecoder struct {
+	r       *bufio.Reader
+	message []byte
+}
+
+// Decode reads the next message and decodes it into a record. It returns io.EOF once there are no messages left, and
+// io.ErrUnexpectedEOF if the last message is incomplete.
+func (d *ProtoDecoder) Decode() (slog.Record, error) {
+	// Read the size of the message
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return slog.Record{}, err
+	}
+	if size > binaryMaxFrameSize {
+		return slog.Record{}, fmt.Errorf("loggy: protobuf message of %d bytes is too large", size)
+	}
+
+	// Read the message
+	if uint64(cap(d.message)) < size {
+		d.message = make([]byte, size)
+	}
+	d.message = d.message[:size]
+	if _, err := io.ReadFull(d.r, d.message); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return slog.Record{}, err
+	}
+
+	record, err := decodeProtoRecord(d.message)
+	if err != nil {
+		return slog.Record{}, fmt.Errorf("loggy: invalid protobuf record: %w", err)
+	}
+	return record, nil
+}
+
+// errInvalidProtoField is returned when a protobuf message contains a field that can't be read.
+var errInvalidProtoField = errors.New("invalid field")
+
+// decodeProtoRecord decodes a loggy.v1.Record message into a record.
+func decodeProtoRecord(b []byte) (slog.Record, error) {
+	var t time.Time
+	var level slog.Level
+	var msg string
+	var source *slog.Source
+	var attrs []slog.Attr
+
+	for len(b) > 0 {
+		field, wireType, v, data, n := consumeProtoField(b)
+		if n < 0 {
+			return slog.Record{}, errInvalidProtoField
+		}
+		b = b[n:]
+
+		switch {
+		case field == 1 && wireType == protoWireFixed64:
+			t = time.Unix(0, int64(v))
+		case field == 2 && wireType == protoWireVarint:
+			level = slog.Level(decodeProtoZigzag(v))
+		case field == 3 && wireType == protoWireBytes:
+			msg = string(data)
+		case field == 4 && wireType == protoWireBytes:
+			var err error
+			if source, err = decodeProtoSource(data); err != nil {
+				return slog.Record{}, err
+			}
+		case field == 5 && wireType == protoWireBytes:
+			attr, err := decodeProtoAttr(data)
+			if err != nil {
+				return slog.Record{}, err
+			}
+			attrs = append(attrs, attr)
+		}
+	}
+
+	record := slog.NewRecord(t, level, msg, 0)
+	if source != nil {
+		record.AddAttrs(slog.Any(slog.SourceKey, source))
+	}
+	record.AddAttrs(attrs...)
+	return record, nil
+}
+
+// decodeProtoSource decodes a loggy.v1.Source message.
+func decodeProtoSource(b []byte) (*slog.Source, error) {
+	source := &slog.Source{}
+	for len(b) > 0 {
+		field, wireType, v, data, n := consumeProtoField(b)
+		if n < 0 {
+			return nil, errInvalidProtoField
+		}
+		b = b[n:]
+
+		switch {
+		case field == 1 && wireType == protoWireBytes:
+			source.Function = string(data)
+		case field == 2 && wireType == protoWireBytes:
+			source.File = string(data)
+		case field == 3 && wireType == protoWireVarint:
+			source.Line = int(int64(v))
+		}
+	}
+	return source, nil
+}
+
+// decodeProtoAttr decodes a loggy.v1.Attr message.
+func decodeProtoAttr(b []byte) (slog.Attr, error) {
+	attr := slog.Attr{Value: slog.AnyValue(nil)}
+	for len(b) > 0 {
+		field, wireType, _, data, n := consumeProtoField(b)
+		if n < 0 {
+			return slog.Attr{}, errInvalidProtoField
+		}
+		b = b[n:]
+
+		switch {
+		case field == 1 && wireType == protoWireBytes:
+			attr.Key = string(data)
+		case field == 2 && wireType == protoWireBytes:
+			value, err := decodeProtoValue(data)
+			if err != nil {
+				return slog.Attr{}, err
+			}
+			attr.Value = value
+		}
+	}
+	return attr, nil
+}
+
+// decodeProtoValue decodes a loggy.v1.Value message. If more than one of the fields of the oneof are set, the last
+// one wins, as it does in the protobuf libraries.
+func decodeProtoValue(b []byte) (slog.Value, error) {
+	value := slog.AnyValue(nil)
+	for len(b) > 0 {
+		field, wireType, v, data, n := consumeProtoField(b)
+		if n < 0 {
+			return slog.Value{}, errInvalidProtoField
+		}
+		b = b[n:]
+
+		switch {
+		case field == 1 && wireType == protoWireBytes:
+			value = slog.StringValue(string(data))
+		case field == 2 && wireType == protoWireVarint:
+			value = slog.Int64Value(int64(v))
+		case field == 3 && wireType == protoWireVarint:
+			value = slog.Uint64Value(v)
+		case field == 4 && wireType == protoWireFixed64:
+			value = slog.Float64Value(math.Float64frombits(v))
+		case field == 5 && wireType == protoWireVarint:
+			value = slog.BoolValue(v != 0)
+		case field == 6 && wireType == protoWireVarint:
+			value = slog.DurationValue(time.Duration(v))
+		case field == 7 && wireType == protoWireFixed64:
+			value = slog.TimeValue(time.Unix(0, int64(v)))
+		case field == 8 && wireType == protoWireBytes:
+			value = slog.AnyValue(append([]byte{}, data...))
+		case field == 9 && wireType == protoWireBytes:
+			var attrs []slog.Attr
+			for len(data) > 0 {
+				field, wireType, _, attrData, n := consumeProtoField(data)
+				if n < 0 {
+					return slog.Value{}, errInvalidProtoField
+				}
+				data = data[n:]
+
+				if field == 1 && wireType == protoWireBytes {
+					attr, err := decodeProtoAttr(attrData)
+					if err != nil {
+						return slog.Value{}, err
+					}
+					attrs = append(attrs, attr)
+				}
+			}
+			value = slog.GroupValue(attrs...)
+		}
+	}
+	return value, nil
+}
+
+// NewProtoDecoder returns a ProtoDecoder that reads length-delimited loggy.v1.Record messages from r.
+func NewProtoDecoder(r io.Reader) *ProtoDecoder {
+	return &ProtoDecoder{r: bufio.NewReader(r)}
+}
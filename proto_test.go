@@ -0,0 +1,219 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewProtoHandler tests the ProtoHandler returned by NewProtoHandler with records that should be decoded back
+// into the same time, level, message and typed attributes by a ProtoDecoder.
+func TestNewProtoHandler(t *testing.T) {
+	// Create a handler that writes messages to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewProtoHandler(&outputStream).
+		WithAttrs([]slog.Attr{slog.String("service", "api")}).
+		WithGroup("request")
+
+	// Handle a record with all sorts of values, and one with zero values
+	now := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	record := slog.NewRecord(now, slog.LevelDebug, "this is a test log", 0)
+	record.AddAttrs(
+		slog.String("path", "/users/42"),
+		slog.Int("status", -404),
+		slog.Uint64("bytes", 1<<63),
+		slog.Float64("ratio", 0.5),
+		slog.Bool("cached", true),
+		slog.Duration("duration", -time.Second),
+		slog.Any("body", []byte{0x00, 0xff}),
+		slog.Any("missing", nil),
+		slog.Any("err", errors.New("boom")),
+		slog.Group("user", "id", 42, "admin", false),
+	)
+	assert.NoError(t, handler.Handle(context.Background(), record))
+	record = slog.NewRecord(now, slog.LevelInfo, "", 0)
+	record.AddAttrs(slog.String("empty", ""), slog.Int("zero", 0), slog.Bool("false", false))
+	assert.NoError(t, handler.Handle(context.Background(), record))
+
+	// Decode the first record
+	decoder := loggy.NewProtoDecoder(&outputStream)
+	decoded, err := decoder.Decode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, now.Equal(decoded.Time))
+	assert.Equal(t, slog.LevelDebug, decoded.Level)
+	assert.Equal(t, "this is a test log", decoded.Message)
+
+	var attrs []slog.Attr
+	decoded.Attrs(
+		func(attr slog.Attr) bool {
+			attrs = append(attrs, attr)
+			return true
+		},
+	)
+	assert.Equal(
+		t,
+		[]string{
+			"service=api",
+			"request=[path=/users/42 status=-404 bytes=9223372036854775808 ratio=0.5 cached=true duration=-1s " +
+				"body=[0 255] missing=<nil> err=boom user=[id=42 admin=false]]",
+		},
+		attrStrings(attrs),
+	)
+
+	// Decode the second record, whose zero values should keep their types
+	decoded, err = decoder.Decode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, slog.LevelInfo, decoded.Level)
+	assert.Equal(t, "", decoded.Message)
+	var kinds []slog.Kind
+	decoded.Attrs(
+		func(attr slog.Attr) bool {
+			if attr.Value.Kind() == slog.KindGroup {
+				for _, groupAttr := range attr.Value.Group() {
+					kinds = append(kinds, groupAttr.Value.Kind())
+				}
+			}
+			return true
+		},
+	)
+	assert.Equal(t, []slog.Kind{slog.KindString, slog.KindInt64, slog.KindBool}, kinds)
+
+	// Check that there are no records left
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+// TestNewProtoHandler_Wire tests that the ProtoHandler returned by NewProtoHandler writes the messages described by
+// ProtoSchema, preceded by their size.
+func TestNewProtoHandler_Wire(t *testing.T) {
+	// Log a small record without the time
+	var outputStream bytes.Buffer
+	handler := loggy.NewProtoHandler(
+		&outputStream, loggy.ProtoHandlerOpts{HandlerOptions: slog.HandlerOptions{ReplaceAttr: removeTime}},
+	)
+	slog.New(handler).Warn("hi", "n", 1)
+
+	// Check the bytes of the message
+	expected := []byte{
+		0x0f,       // The size of the message
+		0x10, 0x08, // level: 4, zigzag encoded
+		0x1a, 0x02, 'h', 'i', // message: "hi"
+		0x2a, 0x07, // attrs: an Attr of 7 bytes
+		0x0a, 0x01, 'n', // key: "n"
+		0x12, 0x02, 0x10, 0x01, // value: a Value with int_value: 1
+	}
+	assert.Equal(t, expected, outputStream.Bytes())
+
+	// Check that the schema describes the message
+	assert.True(t, strings.Contains(loggy.ProtoSchema, "message Record {"))
+	assert.True(t, strings.Contains(loggy.ProtoSchema, "package loggy.v1;"))
+}
+
+// TestNewProtoHandler_Times tests the ProtoHandler returned by NewProtoHandler with records logged at the Unix epoch
+// and at times that can't be represented in nanoseconds since the epoch, which should be decoded with a time.
+func TestNewProtoHandler_Times(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	for name, tt := range map[string]struct {
+		time     time.Time
+		expected time.Time
+	}{
+		"epoch":     {time: epoch, expected: epoch},
+		"too early": {time: time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC), expected: time.Unix(0, math.MinInt64)},
+		"too late":  {time: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), expected: time.Unix(0, math.MaxInt64)},
+	} {
+		t.Run(
+			name, func(t *testing.T) {
+				// Log a record at the time, with an attribute holding the same time
+				var outputStream bytes.Buffer
+				handler := loggy.NewProtoHandler(&outputStream)
+				record := slog.NewRecord(tt.time, slog.LevelInfo, "this is a test log", 0)
+				record.AddAttrs(slog.Time("at", tt.time))
+				if err := handler.Handle(context.Background(), record); err != nil {
+					t.Fatal(err)
+				}
+
+				// Decode the record and check the times
+				decoded, err := loggy.NewProtoDecoder(&outputStream).Decode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, tt.expected.Equal(decoded.Time), decoded.Time)
+				decoded.Attrs(
+					func(attr slog.Attr) bool {
+						assert.True(t, tt.expected.Equal(attr.Value.Time()), attr.Value.Time())
+						return true
+					},
+				)
+			},
+		)
+	}
+}
+
+// TestNewProtoHandler_Source tests the ProtoHandler returned by NewProtoHandler with AddSource, where the source
+// location should be decoded as the first attribute.
+func TestNewProtoHandler_Source(t *testing.T) {
+	// Log a record with its source location
+	var outputStream bytes.Buffer
+	handler := loggy.NewProtoHandler(
+		&outputStream, loggy.ProtoHandlerOpts{HandlerOptions: slog.HandlerOptions{AddSource: true}},
+	)
+	slog.New(handler).Error("this is a test log")
+
+	// Decode the record
+	decoded, err := loggy.NewProtoDecoder(&outputStream).Decode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, slog.LevelError, decoded.Level)
+	assert.Equal(t, 1, decoded.NumAttrs())
+	decoded.Attrs(
+		func(attr slog.Attr) bool {
+			source := attr.Value.Any().(*slog.Source)
+			assert.Equal(t, slog.SourceKey, attr.Key)
+			assert.Equal(t, "github.com/ksdfg/loggy_test.TestNewProtoHandler_Source", source.Function)
+			assert.True(t, strings.HasSuffix(source.File, "proto_test.go"))
+			assert.NotZero(t, source.Line)
+			return true
+		},
+	)
+}
+
+// TestProtoDecoder_Invalid tests the ProtoDecoder with messages that are incomplete or invalid, and with unknown
+// fields, which should be skipped.
+func TestProtoDecoder_Invalid(t *testing.T) {
+	// Incomplete messages
+	for _, incomplete := range [][]byte{{0x80}, {0x05, 0x1a, 0x03}} {
+		_, err := loggy.NewProtoDecoder(bytes.NewReader(incomplete)).Decode()
+		assert.Equal(t, io.ErrUnexpectedEOF, err, incomplete)
+	}
+
+	// Invalid messages
+	for _, invalid := range [][]byte{
+		{0x02, 0x1a, 0x05},
+		{0x01, 0x00},
+		{0x02, 0x2a, 0x01},
+		{0x02, 0x0f, 0x00},
+	} {
+		_, err := loggy.NewProtoDecoder(bytes.NewReader(invalid)).Decode()
+		assert.Error(t, err, invalid)
+	}
+
+	// A message with an unknown field before the message
+	decoded, err := loggy.NewProtoDecoder(bytes.NewReader([]byte{0x06, 0xa0, 0x06, 0x01, 0x1a, 0x01, 'x'})).Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "x", decoded.Message)
+}
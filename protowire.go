@@ -0,0 +1,136 @@
+package loggy
+
+import "encoding/binary"
+
+// Wire types of the protocol buffers encoding.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// appendProtoVarint appends v to b as a base 128 varint.
+func appendProtoVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// appendProtoTag appends the tag of a field, made of its number and wire type, to b.
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return appendProtoVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendProtoVarintField appends a varint field to b. Fields with a zero value are omitted, as they are in proto3.
+func appendProtoVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireVarint)
+	return appendProtoVarint(b, v)
+}
+
+// appendProtoFixed64Field appends a fixed64 field to b. Fields with a zero value are omitted, as they are in proto3.
+func appendProtoFixed64Field(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+// appendProtoFixed32Field appends a fixed32 field to b. Fields with a zero value are omitted, as they are in proto3.
+func appendProtoFixed32Field(b []byte, field int, v uint32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// appendProtoBytesField appends a length-delimited field to b, which is used for bytes, strings and embedded
+// messages. Empty fields are omitted, as they are in proto3.
+func appendProtoBytesField(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireBytes)
+	b = appendProtoVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoStringField appends a string field to b. Empty fields are omitted, as they are in proto3.
+func appendProtoStringField(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireBytes)
+	b = appendProtoVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoMessageField appends an embedded message field to b. Unlike other fields, it is written even if the
+// message is empty, as an empty message is different from a missing one.
+func appendProtoMessageField(b []byte, field int, message []byte) []byte {
+	b = appendProtoTag(b, field, protoWireBytes)
+	b = appendProtoVarint(b, uint64(len(message)))
+	return append(b, message...)
+}
+
+// appendProtoZigzag appends a signed integer to b as a zigzag encoded varint, which is how sint64 fields are encoded.
+func appendProtoZigzag(b []byte, v int64) []byte {
+	return appendProtoVarint(b, uint64(v<<1)^uint64(v>>63))
+}
+
+// consumeProtoVarint reads a base 128 varint from the start of b, returning it along with the number of bytes it
+// took. The number of bytes is negative if b doesn't start with a valid varint.
+func consumeProtoVarint(b []byte) (uint64, int) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, -1
+	}
+	return v, n
+}
+
+// consumeProtoField reads a field from the start of b, returning its number and wire type, its value and the number
+// of bytes it took. Varints and fixed numbers are returned in v, and the content of length-delimited fields in data.
+// The number of bytes is negative if b doesn't start with a valid field.
+func consumeProtoField(b []byte) (field int, wireType int, v uint64, data []byte, n int) {
+	tag, n := consumeProtoVarint(b)
+	if n < 0 || tag>>3 == 0 {
+		return 0, 0, 0, nil, -1
+	}
+	field, wireType = int(tag>>3), int(tag&7)
+
+	switch wireType {
+	case protoWireVarint:
+		value, m := consumeProtoVarint(b[n:])
+		if m < 0 {
+			return 0, 0, 0, nil, -1
+		}
+		return field, wireType, value, nil, n + m
+	case protoWireFixed64:
+		if len(b[n:]) < 8 {
+			return 0, 0, 0, nil, -1
+		}
+		return field, wireType, binary.LittleEndian.Uint64(b[n:]), nil, n + 8
+	case protoWireFixed32:
+		if len(b[n:]) < 4 {
+			return 0, 0, 0, nil, -1
+		}
+		return field, wireType, uint64(binary.LittleEndian.Uint32(b[n:])), nil, n + 4
+	case protoWireBytes:
+		size, m := consumeProtoVarint(b[n:])
+		if m < 0 || size > uint64(len(b[n+m:])) {
+			return 0, 0, 0, nil, -1
+		}
+		n += m
+		return field, wireType, 0, b[n : n+int(size)], n + int(size)
+	default:
+		return 0, 0, 0, nil, -1
+	}
+}
+
+// decodeProtoZigzag decodes a zigzag encoded varint back into a signed integer.
+func decodeProtoZigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,351 @@
+package loggy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitDefaultRate is the default number of records with the same key allowed per second.
+	rateLimitDefaultRate = 10
+
+	// rateLimitDefaultBurst is the default number of records with the same key allowed in a burst.
+	rateLimitDefaultBurst = 10
+)
+
+// RateLimitHandlerOpts represents the options for configuring the behaviour of the `RateLimitHandler`.
+type RateLimitHandlerOpts struct {
+	// Rate is the number of records with the same key that are allowed per second, on average. By default, it is 10.
+	Rate float64
+
+	// Burst is the number of records with the same key that are allowed at once, before they are limited to the rate.
+	// By default, it is 10.
+	Burst int
+
+	// Keys are the keys of the attributes that are part of the key of a record, along with its message, e.g. "error".
+	// Attributes are matched by their key, whether they were added to the record or to the logger, ignoring groups.
+	Keys []string
+
+	// DowngradeLevel is the level that records over the limit are logged at, instead of being suppressed. If it is
+	// nil, records over the limit are suppressed.
+	DowngradeLevel slog.Leveler
+}
+
+// rateLimitBucket is the token bucket of the records with the same key.
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+
+	// suppressed is the number of records that were suppressed since the last summary, and handler, level, message
+	// and attrs are the details of the summary record logged for them
+	suppressed int
+	handler    slog.Handler
+	level      slog.Level
+	message    string
+	attrs      []slog.Attr
+}
+
+// rateLimitSummary is a summary of the records with the same key that were suppressed, waiting to be logged.
+type rateLimitSummary struct {
+	handler    slog.Handler
+	level      slog.Level
+	message    string
+	attrs      []slog.Attr
+	suppressed int
+}
+
+// rateLimiter holds the token buckets of all the keys. It is shared between a RateLimitHandler and all the handlers
+// derived from it.
+type rateLimiter struct {
+	opts RateLimitHandlerOpts
+
+	// mu guards the buckets
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// RateLimitHandler is a handler that limits the rate of records with the same key passed on to another handler using
+// token buckets, to protect it from log storms.
+//
+// The key of a record is its message and the values of the configured attributes. Records over the limit are either
+// suppressed or downgraded to a lower level. When the records with a key are allowed again, or the burst has ended, a
+// record saying how many similar records were suppressed is logged.
+type RateLimitHandler struct {
+	handler slog.Handler
+	limiter *rateLimiter
+
+	// attrs are the attributes added to the handler, which may be part of the key of a record
+	attrs []slog.Attr
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle passes the record on to the wrapped handler if its key is within the limit. Otherwise, the record is
+// downgraded or suppressed.
+func (h *RateLimitHandler) Handle(ctx context.Context, record slog.Record) error {
+	key, keyAttrs := h.key(record)
+	allowed, summary := h.limiter.allow(key, time.Now(), h.handler, record, keyAttrs)
+
+	// Log the summary of the records that were suppressed before this one was allowed
+	var errs []error
+	if summary != nil {
+		errs = append(errs, summary.log(ctx))
+	}
+
+	switch {
+	case allowed:
+		errs = append(errs, h.handler.Handle(ctx, record))
+	case h.limiter.opts.DowngradeLevel != nil:
+		record.Level = h.limiter.opts.DowngradeLevel.Level()
+		if h.handler.Enabled(ctx, record.Level) {
+			errs = append(errs, h.handler.Handle(ctx, record))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WithAttrs returns a new RateLimitHandler that passes records on to the wrapped handler with the given attributes.
+func (h *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &RateLimitHandler{
+		handler: h.handler.WithAttrs(attrs),
+		limiter: h.limiter,
+		attrs:   append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...),
+	}
+}
+
+// WithGroup returns a new RateLimitHandler that passes records on to the wrapped handler with the given group.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *RateLimitHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &RateLimitHandler{handler: h.handler.WithGroup(name), limiter: h.limiter, attrs: h.attrs}
+}
+
+// Close stops the background goroutine and logs the summaries of all the records that are still suppressed. It is
+// shared by all the handlers derived from this one.
+func (h *RateLimitHandler) Close() error {
+	var err error
+	h.limiter.closeOnce.Do(
+		func() {
+			close(h.limiter.done)
+			<-h.limiter.stopped
+			err = logRateLimitSummaries(h.limiter.sweep(true))
+		},
+	)
+	return err
+}
+
+// key returns the key of a record, made of its message and the values of the configured attributes, along with the
+// attributes that were found.
+func (h *RateLimitHandler) key(record slog.Record) (string, []slog.Attr) {
+	if len(h.limiter.opts.Keys) == 0 {
+		return record.Message, nil
+	}
+
+	// Find the values of the key attributes, with the attributes of the record taking precedence
+	values := make(map[string]slog.Attr, len(h.limiter.opts.Keys))
+	find := func(attr slog.Attr) bool {
+		for _, key := range h.limiter.opts.Keys {
+			if attr.Key == key {
+				values[key] = attr
+			}
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		find(attr)
+	}
+	record.Attrs(find)
+
+	// Build the key in the order of the configured keys
+	var builder strings.Builder
+	builder.WriteString(record.Message)
+	var keyAttrs []slog.Attr
+	for _, key := range h.limiter.opts.Keys {
+		builder.WriteByte(0)
+		if attr, ok := values[key]; ok {
+			builder.WriteString(attr.Value.Resolve().String())
+			keyAttrs = append(keyAttrs, attr)
+		}
+	}
+
+	return builder.String(), keyAttrs
+}
+
+// allow reports whether a record with the given key is within the limit, taking a token from its bucket if it is. If
+// records with the key were suppressed before it, their summary is returned so that it can be logged first.
+//
+// If the record is over the limit and isn't going to be downgraded, it is counted as suppressed, remembering the
+// handler and key attributes needed to log its summary.
+func (l *rateLimiter) allow(
+	key string, now time.Time, handler slog.Handler, record slog.Record, keyAttrs []slog.Attr,
+) (bool, *rateLimitSummary) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: float64(l.opts.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.refill(now, l.opts)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, bucket.takeSummary()
+	}
+
+	if l.opts.DowngradeLevel == nil {
+		if bucket.suppressed == 0 || record.Level > bucket.level {
+			bucket.level = record.Level
+		}
+		bucket.suppressed++
+		bucket.handler = handler
+		bucket.message = record.Message
+		bucket.attrs = keyAttrs
+	}
+	return false, nil
+}
+
+// sweep removes the buckets that have filled up again, returning the summaries of the records that were suppressed
+// in them. If all is true, the summaries of all the buckets are returned.
+func (l *rateLimiter) sweep(all bool) []*rateLimitSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var summaries []*rateLimitSummary
+	for key, bucket := range l.buckets {
+		bucket.refill(now, l.opts)
+		if !all && bucket.tokens < float64(l.opts.Burst) {
+			continue
+		}
+
+		if summary := bucket.takeSummary(); summary != nil {
+			summaries = append(summaries, summary)
+		}
+		delete(l.buckets, key)
+	}
+
+	return summaries
+}
+
+// run logs the summaries of the bursts that have ended, until the rate limiter is closed.
+func (l *rateLimiter) run() {
+	defer close(l.stopped)
+
+	// Check for ended bursts at about the rate tokens are added, but not too often or too rarely
+	interval := time.Duration(float64(time.Second) / l.opts.Rate)
+	interval = min(max(interval, 10*time.Millisecond), time.Second)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			// There is nowhere to report the error
+			_ = logRateLimitSummaries(l.sweep(false))
+		}
+	}
+}
+
+// refill adds the tokens accumulated since the bucket was last refilled, up to the burst.
+func (b *rateLimitBucket) refill(now time.Time, opts RateLimitHandlerOpts) {
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*opts.Rate, float64(opts.Burst))
+	b.last = now
+}
+
+// takeSummary returns the summary of the records that were suppressed in the bucket and resets its counter, or nil
+// if none were suppressed.
+func (b *rateLimitBucket) takeSummary() *rateLimitSummary {
+	if b.suppressed == 0 {
+		return nil
+	}
+
+	summary := &rateLimitSummary{
+		handler:    b.handler,
+		level:      b.level,
+		message:    b.message,
+		attrs:      b.attrs,
+		suppressed: b.suppressed,
+	}
+	b.suppressed = 0
+	b.handler = nil
+	b.attrs = nil
+
+	return summary
+}
+
+// log logs a record saying how many similar records were suppressed, with the message and key attributes of the
+// records, using the handler that suppressed the last of them.
+func (s *rateLimitSummary) log(ctx context.Context) error {
+	if !s.handler.Enabled(ctx, s.level) {
+		return nil
+	}
+
+	record := slog.NewRecord(time.Now(), s.level, fmt.Sprintf("suppressed %d similar records", s.suppressed), 0)
+	record.AddAttrs(slog.Int("suppressed", s.suppressed), slog.String("suppressed_msg", s.message))
+	record.AddAttrs(s.attrs...)
+	return s.handler.Handle(ctx, record)
+}
+
+// logRateLimitSummaries logs all the given summaries, returning the errors of the ones that could not be logged.
+func logRateLimitSummaries(summaries []*rateLimitSummary) error {
+	errs := make([]error, 0, len(summaries))
+	for _, summary := range summaries {
+		errs = append(errs, summary.log(context.Background()))
+	}
+	return errors.Join(errs...)
+}
+
+// NewRateLimitHandler returns a RateLimitHandler that limits the rate of records with the same key passed on to the
+// given handler.
+//
+// The handler should be closed to log the summaries of the records that are still suppressed.
+func NewRateLimitHandler(handler slog.Handler, options ...RateLimitHandlerOpts) *RateLimitHandler {
+	// If options are provided, assign the first option to opts
+	var opts RateLimitHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Rate <= 0 {
+		opts.Rate = rateLimitDefaultRate
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = rateLimitDefaultBurst
+	}
+
+	// Start logging the summaries of ended bursts in the background
+	limiter := &rateLimiter{
+		opts:    opts,
+		buckets: make(map[string]*rateLimitBucket),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go limiter.run()
+
+	return &RateLimitHandler{handler: handler, limiter: limiter}
+}
@@ -0,0 +1,107 @@
+package loggy_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewRateLimitHandler tests the RateLimitHandler returned by NewRateLimitHandler with a storm of records keyed by
+// their message and error, of which only the first ones of every key should be logged, followed by a summary of the
+// suppressed ones when the handler is closed.
+func TestNewRateLimitHandler(t *testing.T) {
+	// Create a logger that limits records by message and error before logging them to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewRateLimitHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.RateLimitHandlerOpts{Rate: 0.001, Burst: 3, Keys: []string{"error"}},
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log a storm of records with two different errors
+	for i := 0; i < 10; i++ {
+		logger.Error("request failed", "error", "timeout", "i", i)
+	}
+	logger.With("error", "refused").Error("request failed")
+	logger.With("error", "refused").Error("request failed")
+	assert.NoError(t, handler.Close())
+
+	// Check the records that were logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 6) {
+		return
+	}
+	for i, log := range logs[:3] {
+		assert.Equal(t, "timeout", log["error"])
+		assert.Equal(t, float64(i), log["i"])
+	}
+	assert.Equal(t, "refused", logs[3]["error"])
+	assert.Equal(t, "refused", logs[4]["error"])
+
+	// Check the summary of the suppressed records
+	summary := logs[5]
+	assert.Equal(t, "ERROR", summary["level"])
+	assert.Equal(t, "suppressed 7 similar records", summary["msg"])
+	assert.Equal(t, float64(7), summary["suppressed"])
+	assert.Equal(t, "request failed", summary["suppressed_msg"])
+	assert.Equal(t, "timeout", summary["error"])
+	assert.Equal(t, "api", summary["service"])
+}
+
+// TestNewRateLimitHandler_BurstEnded tests the RateLimitHandler returned by NewRateLimitHandler with records logged
+// again after the burst has ended, which should be preceded by a summary of the suppressed records.
+func TestNewRateLimitHandler_BurstEnded(t *testing.T) {
+	// Create a logger that allows one record every 50 milliseconds
+	var outputStream syncBuffer
+	handler := loggy.NewRateLimitHandler(
+		slog.NewJSONHandler(&outputStream, nil), loggy.RateLimitHandlerOpts{Rate: 20, Burst: 1},
+	)
+	logger := slog.New(handler)
+
+	// Log a burst of records, and then another record after the burst has ended
+	for i := 0; i < 3; i++ {
+		logger.Info("retrying")
+	}
+	time.Sleep(100 * time.Millisecond)
+	logger.Info("retrying")
+	assert.NoError(t, handler.Close())
+
+	// Check that the summary was logged between the records
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 3) {
+		assert.Equal(t, "retrying", logs[0]["msg"])
+		assert.Equal(t, "suppressed 2 similar records", logs[1]["msg"])
+		assert.Equal(t, "retrying", logs[2]["msg"])
+	}
+}
+
+// TestNewRateLimitHandler_Downgrade tests the RateLimitHandler returned by NewRateLimitHandler configured to
+// downgrade records over the limit, which should be logged at the lower level instead of being suppressed.
+func TestNewRateLimitHandler_Downgrade(t *testing.T) {
+	// Create a logger that downgrades records over the limit to DEBUG
+	var outputStream bytes.Buffer
+	handler := loggy.NewRateLimitHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		loggy.RateLimitHandlerOpts{Rate: 0.001, Burst: 1, DowngradeLevel: slog.LevelDebug},
+	)
+	logger := slog.New(handler)
+
+	// Log a few records
+	for i := 0; i < 3; i++ {
+		logger.Error("request failed")
+	}
+	assert.NoError(t, handler.Close())
+
+	// Check the levels of the records, and that no summary was logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 3) {
+		assert.Equal(t, "ERROR", logs[0]["level"])
+		assert.Equal(t, "DEBUG", logs[1]["level"])
+		assert.Equal(t, "DEBUG", logs[2]["level"])
+	}
+}
@@ -0,0 +1,159 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// LevelFatal is a custom level above ERROR, for errors the program can't recover from, like panics.
+const LevelFatal = slog.LevelError + 4
+
+// StackFrame is a single frame of a stack trace.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// RecoverOpts represents the options for configuring how panics are recovered by the middleware returned by
+// `NewRecoverMiddleware` and by `Go`.
+type RecoverOpts struct {
+	// Level is the level panics are logged at. By default, it is ERROR. Use LevelFatal to log them as fatal errors.
+	Level slog.Leveler
+
+	// RePanic specifies whether to panic again with the same value after the panic has been logged. By default, panics
+	// in HTTP handlers are turned into 500 Internal Server Error responses, and panics in goroutines are swallowed.
+	RePanic bool
+
+	// Message is the message of the records panics are logged with. By default, it is "panic recovered".
+	Message string
+}
+
+// withDefaults returns a copy of the options with the defaults set.
+func (opts RecoverOpts) withDefaults() RecoverOpts {
+	if opts.Level == nil {
+		opts.Level = slog.LevelError
+	}
+	if opts.Message == "" {
+		opts.Message = "panic recovered"
+	}
+	return opts
+}
+
+// logPanic logs a recovered panic with its value and the stack trace of where it happened, using the logger stored
+// in the context so that the record gets the request scoped attributes.
+func logPanic(ctx context.Context, value any, opts RecoverOpts) {
+	LoggerFromContext(ctx).LogAttrs(
+		ctx,
+		opts.Level.Level(),
+		opts.Message,
+		slog.Any("panic", value),
+		slog.Any("stack", panicStack()),
+	)
+}
+
+// panicStack returns the stack trace of the panicking goroutine, starting from the function that panicked. It must be
+// called from the function that recovered the panic, or a function called by it.
+func panicStack() []StackFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []StackFrame
+	for {
+		frame, more := frames.Next()
+
+		// Everything before runtime.gopanic is the deferred function that recovered the panic
+		switch {
+		case frame.Function == "runtime.gopanic":
+			stack = stack[:0]
+		case len(stack) == 0 && strings.HasPrefix(frame.Function, "runtime."):
+			// Skip the runtime functions that raise panics like nil dereferences
+		default:
+			stack = append(stack, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+// NewRecoverMiddleware returns net/http middleware that recovers panics in the handlers it wraps and logs them with
+// the panic value and a structured stack trace, using the logger from LoggerFromContext.
+//
+// If it is wrapped by the middleware returned by NewHTTPMiddleware, panics are logged with the request scoped logger,
+// and the 500 Internal Server Error response is logged in the access record. The 500 response is only written if the
+// handler hadn't written a response before panicking, since its status code can't be changed afterwards.
+func NewRecoverMiddleware(options ...RecoverOpts) func(http.Handler) http.Handler {
+	// If options are provided, assign the first option to opts
+	var opts RecoverOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts = opts.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				// Record whether a response has been written before the handler panics
+				recorder := &responseRecorder{ResponseWriter: w}
+				defer func() {
+					value := recover()
+					if value == nil {
+						return
+					}
+
+					// http.ErrAbortHandler is used to abort a response on purpose, so it is not logged
+					if value == http.ErrAbortHandler {
+						panic(value)
+					}
+
+					logPanic(r.Context(), value, opts)
+					if opts.RePanic {
+						panic(value)
+					}
+					if recorder.status == 0 {
+						http.Error(
+							recorder, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError,
+						)
+					}
+				}()
+
+				next.ServeHTTP(recorder, r)
+			},
+		)
+	}
+}
+
+// Go runs fn in a new goroutine, recovering and logging any panic in it with the panic value and a structured stack
+// trace, using the logger from LoggerFromContext.
+func Go(ctx context.Context, fn func(ctx context.Context), options ...RecoverOpts) {
+	// If options are provided, assign the first option to opts
+	var opts RecoverOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts = opts.withDefaults()
+
+	go func() {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+
+			logPanic(ctx, value, opts)
+			if opts.RePanic {
+				panic(value)
+			}
+		}()
+
+		fn(ctx)
+	}()
+}
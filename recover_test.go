@@ -0,0 +1,209 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// syncBuffer is a bytes.Buffer that can be written to and read from different goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write writes p to the buffer.
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the contents of the buffer.
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// panickingHandler is an HTTP handler that always panics.
+func panickingHandler(w http.ResponseWriter, r *http.Request) {
+	panic(errors.New("something went wrong"))
+}
+
+// TestNewRecoverMiddleware tests the middleware returned by NewRecoverMiddleware with a handler that panics, wrapped
+// by the middleware returned by NewHTTPMiddleware so that the panic is logged with the request scoped logger.
+func TestNewRecoverMiddleware(t *testing.T) {
+	// Create the middleware chain that logs to a buffer
+	var outputStream bytes.Buffer
+	httpMiddleware := loggy.NewHTTPMiddleware(
+		slog.NewJSONHandler(&outputStream, nil),
+		loggy.HTTPMiddlewareOpts{GenerateRequestID: func() string { return "request-id" }},
+	)
+	recoverMiddleware := loggy.NewRecoverMiddleware()
+	handler := httpMiddleware(recoverMiddleware(http.HandlerFunc(panickingHandler)))
+
+	// Serve a request
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Check the response
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+
+	// Check the panic was logged with the request ID and a stack trace starting at the handler
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	panicLog := logs[0]
+	assert.Equal(t, "ERROR", panicLog["level"])
+	assert.Equal(t, "panic recovered", panicLog["msg"])
+	assert.Equal(t, "something went wrong", panicLog["panic"])
+	assert.Equal(t, "request-id", panicLog["request_id"])
+	stack := panicLog["stack"].([]any)
+	if assert.NotEmpty(t, stack) {
+		frame := stack[0].(map[string]any)
+		assert.Equal(t, "github.com/ksdfg/loggy_test.panickingHandler", frame["function"])
+		assert.True(t, strings.HasSuffix(frame["file"].(string), "recover_test.go"))
+		assert.NotZero(t, frame["line"])
+	}
+
+	// Check the access record has the status of the error response
+	assert.Equal(t, float64(500), logs[1]["http"].(map[string]any)["status"])
+}
+
+// TestNewRecoverMiddleware_RePanic tests the middleware returned by NewRecoverMiddleware configured to panic again
+// after logging the panic at the fatal level.
+func TestNewRecoverMiddleware_RePanic(t *testing.T) {
+	// Create a middleware that logs to a buffer using the logger from the context
+	var outputStream bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&outputStream, nil))
+	middleware := loggy.NewRecoverMiddleware(loggy.RecoverOpts{Level: loggy.LevelFatal, RePanic: true})
+	handler := middleware(http.HandlerFunc(panickingHandler))
+
+	// Serve a request, which should panic again
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request = request.WithContext(loggy.ContextWithLogger(request.Context(), logger))
+	assert.Panics(t, func() { handler.ServeHTTP(httptest.NewRecorder(), request) })
+
+	// Check the panic was logged as fatal
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "ERROR+4", logs[0]["level"])
+	}
+}
+
+// TestNewRecoverMiddleware_AbortHandler tests the middleware returned by NewRecoverMiddleware with a handler that
+// aborts the response on purpose, which should not be logged.
+func TestNewRecoverMiddleware_AbortHandler(t *testing.T) {
+	// Create a middleware that logs to a buffer using the logger from the context
+	var outputStream bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&outputStream, nil))
+	middleware := loggy.NewRecoverMiddleware()
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }))
+
+	// Serve a request, which should still abort
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request = request.WithContext(loggy.ContextWithLogger(request.Context(), logger))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { handler.ServeHTTP(httptest.NewRecorder(), request) })
+
+	// Check nothing was logged
+	assert.Empty(t, outputStream.String())
+}
+
+// headerCountingRecorder is an httptest.ResponseRecorder that counts how many times WriteHeader is called.
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	writeHeaderCalls int
+}
+
+// WriteHeader counts the call and writes the status code to the wrapped recorder.
+func (r *headerCountingRecorder) WriteHeader(status int) {
+	r.writeHeaderCalls++
+	r.ResponseRecorder.WriteHeader(status)
+}
+
+// TestNewRecoverMiddleware_ResponseWritten tests the middleware returned by NewRecoverMiddleware with a handler that
+// panics after writing a response, which should be logged without writing the 500 response over it.
+func TestNewRecoverMiddleware_ResponseWritten(t *testing.T) {
+	// Create the middleware chain around a handler that writes a response before panicking
+	var outputStream bytes.Buffer
+	httpMiddleware := loggy.NewHTTPMiddleware(slog.NewJSONHandler(&outputStream, nil))
+	recoverMiddleware := loggy.NewRecoverMiddleware()
+	handler := httpMiddleware(
+		recoverMiddleware(
+			http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusAccepted)
+					_, _ = w.Write([]byte("partial"))
+					panic("something went wrong")
+				},
+			),
+		),
+	)
+
+	// Serve a request
+	response := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Check that the response written by the handler was left as it was
+	assert.Equal(t, 1, response.writeHeaderCalls)
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "partial", response.Body.String())
+
+	// Check that the panic and the access record were logged
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "panic recovered", logs[0]["msg"])
+		assert.Equal(t, float64(http.StatusAccepted), logs[1]["http"].(map[string]any)["status"])
+	}
+}
+
+// TestGo tests the Go function with a goroutine that panics, which should be logged with the attributes from the
+// context instead of crashing the program.
+func TestGo(t *testing.T) {
+	// Create a context with a logger that adds the attributes from the context
+	var outputStream syncBuffer
+	logger := slog.New(loggy.NewContextHandler(slog.NewJSONHandler(&outputStream, nil)))
+	ctx := loggy.ContextWithLogger(context.Background(), logger)
+	ctx = loggy.WithContextAttrs(ctx, slog.String("job", "cleanup"))
+
+	// Run a goroutine that panics
+	loggy.Go(
+		ctx,
+		func(ctx context.Context) {
+			var values map[string]int
+			values["key"] = 1
+		},
+	)
+
+	// Wait for the panic to be logged
+	deadline := time.Now().Add(5 * time.Second)
+	for outputStream.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Check the panic was logged with the attributes from the context
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	assert.Equal(t, "ERROR", logs[0]["level"])
+	assert.Equal(t, "cleanup", logs[0]["job"])
+	assert.Equal(t, "assignment to entry in nil map", logs[0]["panic"])
+	stack := logs[0]["stack"].([]any)
+	if assert.NotEmpty(t, stack) {
+		assert.Equal(t, "github.com/ksdfg/loggy_test.TestGo.func1", stack[0].(map[string]any)["function"])
+	}
+}
@@ -0,0 +1,271 @@
+package loggy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactMask is the value that redacted values are replaced with by default.
+const DefaultRedactMask = "[REDACTED]"
+
+var (
+	// RedactCreditCardPattern matches credit card numbers, with or without spaces or dashes between the digits. The
+	// RedactHandler only redacts the matches whose digits pass the Luhn check, so that other long numbers like order
+	// IDs and timestamps are left as they are.
+	RedactCreditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+	// RedactEmailPattern matches email addresses.
+	RedactEmailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+
+	// RedactJWTPattern matches JSON web tokens.
+	RedactJWTPattern = regexp.MustCompile(`eyJ[a-zA-Z0-9_-]+\.eyJ[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+`)
+
+	// RedactAWSKeyPattern matches AWS access key IDs.
+	RedactAWSKeyPattern = regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`)
+
+	// DefaultRedactKeys are the keys of the attributes whose values are redacted by default.
+	DefaultRedactKeys = []string{
+		"password", "passwd", "secret", "token", "access_token", "refresh_token", "api_key", "apikey", "authorization",
+		"cookie", "ssn",
+	}
+
+	// DefaultRedactPatterns are the patterns that are redacted from strings by default.
+	DefaultRedactPatterns = []*regexp.Regexp{
+		RedactCreditCardPattern, RedactEmailPattern, RedactJWTPattern, RedactAWSKeyPattern,
+	}
+)
+
+// Redactable is implemented by types that know how to redact themselves, e.g. a type holding a card number that
+// should only be logged with its last four digits. The RedactHandler logs the value returned by Redacted in their
+// place.
+type Redactable interface {
+	Redacted() slog.Value
+}
+
+// RedactHandlerOpts represents the options for configuring the behaviour of the `RedactHandler`.
+type RedactHandlerOpts struct {
+	// Keys are the keys of the attributes whose values are replaced by the mask, compared case-insensitively. If an
+	// attribute is a group, the whole group is replaced. By default, DefaultRedactKeys are used. Set it to an empty
+	// slice to not redact attributes by their key.
+	Keys []string
+
+	// Patterns are the regular expressions whose matches are replaced by the mask in the message and in string and
+	// other values. Values that aren't strings are rendered as strings, e.g. errors by their messages and structs as
+	// JSON, and logged as the redacted string if anything in them matched. By default, DefaultRedactPatterns are
+	// used. Set it to an empty slice to not redact anything by pattern.
+	Patterns []*regexp.Regexp
+
+	// Mask is the value that redacted values are replaced with. By default, it is "[REDACTED]".
+	Mask string
+}
+
+// RedactHandler is a handler that redacts personal information and secrets from records before passing them on to
+// another handler.
+//
+// Values are redacted by the key of their attribute, by regular expressions over strings and the message, and by
+// their type if they implement Redactable. Attributes in nested groups and the values returned by slog.LogValuers are
+// redacted as well.
+//
+// To apply different policies to different sinks, wrap the children of a CombinedHandler individually, e.g. to mask
+// values in the records sent to a remote sink while showing them in the console.
+type RedactHandler struct {
+	handler slog.Handler
+	opts    RedactHandlerOpts
+	keys    map[string]struct{}
+	goas    []groupOrAttrs
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle redacts the message and attributes of the record, and passes it on to the wrapped handler.
+func (h *RedactHandler) Handle(ctx context.Context, record slog.Record) error {
+	// Redact the attributes of the record, which the ones from WithAttrs were already redacted by
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			attrs = append(attrs, h.redactAttr(attr))
+			return true
+		},
+	)
+
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactString(record.Message), record.PC)
+	redacted.AddAttrs(attrs...)
+	if len(h.goas) > 0 {
+		redacted = recordWithAttrs(redacted, collectAttrs(h.goas, redacted, nil))
+	}
+
+	return h.handler.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a new RedactHandler whose attributes consist of both the receiver's attributes and the arguments,
+// redacted.
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+
+	return &RedactHandler{
+		handler: h.handler,
+		opts:    h.opts,
+		keys:    h.keys,
+		goas:    withGroupOrAttrs(h.goas, groupOrAttrs{attrs: redacted}),
+	}
+}
+
+// WithGroup returns a new RedactHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &RedactHandler{
+		handler: h.handler,
+		opts:    h.opts,
+		keys:    h.keys,
+		goas:    withGroupOrAttrs(h.goas, groupOrAttrs{group: name}),
+	}
+}
+
+// redactAttr returns the attribute with its value redacted, recursing into groups.
+func (h *RedactHandler) redactAttr(attr slog.Attr) slog.Attr {
+	// Mask the whole value if the key is sensitive
+	if _, ok := h.keys[strings.ToLower(attr.Key)]; ok {
+		return slog.String(attr.Key, h.opts.Mask)
+	}
+
+	// Let types redact themselves, before they are resolved so that Redacted takes precedence over LogValue, and
+	// again after, in case a slog.LogValuer resolves to a Redactable
+	attr.Value = redactableValue(attr.Value).Resolve()
+	attr.Value = redactableValue(attr.Value).Resolve()
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(h.redactString(attr.Value.String()))
+	case slog.KindGroup:
+		groupAttrs := make([]slog.Attr, len(attr.Value.Group()))
+		for i, groupAttr := range attr.Value.Group() {
+			groupAttrs[i] = h.redactAttr(groupAttr)
+		}
+		attr.Value = slog.GroupValue(groupAttrs...)
+	case slog.KindAny:
+		// Other values are rendered as strings to be redacted, and only replaced by them if something was redacted
+		rendered := anyToString(attr.Value.Any())
+		if redacted := h.redactString(rendered); redacted != rendered {
+			attr.Value = slog.StringValue(redacted)
+		}
+	}
+
+	return attr
+}
+
+// redactableValue returns the value returned by Redacted if the value is a Redactable, or the value itself otherwise.
+func redactableValue(value slog.Value) slog.Value {
+	if value.Kind() == slog.KindAny || value.Kind() == slog.KindLogValuer {
+		if redactable, ok := value.Any().(Redactable); ok {
+			return redactable.Redacted()
+		}
+	}
+	return value
+}
+
+// anyToString renders an arbitrary value as a string so that it can be redacted: errors and fmt.Stringers by their
+// methods, byte slices as they are and anything else as JSON, falling back to its Go representation.
+func anyToString(v any) string {
+	if data, ok := v.([]byte); ok {
+		return string(data)
+	}
+
+	converted := anyToJSON(v)
+	if s, ok := converted.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(converted)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(data)
+}
+
+// redactString replaces all the matches of the patterns in s by the mask. The matches of RedactCreditCardPattern are
+// only replaced if they pass the Luhn check.
+func (h *RedactHandler) redactString(s string) string {
+	for _, pattern := range h.opts.Patterns {
+		if pattern == RedactCreditCardPattern {
+			s = pattern.ReplaceAllStringFunc(
+				s, func(match string) string {
+					if !luhnValid(match) {
+						return match
+					}
+					return h.opts.Mask
+				},
+			)
+			continue
+		}
+		s = pattern.ReplaceAllLiteralString(s, h.opts.Mask)
+	}
+	return s
+}
+
+// luhnValid checks whether the digits in s pass the Luhn check that credit card numbers are validated with, ignoring
+// any other characters.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		// Double every second digit from the right, subtracting 9 if the result has two digits
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// NewRedactHandler returns a RedactHandler that redacts personal information and secrets from records before passing
+// them on to the given handler.
+func NewRedactHandler(handler slog.Handler, options ...RedactHandlerOpts) slog.Handler {
+	// If options are provided, assign the first option to opts
+	var opts RedactHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Keys == nil {
+		opts.Keys = DefaultRedactKeys
+	}
+	if opts.Patterns == nil {
+		opts.Patterns = DefaultRedactPatterns
+	}
+	if opts.Mask == "" {
+		opts.Mask = DefaultRedactMask
+	}
+
+	keys := make(map[string]struct{}, len(opts.Keys))
+	for _, key := range opts.Keys {
+		keys[strings.ToLower(key)] = struct{}{}
+	}
+
+	return &RedactHandler{handler: handler, opts: opts, keys: keys}
+}
@@ -0,0 +1,187 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RingBufferHandlerOpts represents the options for configuring the behaviour of the `RingBufferHandler`.
+type RingBufferHandlerOpts struct {
+	// Size is the number of records kept in the buffer. Once it is full, the oldest record is dropped for every new
+	// one. By default, it is 1000.
+	Size int
+
+	// MaxBytes limits the approximate size of the records kept in the buffer, measured as the length of their messages
+	// and the keys and values of their attributes. The oldest records are dropped until a new record fits. By default,
+	// there is no limit.
+	MaxBytes int
+
+	// HandlerOptions contains additional options for the handler. Set Level to slog.LevelDebug to keep debug records.
+	// AddSource adds the source location to the records dumped over HTTP, and ReplaceAttr is called for all the
+	// attributes before they are stored.
+	HandlerOptions slog.HandlerOptions
+}
+
+// ringEntry is a record stored in the buffer, along with its approximate size.
+type ringEntry struct {
+	record slog.Record
+	size   int
+}
+
+// ringBuffer is the buffer shared between a RingBufferHandler and the handlers derived from it.
+type ringBuffer struct {
+	mu      sync.Mutex
+	entries []ringEntry
+	start   int
+	count   int
+	bytes   int
+}
+
+// add stores a record, dropping the oldest records to make space for it.
+func (b *ringBuffer) add(entry ringEntry, maxBytes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Drop records until the new one fits
+	for b.count > 0 && (b.count == len(b.entries) || (maxBytes > 0 && b.bytes+entry.size > maxBytes)) {
+		b.bytes -= b.entries[b.start].size
+		b.entries[b.start] = ringEntry{}
+		b.start = (b.start + 1) % len(b.entries)
+		b.count--
+	}
+
+	b.entries[(b.start+b.count)%len(b.entries)] = entry
+	b.count++
+	b.bytes += entry.size
+}
+
+// snapshot returns the stored records, from the oldest to the newest.
+func (b *ringBuffer) snapshot() []slog.Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	records := make([]slog.Record, b.count)
+	for i := range records {
+		records[i] = b.entries[(b.start+i)%len(b.entries)].record.Clone()
+	}
+	return records
+}
+
+// RingBufferHandler is a handler that keeps the most recent records in memory instead of writing them anywhere, so
+// that they can be inspected after something goes wrong. Combined with other handlers at debug level, it gives the
+// debug context of a crash without writing debug records to disk.
+//
+// The records can be read with Snapshot, and the handler is also an http.Handler that dumps them as JSON or text. The
+// work of collecting the attributes of a record is done before the buffer is locked, so that concurrent loggers only
+// contend for the time it takes to store a record.
+type RingBufferHandler struct {
+	opts RingBufferHandlerOpts
+	buf  *ringBuffer
+	goas []groupOrAttrs
+}
+
+// Enabled reports whether the RingBufferHandler handles records at the given level.
+func (h *RingBufferHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.HandlerOptions.Level != nil {
+		minLevel = h.opts.HandlerOptions.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle stores the record in the buffer, with all the attributes added to the handler.
+func (h *RingBufferHandler) Handle(_ context.Context, record slog.Record) error {
+	attrs := collectAttrs(h.goas, record, h.opts.HandlerOptions.ReplaceAttr)
+
+	// Measure the record
+	size := len(record.Message)
+	flattenAttrs(
+		"", ".", attrs, func(key string, value slog.Value) { size += len(key) + len(valueToString(value)) },
+	)
+
+	h.buf.add(ringEntry{record: recordWithAttrs(record, attrs), size: size}, h.opts.MaxBytes)
+	return nil
+}
+
+// WithAttrs returns a new RingBufferHandler whose attributes consist of both the receiver's attributes and the
+// arguments. It stores records in the same buffer as the receiver.
+func (h *RingBufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &RingBufferHandler{opts: h.opts, buf: h.buf, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new RingBufferHandler with the given group appended to the receiver's existing groups. It
+// stores records in the same buffer as the receiver.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *RingBufferHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &RingBufferHandler{opts: h.opts, buf: h.buf, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// Snapshot returns copies of the records in the buffer, from the oldest to the newest. The records have all the
+// attributes added to the handler they were logged with.
+func (h *RingBufferHandler) Snapshot() []slog.Record {
+	return h.buf.snapshot()
+}
+
+// ServeHTTP dumps the records in the buffer, from the oldest to the newest, as JSON lines or, if the format query
+// parameter is "text", as text lines, as written by the handlers of the log/slog package. Records below the level in
+// the level query parameter (e.g. "WARN") are left out.
+func (h *RingBufferHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Parse the minimum level
+	var minLevel slog.Level = -1 << 31
+	if levelParam := r.URL.Query().Get("level"); levelParam != "" {
+		if err := minLevel.UnmarshalText([]byte(levelParam)); err != nil {
+			http.Error(w, "invalid level: "+levelParam, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create the handler that writes the dump
+	opts := &slog.HandlerOptions{AddSource: h.opts.HandlerOptions.AddSource, Level: minLevel}
+	var handler slog.Handler
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		http.Error(w, "invalid format: "+r.URL.Query().Get("format"), http.StatusBadRequest)
+		return
+	}
+
+	for _, record := range h.Snapshot() {
+		if record.Level < minLevel {
+			continue
+		}
+		if err := handler.Handle(r.Context(), record); err != nil {
+			return
+		}
+	}
+}
+
+// NewRingBufferHandler returns a RingBufferHandler that keeps the most recent records in memory.
+func NewRingBufferHandler(options ...RingBufferHandlerOpts) *RingBufferHandler {
+	// If options are provided, assign the first option to opts
+	var opts RingBufferHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+
+	return &RingBufferHandler{opts: opts, buf: &ringBuffer{entries: make([]ringEntry, opts.Size)}}
+}
@@ -0,0 +1,154 @@
+package loggy_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// recordMessages returns the messages of records, so that they can be compared.
+func recordMessages(records []slog.Record) []string {
+	messages := make([]string, len(records))
+	for i, record := range records {
+		messages[i] = record.Message
+	}
+	return messages
+}
+
+// TestNewRingBufferHandler tests the RingBufferHandler returned by NewRingBufferHandler, which should keep the most
+// recent records along with the attributes of the handlers they were logged with.
+func TestNewRingBufferHandler(t *testing.T) {
+	// Create a buffer for 3 records, shared by loggers with different attributes
+	handler := loggy.NewRingBufferHandler(loggy.RingBufferHandlerOpts{Size: 3})
+	logger := slog.New(handler)
+	requestLogger := logger.With("request_id", "abc").WithGroup("request")
+
+	// Log more records than the buffer can hold
+	logger.Info("first")
+	logger.Info("second")
+	requestLogger.Info("third", "path", "/users/42")
+	logger.Debug("ignored")
+	logger.Warn("fourth")
+
+	// Check that the oldest record was dropped
+	records := handler.Snapshot()
+	assert.Equal(t, []string{"second", "third", "fourth"}, recordMessages(records))
+
+	// Check the attributes of the record logged with attributes
+	var attrs []slog.Attr
+	records[1].Attrs(
+		func(attr slog.Attr) bool {
+			attrs = append(attrs, attr)
+			return true
+		},
+	)
+	assert.Equal(t, []string{"request_id=abc", "request=[path=/users/42]"}, attrStrings(attrs))
+
+	// Check that snapshots are copies
+	records[0].AddAttrs(slog.String("added", "later"))
+	assert.Equal(t, 0, handler.Snapshot()[0].NumAttrs())
+}
+
+// TestNewRingBufferHandler_MaxBytes tests the RingBufferHandler returned by NewRingBufferHandler with a limit on the
+// size of the records, which should drop as many old records as needed to fit a new one.
+func TestNewRingBufferHandler_MaxBytes(t *testing.T) {
+	// Create a buffer for 10 bytes of records
+	handler := loggy.NewRingBufferHandler(loggy.RingBufferHandlerOpts{MaxBytes: 10})
+	logger := slog.New(handler)
+
+	// Log records of 3 bytes each, and then a record of 7 bytes
+	logger.Info("one")
+	logger.Info("two")
+	logger.Info("six")
+	assert.Equal(t, []string{"one", "two", "six"}, recordMessages(handler.Snapshot()))
+	logger.Info("big", "k", "vvv")
+	assert.Equal(t, []string{"six", "big"}, recordMessages(handler.Snapshot()))
+
+	// Log a record that is larger than the limit on its own, which should still be kept
+	logger.Info("a record that is too large")
+	assert.Equal(t, []string{"a record that is too large"}, recordMessages(handler.Snapshot()))
+}
+
+// TestNewRingBufferHandler_Combined tests the RingBufferHandler returned by NewRingBufferHandler at debug level, as a
+// child of a CombinedHandler, with loggers logging concurrently.
+func TestNewRingBufferHandler_Combined(t *testing.T) {
+	// Combine a buffer for debug records with a handler that writes warnings
+	var outputStream syncBuffer
+	ring := loggy.NewRingBufferHandler(
+		loggy.RingBufferHandlerOpts{Size: 100, HandlerOptions: slog.HandlerOptions{Level: slog.LevelDebug}},
+	)
+	logger := slog.New(
+		loggy.NewCombinedHandler(
+			slog.NewTextHandler(&outputStream, &slog.HandlerOptions{Level: slog.LevelWarn}), ring,
+		),
+	)
+
+	// Log debug records from several goroutines, and then a warning
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				logger.Debug("working", "worker", i, "step", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	logger.Warn("something went wrong")
+
+	// Check that only the warning was written, and that the buffer has the most recent records
+	assert.Equal(t, 1, strings.Count(outputStream.String(), "\n"))
+	records := ring.Snapshot()
+	assert.Len(t, records, 100)
+	assert.Equal(t, "something went wrong", records[99].Message)
+}
+
+// TestRingBufferHandler_ServeHTTP tests the RingBufferHandler returned by NewRingBufferHandler as an HTTP handler,
+// which should dump the records as JSON or text lines.
+func TestRingBufferHandler_ServeHTTP(t *testing.T) {
+	// Log a few records to the buffer
+	handler := loggy.NewRingBufferHandler()
+	logger := slog.New(handler)
+	for i := 0; i < 3; i++ {
+		logger.Info("info", "i", i)
+	}
+	logger.Error("error", "i", 3)
+
+	// Dump the records as JSON
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/logs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+	logs := decodeJSONLogs(t, recorder.Body.String())
+	if assert.Len(t, logs, 4) {
+		for i, log := range logs {
+			assert.Equal(t, float64(i), log["i"])
+		}
+		assert.Equal(t, "ERROR", logs[3]["level"])
+	}
+
+	// Dump the errors as text
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/logs?format=text&level=error", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Regexp(t, `^time=\S+ level=ERROR msg=error i=3\n$`, recorder.Body.String())
+
+	// Check that invalid parameters are rejected
+	for _, query := range []string{"format=xml", "level=loud"} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/logs?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+
+	// Check that dumping the records doesn't remove them from the buffer
+	assert.Len(t, handler.Snapshot(), 4)
+}
@@ -0,0 +1,284 @@
+package loggy
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// samplingDefaultFirst is the default number of records with the same level and message kept every tick.
+	samplingDefaultFirst = 100
+
+	// samplingDefaultThereafter is the default sampling rate of records with the same level and message after the
+	// first ones in a tick.
+	samplingDefaultThereafter = 100
+
+	// samplingDefaultTick is the default interval that records with the same level and message are counted over.
+	samplingDefaultTick = time.Second
+
+	// samplingDefaultSummaryInterval is the default interval at which summaries of the dropped records are logged.
+	samplingDefaultSummaryInterval = time.Minute
+)
+
+// SamplingHandlerOpts represents the options for configuring the behaviour of the `SamplingHandler`.
+type SamplingHandlerOpts struct {
+	// First is the number of records with the same level and message that are kept every tick. By default, it is 100.
+	// Set it to a negative number to disable sampling by level and message.
+	First int
+
+	// Thereafter is the rate at which records with the same level and message are kept after the first ones in a tick,
+	// i.e. every Thereafter-th record is kept. By default, it is 100. Set it to a negative number to drop all of them.
+	Thereafter int
+
+	// Tick is the interval that records with the same level and message are counted over. By default, it is one
+	// second.
+	Tick time.Duration
+
+	// Ratio is the fraction of records that are kept at random, between 0 and 1. It is applied after sampling by level
+	// and message. By default, it is 0, which keeps all records.
+	Ratio float64
+
+	// KeepLevel is the level at and above which records are never sampled out. By default, it is WARN.
+	KeepLevel slog.Leveler
+
+	// SummaryInterval is the interval at which a summary of the records that were sampled out is logged, if any were.
+	// By default, it is one minute. Set it to a negative number to only log a summary when the handler is closed.
+	SummaryInterval time.Duration
+}
+
+// samplingKey identifies records that are counted together when sampling by level and message.
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+// sampler counts records and decides which ones are kept. It is shared between a SamplingHandler and all the handlers
+// derived from it.
+type sampler struct {
+	handler slog.Handler
+	opts    SamplingHandlerOpts
+
+	// mu guards the counters
+	mu        sync.Mutex
+	tickStart time.Time
+	counts    map[samplingKey]int
+	dropped   map[slog.Level]int64
+	random    *rand.Rand
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// SamplingHandler is a handler that samples records before passing them on to another handler, to reduce the volume
+// of logs sent to it.
+//
+// For every tick, the first records with the same level and message are kept, and after that only every n-th record
+// is kept. The records that are left are then sampled at random. Records at or above the keep level are never sampled
+// out. The number of records that were sampled out is logged periodically as a summary record.
+type SamplingHandler struct {
+	handler slog.Handler
+	sampler *sampler
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle passes the record on to the wrapped handler if it is sampled, or counts it as dropped otherwise.
+func (h *SamplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.sampler.sample(record) {
+		return nil
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a new SamplingHandler that passes records on to the wrapped handler with the given attributes.
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &SamplingHandler{handler: h.handler.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup returns a new SamplingHandler that passes records on to the wrapped handler with the given group.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SamplingHandler{handler: h.handler.WithGroup(name), sampler: h.sampler}
+}
+
+// Close stops the background goroutine and logs a summary of the records that were sampled out since the last one. It
+// is shared by all the handlers derived from this one.
+func (h *SamplingHandler) Close() error {
+	var err error
+	h.sampler.closeOnce.Do(
+		func() {
+			close(h.sampler.done)
+			<-h.sampler.stopped
+			err = h.sampler.logSummary()
+		},
+	)
+	return err
+}
+
+// sample reports whether a record should be kept, counting it as dropped if it shouldn't.
+func (s *sampler) sample(record slog.Record) bool {
+	if record.Level >= s.opts.KeepLevel.Level() {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Sample by level and message, starting a new tick if the current one is over
+	if s.opts.First >= 0 {
+		now := time.Now()
+		if now.Sub(s.tickStart) >= s.opts.Tick {
+			s.tickStart = now
+			s.counts = make(map[samplingKey]int)
+		}
+
+		key := samplingKey{level: record.Level, message: record.Message}
+		s.counts[key]++
+		count := s.counts[key]
+		if count > s.opts.First && (s.opts.Thereafter < 0 || (count-s.opts.First)%s.opts.Thereafter != 0) {
+			s.dropped[record.Level]++
+			return false
+		}
+	}
+
+	// Sample the remaining records at random
+	if s.opts.Ratio > 0 && s.opts.Ratio < 1 && s.random.Float64() >= s.opts.Ratio {
+		s.dropped[record.Level]++
+		return false
+	}
+
+	return true
+}
+
+// run logs a summary of the dropped records every summary interval, until the sampler is closed.
+func (s *sampler) run() {
+	defer close(s.stopped)
+
+	if s.opts.SummaryInterval < 0 {
+		<-s.done
+		return
+	}
+
+	ticker := time.NewTicker(s.opts.SummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			// There is nowhere to report the error
+			_ = s.logSummary()
+		}
+	}
+}
+
+// logSummary logs a record with the number of records that were sampled out since the last summary, in total and by
+// level. Nothing is logged if no records were sampled out. The counters are only reset once the summary has been
+// handled, so that the records are counted in the next summary if the wrapped handler is disabled or fails.
+func (s *sampler) logSummary() error {
+	ctx := context.Background()
+	if !s.handler.Enabled(ctx, slog.LevelInfo) {
+		return nil
+	}
+
+	// Copy the counters, since more records can be sampled out while the summary is being logged
+	s.mu.Lock()
+	dropped := make(map[slog.Level]int64, len(s.dropped))
+	for level, count := range s.dropped {
+		dropped[level] = count
+	}
+	s.mu.Unlock()
+
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	// Count the dropped records by level, from the lowest level to the highest
+	levels := make([]slog.Level, 0, len(dropped))
+	for level := range dropped {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	var total int64
+	levelAttrs := make([]any, 0, len(levels))
+	for _, level := range levels {
+		total += dropped[level]
+		levelAttrs = append(levelAttrs, slog.Int64(level.String(), dropped[level]))
+	}
+
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "records sampled out", 0)
+	record.AddAttrs(slog.Int64("dropped", total), slog.Group("levels", levelAttrs...))
+	if err := s.handler.Handle(ctx, record); err != nil {
+		return err
+	}
+
+	// Reset the counters, keeping the records that were sampled out while the summary was being logged
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for level, count := range dropped {
+		s.dropped[level] -= count
+		if s.dropped[level] == 0 {
+			delete(s.dropped, level)
+		}
+	}
+	return nil
+}
+
+// NewSamplingHandler returns a SamplingHandler that samples records before passing them on to the given handler.
+//
+// The handler should be closed to log a summary of the records that were sampled out since the last one.
+func NewSamplingHandler(handler slog.Handler, options ...SamplingHandlerOpts) *SamplingHandler {
+	// If options are provided, assign the first option to opts
+	var opts SamplingHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if opts.First == 0 {
+		opts.First = samplingDefaultFirst
+	}
+	if opts.Thereafter == 0 {
+		opts.Thereafter = samplingDefaultThereafter
+	}
+	if opts.Tick <= 0 {
+		opts.Tick = samplingDefaultTick
+	}
+	if opts.KeepLevel == nil {
+		opts.KeepLevel = slog.LevelWarn
+	}
+	if opts.SummaryInterval == 0 {
+		opts.SummaryInterval = samplingDefaultSummaryInterval
+	}
+
+	// Start logging summaries in the background
+	s := &sampler{
+		handler: handler,
+		opts:    opts,
+		counts:  make(map[samplingKey]int),
+		dropped: make(map[slog.Level]int64),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+
+	return &SamplingHandler{handler: handler, sampler: s}
+}
@@ -0,0 +1,157 @@
+package loggy_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewSamplingHandler tests the SamplingHandler returned by NewSamplingHandler with many records with the same
+// level and message, of which only the first ones and every n-th one after them should be kept, along with all the
+// warnings.
+func TestNewSamplingHandler(t *testing.T) {
+	// Create a logger that samples records before logging them to a buffer
+	var outputStream bytes.Buffer
+	handler := loggy.NewSamplingHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		loggy.SamplingHandlerOpts{First: 3, Thereafter: 5, Tick: time.Hour, SummaryInterval: -1},
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log the same messages many times
+	for i := 1; i <= 20; i++ {
+		logger.Info("polling", "i", i)
+		logger.Debug("tick", "i", i)
+		logger.Warn("slow poll", "i", i)
+	}
+	assert.NoError(t, handler.Close())
+
+	// Check which records were kept
+	kept := make(map[string][]float64)
+	logs := decodeJSONLogs(t, outputStream.String())
+	for _, log := range logs[:len(logs)-1] {
+		assert.Equal(t, "api", log["service"])
+		kept[log["msg"].(string)] = append(kept[log["msg"].(string)], log["i"].(float64))
+	}
+	assert.Equal(t, []float64{1, 2, 3, 8, 13, 18}, kept["polling"])
+	assert.Equal(t, []float64{1, 2, 3, 8, 13, 18}, kept["tick"])
+	assert.Len(t, kept["slow poll"], 20)
+
+	// Check the summary of the dropped records
+	summary := logs[len(logs)-1]
+	assert.Equal(t, "INFO", summary["level"])
+	assert.Equal(t, "records sampled out", summary["msg"])
+	assert.Equal(t, float64(28), summary["dropped"])
+	assert.Equal(t, map[string]any{"DEBUG": float64(14), "INFO": float64(14)}, summary["levels"])
+	assert.NotContains(t, summary, "service")
+}
+
+// TestNewSamplingHandler_Tick tests the SamplingHandler returned by NewSamplingHandler with records logged in
+// different ticks, which should be counted separately.
+func TestNewSamplingHandler_Tick(t *testing.T) {
+	// Create a logger that keeps only the first record of every message in a tick
+	var outputStream bytes.Buffer
+	handler := loggy.NewSamplingHandler(
+		slog.NewJSONHandler(&outputStream, nil),
+		loggy.SamplingHandlerOpts{First: 1, Thereafter: -1, Tick: 50 * time.Millisecond, SummaryInterval: -1},
+	)
+	logger := slog.New(handler)
+
+	// Log the same message twice in two ticks
+	logger.Info("polling")
+	logger.Info("polling")
+	time.Sleep(60 * time.Millisecond)
+	logger.Info("polling")
+	logger.Info("polling")
+
+	// Check that the first record of every tick was kept
+	logs := decodeJSONLogs(t, outputStream.String())
+	assert.Len(t, logs, 2)
+}
+
+// TestNewSamplingHandler_Ratio tests the SamplingHandler returned by NewSamplingHandler with random sampling, which
+// should keep roughly the configured fraction of records.
+func TestNewSamplingHandler_Ratio(t *testing.T) {
+	// Create a logger that only samples records at random
+	var outputStream bytes.Buffer
+	handler := loggy.NewSamplingHandler(
+		slog.NewJSONHandler(&outputStream, nil), loggy.SamplingHandlerOpts{First: -1, Ratio: 0.5, SummaryInterval: -1},
+	)
+	logger := slog.New(handler)
+
+	// Log many records
+	for i := 0; i < 1000; i++ {
+		logger.Info("request", "i", i)
+	}
+	logger.Error("request failed")
+
+	// Check that roughly half of the records were kept, along with the error
+	logs := decodeJSONLogs(t, outputStream.String())
+	assert.InDelta(t, 501, len(logs), 100)
+	assert.Equal(t, "request failed", logs[len(logs)-1]["msg"])
+}
+
+// TestNewSamplingHandler_Summary tests the SamplingHandler returned by NewSamplingHandler with a short summary
+// interval, which should log summaries of the dropped records in the background.
+func TestNewSamplingHandler_Summary(t *testing.T) {
+	// Create a logger that drops every record after the first one, and logs summaries often
+	var outputStream syncBuffer
+	handler := loggy.NewSamplingHandler(
+		slog.NewJSONHandler(&outputStream, nil),
+		loggy.SamplingHandlerOpts{First: 1, Thereafter: -1, Tick: time.Hour, SummaryInterval: 20 * time.Millisecond},
+	)
+	logger := slog.New(handler)
+
+	// Log the same message a few times
+	for i := 0; i < 5; i++ {
+		logger.Info("polling")
+	}
+
+	// Wait for the summary to be logged
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, handler.Close())
+
+	// Check that a single summary was logged, since nothing was dropped after it
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "records sampled out", logs[1]["msg"])
+		assert.Equal(t, float64(4), logs[1]["dropped"])
+	}
+}
+
+// TestNewSamplingHandler_SummaryDisabled tests the SamplingHandler returned by NewSamplingHandler with a wrapped
+// handler that is disabled at the level of summaries for a while, which should not lose the dropped records.
+func TestNewSamplingHandler_SummaryDisabled(t *testing.T) {
+	// Create a logger with a level that can be changed, which drops every record after the first one
+	var outputStream syncBuffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelDebug)
+	handler := loggy.NewSamplingHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{Level: level}),
+		loggy.SamplingHandlerOpts{First: 1, Thereafter: -1, Tick: time.Hour, SummaryInterval: 20 * time.Millisecond},
+	)
+	logger := slog.New(handler)
+
+	// Log the same message a few times
+	for i := 0; i < 5; i++ {
+		logger.Debug("polling")
+	}
+
+	// Disable the wrapped handler at the level of summaries while they are due, then enable it again
+	level.Set(slog.LevelWarn)
+	time.Sleep(100 * time.Millisecond)
+	level.Set(slog.LevelDebug)
+	assert.NoError(t, handler.Close())
+
+	// Check that the dropped records were counted in the summary logged once it was enabled again
+	logs := decodeJSONLogs(t, outputStream.String())
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "records sampled out", logs[1]["msg"])
+		assert.Equal(t, float64(4), logs[1]["dropped"])
+	}
+}
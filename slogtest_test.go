@@ -0,0 +1,544 @@
+package loggy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"github.com/ksdfg/loggy"
+)
+
+// checkConformance runs the slogtest conformance tests against a handler, with the results parsed from its output, and
+// reports every failed check. Failed checks whose explanations contain one of the exceptions are ignored, for
+// handlers whose output format can't meet them.
+func checkConformance(t *testing.T, handler slog.Handler, results func() []map[string]any, exceptions ...string) {
+	t.Helper()
+
+	err := slogtest.TestHandler(handler, results)
+	if err == nil {
+		return
+	}
+
+	// Report the checks that failed one by one, unless they are expected to fail
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		expected := false
+		for _, exception := range exceptions {
+			if strings.Contains(err.Error(), exception) {
+				expected = true
+				break
+			}
+		}
+		if !expected {
+			t.Error(err)
+		}
+	}
+}
+
+// nestKeys converts keys flattened with the separator into nested maps, e.g. {"G.a": 1} into {"G": {"a": 1}}.
+func nestKeys(flat map[string]any, separator string) map[string]any {
+	nested := make(map[string]any, len(flat))
+	for key, value := range flat {
+		path := strings.Split(key, separator)
+		group := nested
+		for _, name := range path[:len(path)-1] {
+			child, ok := group[name].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				group[name] = child
+			}
+			group = child
+		}
+		group[path[len(path)-1]] = value
+	}
+	return nested
+}
+
+// valueToAny converts a resolved value into the value it would be decoded as from JSON, with groups as maps.
+func valueToAny(value slog.Value) any {
+	if value.Kind() != slog.KindGroup {
+		return value.Any()
+	}
+
+	group := map[string]any{}
+	for _, attr := range value.Group() {
+		group[attr.Key] = valueToAny(attr.Value)
+	}
+	return group
+}
+
+// recordToMap converts a record read back from the output of a handler into a map, with groups as nested maps.
+func recordToMap(record slog.Record) map[string]any {
+	result := map[string]any{slog.LevelKey: record.Level, slog.MessageKey: record.Message}
+	if !record.Time.IsZero() {
+		result[slog.TimeKey] = record.Time
+	}
+	record.Attrs(
+		func(attr slog.Attr) bool {
+			result[attr.Key] = valueToAny(attr.Value)
+			return true
+		},
+	)
+	return result
+}
+
+// renameKeys renames the keys of the built-in attributes in the top level of logs to the ones used by slog, and removes
+// the keys that are added to every log.
+func renameKeys(logs []map[string]any, names map[string]string, removed ...string) []map[string]any {
+	for _, log := range logs {
+		for from, to := range names {
+			if value, ok := log[from]; ok {
+				delete(log, from)
+				log[to] = value
+			}
+		}
+		for _, key := range removed {
+			delete(log, key)
+		}
+	}
+	return logs
+}
+
+// TestConformance_JSONWrappers tests the handlers that wrap other handlers with slogtest, each wrapping a JSON handler.
+func TestConformance_JSONWrappers(t *testing.T) {
+	wrappers := map[string]func(slog.Handler) slog.Handler{
+		"CombinedHandler": func(h slog.Handler) slog.Handler { return loggy.NewCombinedHandler(h) },
+		"ContextHandler":  loggy.NewContextHandler,
+		"TraceHandler":    func(h slog.Handler) slog.Handler { return loggy.NewTraceHandler(h) },
+		"RedactHandler":   func(h slog.Handler) slog.Handler { return loggy.NewRedactHandler(h) },
+		"TransformHandler": func(h slog.Handler) slog.Handler {
+			return loggy.NewTransformHandler(h, loggy.DropAttrs("password"))
+		},
+		"SamplingHandler": func(h slog.Handler) slog.Handler {
+			return loggy.NewSamplingHandler(h, loggy.SamplingHandlerOpts{First: 1000})
+		},
+		"RateLimitHandler": func(h slog.Handler) slog.Handler {
+			return loggy.NewRateLimitHandler(h, loggy.RateLimitHandlerOpts{Rate: 1000, Burst: 1000})
+		},
+		"BacktraceHandler": func(h slog.Handler) slog.Handler { return loggy.NewBacktraceHandler(h) },
+	}
+
+	for name, wrap := range wrappers {
+		t.Run(
+			name, func(t *testing.T) {
+				var outputStream bytes.Buffer
+				handler := wrap(slog.NewJSONHandler(&outputStream, nil))
+				checkConformance(
+					t, handler, func() []map[string]any { return decodeJSONLogs(t, outputStream.String()) },
+				)
+			},
+		)
+	}
+}
+
+// flushingHandler is a handler that flushes a DedupHandler before every record is passed on to it, so that identical
+// records are not collapsed.
+type flushingHandler struct {
+	slog.Handler
+	dedup *loggy.DedupHandler
+}
+
+func (h flushingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if err := h.dedup.Flush(); err != nil {
+		return err
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h flushingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return flushingHandler{Handler: h.Handler.WithAttrs(attrs), dedup: h.dedup}
+}
+
+func (h flushingHandler) WithGroup(name string) slog.Handler {
+	return flushingHandler{Handler: h.Handler.WithGroup(name), dedup: h.dedup}
+}
+
+// TestConformance_DedupHandler tests the DedupHandler returned by NewDedupHandler with slogtest. Some of the records
+// logged by slogtest are identical, so the handler is flushed before every record to keep them from being collapsed.
+func TestConformance_DedupHandler(t *testing.T) {
+	var outputStream bytes.Buffer
+	handler := loggy.NewDedupHandler(slog.NewJSONHandler(&outputStream, nil))
+	defer handler.Close()
+
+	checkConformance(
+		t, flushingHandler{Handler: handler, dedup: handler}, func() []map[string]any {
+			// The last record is held back until the next one is logged
+			if err := handler.Flush(); err != nil {
+				t.Error(err)
+			}
+			return decodeJSONLogs(t, outputStream.String())
+		},
+	)
+}
+
+// TestConformance_Console tests the handlers returned by NewConsoleLogHandler with slogtest, in the formats that can be
+// parsed back.
+func TestConformance_Console(t *testing.T) {
+	formats := map[string]struct {
+		format loggy.ConsoleFormat
+		parse  func(t *testing.T, output string) []map[string]any
+	}{
+		"Text":   {format: loggy.ConsoleFormatText, parse: parseLogfmtLogs},
+		"JSON":   {format: loggy.ConsoleFormatJSON, parse: decodeJSONLogs},
+		"Logfmt": {format: loggy.ConsoleFormatLogfmt, parse: parseLogfmtLogs},
+		"GCP":    {format: loggy.ConsoleFormatGCP, parse: parseGCPLogs},
+		"ECS":    {format: loggy.ConsoleFormatECS, parse: parseECSLogs},
+	}
+
+	for name, format := range formats {
+		t.Run(
+			name, func(t *testing.T) {
+				// Redirect stdout to a pipe while the handler is created and used
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				backup := os.Stdout
+				os.Stdout = w
+				defer func() { os.Stdout = backup }()
+
+				handler := loggy.NewConsoleLogHandler(loggy.ConsoleLogWriterOpts{Format: format.format, LogToStdout: true})
+				checkConformance(
+					t, handler, func() []map[string]any {
+						_ = w.Close()
+						output, err := io.ReadAll(r)
+						if err != nil {
+							t.Fatal(err)
+						}
+						return format.parse(t, string(output))
+					},
+				)
+			},
+		)
+	}
+}
+
+// parseGCPLogs parses the output of a GCPHandler.
+func parseGCPLogs(t *testing.T, output string) []map[string]any {
+	return renameKeys(
+		decodeJSONLogs(t, output), map[string]string{"severity": slog.LevelKey, "message": slog.MessageKey},
+	)
+}
+
+// parseECSLogs parses the output of an ECSHandler.
+func parseECSLogs(t *testing.T, output string) []map[string]any {
+	return renameKeys(
+		decodeJSONLogs(t, output),
+		map[string]string{"@timestamp": slog.TimeKey, "log.level": slog.LevelKey, "message": slog.MessageKey},
+		"ecs.version",
+	)
+}
+
+// parseLogfmtLogs parses the output of a LogfmtHandler, or of a slog.TextHandler, which writes the same key=value
+// pairs.
+func parseLogfmtLogs(t *testing.T, output string) []map[string]any {
+	var logs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		attrs, err := loggy.ParseLogfmt(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flat := make(map[string]any, len(attrs))
+		for _, attr := range attrs {
+			flat[attr.Key] = attr.Value.String()
+		}
+		logs = append(logs, nestKeys(flat, "."))
+	}
+	return logs
+}
+
+// TestConformance_Writers tests the handlers that write logs to an io.Writer with slogtest.
+func TestConformance_Writers(t *testing.T) {
+	writers := map[string]struct {
+		handler func(w io.Writer) slog.Handler
+		parse   func(t *testing.T, output string) []map[string]any
+	}{
+		"GCPHandler": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewGCPHandler(w) },
+			parse:   parseGCPLogs,
+		},
+		"ECSHandler": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewECSHandler(w) },
+			parse:   parseECSLogs,
+		},
+		"LogfmtHandler": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewLogfmtHandler(w) },
+			parse:   parseLogfmtLogs,
+		},
+		"CSVHandler": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewCSVHandler(w) },
+			parse:   parseCSVLogs,
+		},
+		"BinaryHandler_Msgpack": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewBinaryHandler(w) },
+			parse:   parseBinaryLogs(loggy.BinaryFormatMsgpack),
+		},
+		"BinaryHandler_CBOR": {
+			handler: func(w io.Writer) slog.Handler {
+				return loggy.NewBinaryHandler(w, loggy.BinaryHandlerOpts{Format: loggy.BinaryFormatCBOR})
+			},
+			parse: parseBinaryLogs(loggy.BinaryFormatCBOR),
+		},
+		"ProtoHandler": {
+			handler: func(w io.Writer) slog.Handler { return loggy.NewProtoHandler(w) },
+			parse:   parseProtoLogs,
+		},
+	}
+
+	for name, writer := range writers {
+		t.Run(
+			name, func(t *testing.T) {
+				var outputStream bytes.Buffer
+				checkConformance(
+					t, writer.handler(&outputStream),
+					func() []map[string]any { return writer.parse(t, outputStream.String()) },
+				)
+			},
+		)
+	}
+}
+
+// parseCSVLogs parses the output of a CSVHandler with the default columns, merging the attributes in the extra column
+// into the top level.
+func parseCSVLogs(t *testing.T, output string) []map[string]any {
+	rows, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []map[string]any
+	for _, row := range rows[1:] {
+		log := map[string]any{}
+		if row[3] != "" {
+			if err := json.Unmarshal([]byte(row[3]), &log); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if row[0] != "" {
+			log[slog.TimeKey] = row[0]
+		}
+		log[slog.LevelKey] = row[1]
+		log[slog.MessageKey] = row[2]
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// parseBinaryLogs returns a function that parses the output of a BinaryHandler in the given format.
+func parseBinaryLogs(format loggy.BinaryFormat) func(t *testing.T, output string) []map[string]any {
+	return func(t *testing.T, output string) []map[string]any {
+		decoder := loggy.NewBinaryDecoder(strings.NewReader(output), format)
+
+		var logs []map[string]any
+		for {
+			record, err := decoder.Decode()
+			if errors.Is(err, io.EOF) {
+				return logs
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs = append(logs, recordToMap(record))
+		}
+	}
+}
+
+// parseProtoLogs parses the output of a ProtoHandler.
+func parseProtoLogs(t *testing.T, output string) []map[string]any {
+	decoder := loggy.NewProtoDecoder(strings.NewReader(output))
+
+	var logs []map[string]any
+	for {
+		record, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			return logs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, recordToMap(record))
+	}
+}
+
+// TestConformance_RingBufferHandler tests the RingBufferHandler returned by NewRingBufferHandler with slogtest.
+func TestConformance_RingBufferHandler(t *testing.T) {
+	handler := loggy.NewRingBufferHandler()
+	checkConformance(
+		t, handler, func() []map[string]any {
+			var logs []map[string]any
+			for _, record := range handler.Snapshot() {
+				logs = append(logs, recordToMap(record))
+			}
+			return logs
+		},
+	)
+}
+
+// TestConformance_GELFHandler tests the GELFHandler returned by NewGELFHandler with slogtest, with messages sent to
+// a fake graylog input over UDP.
+func TestConformance_GELFHandler(t *testing.T) {
+	// Start a fake graylog input, and read every message sent to it in the background
+	server := listenGELFUDP(t)
+	received := make(chan map[string]any, 100)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				close(received)
+				return
+			}
+			var message map[string]any
+			if err := json.Unmarshal(buf[:n], &message); err == nil {
+				received <- message
+			}
+		}
+	}()
+
+	handler, err := loggy.NewGELFHandler(
+		loggy.GELFHandlerOpts{Address: server.LocalAddr().String(), Compression: loggy.GELFCompressionNone},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	checkConformance(
+		t, handler, func() []map[string]any {
+			var logs []map[string]any
+			for len(logs) < 17 {
+				select {
+				case message := <-received:
+					logs = append(logs, parseGELFMessage(message))
+				case <-time.After(time.Second):
+					return logs
+				}
+			}
+			return logs
+		},
+	)
+}
+
+// parseGELFMessage converts a GELF message into a log with the keys used by slog, with the additional fields nested
+// into groups.
+func parseGELFMessage(message map[string]any) map[string]any {
+	flat := map[string]any{slog.LevelKey: message["level"], slog.MessageKey: message["short_message"]}
+	if timestamp, ok := message["timestamp"]; ok {
+		flat[slog.TimeKey] = timestamp
+	}
+	for key, value := range message {
+		if field, ok := strings.CutPrefix(key, "_"); ok {
+			flat[field] = value
+		}
+	}
+	return nestKeys(flat, "_")
+}
+
+// TestConformance_FluentHandler tests the FluentHandler returned by NewFluentHandler with slogtest, with the records
+// sent to a fake forward input.
+//
+// The forward protocol requires every entry to have a time, so records without one are sent with the current time
+// instead of being sent without a time.
+func TestConformance_FluentHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	messages := serveFluent(t, listener, 1, false)
+
+	handler, err := loggy.NewFluentHandler(
+		loggy.FluentHandlerOpts{Address: listener.Addr().String(), Tag: "app.test", BatchSize: 100},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkConformance(
+		t, handler, func() []map[string]any {
+			// Send all the records in a single message
+			if err := handler.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var logs []map[string]any
+			for _, entry := range receiveFluent(t, messages).entries {
+				entry.record[slog.TimeKey] = entry.time
+				logs = append(logs, entry.record)
+			}
+			return logs
+		},
+		"zero Record.Time",
+	)
+}
+
+// TestConformance_OTLPHandler tests the OTLPHandler returned by NewOTLPHandler with slogtest, with the records
+// exported to a fake collector as JSON.
+func TestConformance_OTLPHandler(t *testing.T) {
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	handler := loggy.NewOTLPHandler(
+		loggy.OTLPHandlerOpts{Endpoint: server.URL + "/v1/logs", Encoding: loggy.OTLPEncodingJSON, BatchSize: 100},
+	)
+
+	checkConformance(
+		t, handler, func() []map[string]any {
+			// Export all the records in a single request
+			if err := handler.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var logs []map[string]any
+			for _, request := range collector.jsonBodies(t) {
+				for _, logRecord := range otlpLogRecords(request) {
+					logRecord := logRecord.(map[string]any)
+					log := otlpKeyValues(logRecord["attributes"].([]any))
+					log[slog.LevelKey] = logRecord["severityText"]
+					log[slog.MessageKey] = logRecord["body"].(map[string]any)["stringValue"]
+					if timestamp, ok := logRecord["timeUnixNano"]; ok {
+						log[slog.TimeKey] = timestamp
+					}
+					logs = append(logs, log)
+				}
+			}
+			return logs
+		},
+	)
+}
+
+// otlpKeyValues converts OTLP KeyValues in the JSON mapping into a map, with kvlists as nested maps.
+func otlpKeyValues(keyValues []any) map[string]any {
+	result := make(map[string]any, len(keyValues))
+	for _, keyValue := range keyValues {
+		keyValue := keyValue.(map[string]any)
+		for kind, value := range keyValue["value"].(map[string]any) {
+			switch kind {
+			case "kvlistValue":
+				result[keyValue["key"].(string)] = otlpKeyValues(value.(map[string]any)["values"].([]any))
+			case "intValue":
+				result[keyValue["key"].(string)], _ = strconv.ParseInt(value.(string), 10, 64)
+			default:
+				result[keyValue["key"].(string)] = value
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,255 @@
+package loggy
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// TraceContext identifies the trace and the span that a record was logged in, as defined by the W3C Trace Context
+// specification.
+type TraceContext struct {
+	// TraceID is the ID of the whole trace.
+	TraceID [16]byte
+
+	// SpanID is the ID of the span within the trace.
+	SpanID [8]byte
+
+	// Flags are the trace flags, the lowest bit of which marks the trace as sampled.
+	Flags byte
+}
+
+// IsValid reports whether both the trace ID and the span ID are set, as the W3C specification forbids IDs made up of
+// only zeroes.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the sampled flag of the trace is set.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 == 0x01
+}
+
+// TraceIDString returns the trace ID as a lowercase hex string.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the span ID as a lowercase hex string.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// Traceparent returns the trace context formatted as the value of a W3C traceparent header.
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceIDString(), tc.SpanIDString(), tc.Flags)
+}
+
+// ParseTraceparent parses the value of a W3C traceparent header, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(traceparent string) (TraceContext, error) {
+	var tc TraceContext
+
+	// Split the header into its four fields. Future versions may add more fields after these.
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return tc, fmt.Errorf("loggy: invalid traceparent %q", traceparent)
+	}
+
+	// Decode the version, IDs and flags
+	var version, flags [1]byte
+	if err := decodeHexField(version[:], parts[0]); err != nil {
+		return tc, fmt.Errorf("loggy: invalid traceparent version: %w", err)
+	}
+	if err := decodeHexField(tc.TraceID[:], parts[1]); err != nil {
+		return tc, fmt.Errorf("loggy: invalid traceparent trace ID: %w", err)
+	}
+	if err := decodeHexField(tc.SpanID[:], parts[2]); err != nil {
+		return tc, fmt.Errorf("loggy: invalid traceparent span ID: %w", err)
+	}
+	if err := decodeHexField(flags[:], parts[3]); err != nil {
+		return tc, fmt.Errorf("loggy: invalid traceparent flags: %w", err)
+	}
+	tc.Flags = flags[0]
+
+	if !tc.IsValid() {
+		return tc, fmt.Errorf("loggy: invalid traceparent %q: IDs must not be all zeroes", traceparent)
+	}
+
+	return tc, nil
+}
+
+// decodeHexField decodes a lowercase hex string that must fill dst exactly.
+func decodeHexField(dst []byte, field string) error {
+	if len(field) != hex.EncodedLen(len(dst)) || strings.ToLower(field) != field {
+		return errors.New("wrong length or not lowercase hex")
+	}
+	_, err := hex.Decode(dst, []byte(field))
+	return err
+}
+
+// traceContextKey is the key that a TraceContext is stored under in a context.
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx that carries the given trace context, which is picked up by
+// W3CTraceExtractor.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// ContextWithTraceparent parses the value of a W3C traceparent header, e.g. from an incoming HTTP request, and
+// returns a copy of ctx that carries it.
+func ContextWithTraceparent(ctx context.Context, traceparent string) (context.Context, error) {
+	tc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx, err
+	}
+	return ContextWithTraceContext(ctx, tc), nil
+}
+
+// TraceExtractor extracts the trace context that a record was logged in from the context passed to the handler.
+//
+// Implement it to correlate logs with traces from OpenTelemetry or any other tracer. For example, with the
+// OpenTelemetry trace API:
+//
+//	loggy.TraceExtractorFunc(func(ctx context.Context) (loggy.TraceContext, bool) {
+//		spanContext := trace.SpanContextFromContext(ctx)
+//		return loggy.TraceContext{
+//			TraceID: spanContext.TraceID(),
+//			SpanID:  spanContext.SpanID(),
+//			Flags:   byte(spanContext.TraceFlags()),
+//		}, spanContext.IsValid()
+//	})
+type TraceExtractor interface {
+	// ExtractTrace returns the trace context carried by ctx, and whether there was one.
+	ExtractTrace(ctx context.Context) (TraceContext, bool)
+}
+
+// TraceExtractorFunc is an adapter to allow the use of ordinary functions as trace extractors.
+type TraceExtractorFunc func(ctx context.Context) (TraceContext, bool)
+
+// ExtractTrace calls f(ctx).
+func (f TraceExtractorFunc) ExtractTrace(ctx context.Context) (TraceContext, bool) {
+	return f(ctx)
+}
+
+// W3CTraceExtractor extracts trace contexts that were stored in a context with ContextWithTraceContext or
+// ContextWithTraceparent.
+var W3CTraceExtractor TraceExtractor = TraceExtractorFunc(
+	func(ctx context.Context) (TraceContext, bool) {
+		tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+		return tc, ok && tc.IsValid()
+	},
+)
+
+// extractTrace returns the first valid trace context found in ctx by the given extractors, in order.
+func extractTrace(ctx context.Context, extractors []TraceExtractor) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+
+	for _, extractor := range extractors {
+		if tc, ok := extractor.ExtractTrace(ctx); ok && tc.IsValid() {
+			return tc, true
+		}
+	}
+
+	return TraceContext{}, false
+}
+
+// TraceHandlerOpts represents the options for configuring the behaviour of the `TraceHandler`.
+type TraceHandlerOpts struct {
+	// Extractors are used in order to find the trace context of a record, until one of them finds a valid one. By
+	// default, only W3CTraceExtractor is used.
+	Extractors []TraceExtractor
+
+	// TraceIDKey is the key of the attribute holding the trace ID. By default, it is "trace_id".
+	TraceIDKey string
+
+	// SpanIDKey is the key of the attribute holding the span ID. By default, it is "span_id".
+	SpanIDKey string
+
+	// SampledKey is the key of the attribute holding whether the trace is sampled. If it is empty, the attribute is
+	// not added.
+	SampledKey string
+}
+
+// TraceHandler is a handler that adds the trace and span IDs from the context of every record as attributes before
+// passing it on to another handler, so that logs can be linked to traces.
+//
+// The IDs are always added at the top level of the record, even if the handler has groups.
+type TraceHandler struct {
+	handler slog.Handler
+	opts    TraceHandlerOpts
+	goas    []groupOrAttrs
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *TraceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle adds the trace and span IDs to the record, if the context has a trace, and passes it on to the wrapped
+// handler.
+func (h *TraceHandler) Handle(ctx context.Context, record slog.Record) error {
+	var attrs []slog.Attr
+	if tc, ok := extractTrace(ctx, h.opts.Extractors); ok {
+		attrs = append(
+			attrs, slog.String(h.opts.TraceIDKey, tc.TraceIDString()), slog.String(h.opts.SpanIDKey, tc.SpanIDString()),
+		)
+		if h.opts.SampledKey != "" {
+			attrs = append(attrs, slog.Bool(h.opts.SampledKey, tc.Sampled()))
+		}
+	}
+
+	// Nothing needs to change if there is no trace and no groups to qualify the attributes by
+	if len(attrs) == 0 && len(h.goas) == 0 {
+		return h.handler.Handle(ctx, record)
+	}
+
+	return h.handler.Handle(ctx, recordWithAttrs(record, append(attrs, collectAttrs(h.goas, record, nil)...)))
+}
+
+// WithAttrs returns a new TraceHandler whose attributes consist of both the receiver's attributes and the arguments.
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &TraceHandler{handler: h.handler, opts: h.opts, goas: withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs})}
+}
+
+// WithGroup returns a new TraceHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &TraceHandler{handler: h.handler, opts: h.opts, goas: withGroupOrAttrs(h.goas, groupOrAttrs{group: name})}
+}
+
+// NewTraceHandler returns a TraceHandler that adds trace and span IDs to records before passing them on to the given
+// handler.
+func NewTraceHandler(handler slog.Handler, options ...TraceHandlerOpts) slog.Handler {
+	// If options are provided, assign the first option to opts
+	var opts TraceHandlerOpts
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Set the defaults
+	if len(opts.Extractors) == 0 {
+		opts.Extractors = []TraceExtractor{W3CTraceExtractor}
+	}
+	if opts.TraceIDKey == "" {
+		opts.TraceIDKey = "trace_id"
+	}
+	if opts.SpanIDKey == "" {
+		opts.SpanIDKey = "span_id"
+	}
+
+	return &TraceHandler{handler: handler, opts: opts}
+}
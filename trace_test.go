@@ -0,0 +1,124 @@
+package loggy_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// removeTime is a ReplaceAttr function that removes the time from the logs, so that the output is exactly the same no
+// matter when the test is run.
+func removeTime(group []string, attr slog.Attr) slog.Attr {
+	if len(group) == 0 && attr.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return attr
+}
+
+// TestParseTraceparent tests the ParseTraceparent function with a valid traceparent header.
+func TestParseTraceparent(t *testing.T) {
+	// Parse a valid header
+	tc, err := loggy.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Check the parsed trace context, and that it formats back to the same header
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", tc.SpanIDString())
+	assert.Equal(t, true, tc.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tc.Traceparent())
+}
+
+// TestParseTraceparent_Invalid tests the ParseTraceparent function with headers that don't follow the W3C
+// specification.
+func TestParseTraceparent_Invalid(t *testing.T) {
+	for _, traceparent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	} {
+		_, err := loggy.ParseTraceparent(traceparent)
+		assert.Error(t, err, traceparent)
+	}
+}
+
+// TestNewTraceHandler tests the TraceHandler returned by NewTraceHandler with a record logged in a context carrying a
+// traceparent, which should have the trace and span IDs added at the top level even though the logger has a group.
+func TestNewTraceHandler(t *testing.T) {
+	// Create a logger that adds trace IDs to a text handler
+	var outputStream strings.Builder
+	handler := loggy.NewTraceHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.TraceHandlerOpts{SampledKey: "trace_sampled"},
+	)
+	logger := slog.New(handler).With("service", "api").WithGroup("request")
+
+	// Log a message in a traced context
+	ctx, err := loggy.ContextWithTraceparent(
+		context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	logger.InfoContext(ctx, "this is a test log", "method", "GET")
+
+	// Check the output
+	expectedOutput := "level=INFO msg=\"this is a test log\" trace_id=4bf92f3577b34da6a3ce929d0e0e4736 " +
+		"span_id=00f067aa0ba902b7 trace_sampled=true service=api request.method=GET\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+}
+
+// TestNewTraceHandler_NoTrace tests the TraceHandler returned by NewTraceHandler with a record logged without a
+// trace in its context, which should be passed on unchanged.
+func TestNewTraceHandler_NoTrace(t *testing.T) {
+	// Create a logger that adds trace IDs to a text handler
+	var outputStream strings.Builder
+	handler := loggy.NewTraceHandler(slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}))
+
+	// Log a message without a trace
+	slog.New(handler).Info("this is a test log", "key", "value")
+
+	// Check the output
+	assert.Equal(t, "level=INFO msg=\"this is a test log\" key=value\n", outputStream.String())
+}
+
+// TestNewTraceHandler_Extractor tests the TraceHandler returned by NewTraceHandler with a custom extractor and
+// attribute keys.
+func TestNewTraceHandler_Extractor(t *testing.T) {
+	// Create a logger that uses an extractor which always finds the same trace
+	var outputStream strings.Builder
+	extractor := loggy.TraceExtractorFunc(
+		func(ctx context.Context) (loggy.TraceContext, bool) {
+			return loggy.TraceContext{TraceID: [16]byte{15: 1}, SpanID: [8]byte{7: 2}}, true
+		},
+	)
+	handler := loggy.NewTraceHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.TraceHandlerOpts{
+			Extractors: []loggy.TraceExtractor{loggy.W3CTraceExtractor, extractor},
+			TraceIDKey: "traceId",
+			SpanIDKey:  "spanId",
+		},
+	)
+
+	// Log a message
+	slog.New(handler).Info("this is a test log")
+
+	// Check the output
+	expectedOutput := "{\"level\":\"INFO\",\"msg\":\"this is a test log\"," +
+		"\"traceId\":\"00000000000000000000000000000001\",\"spanId\":\"0000000000000002\"}\n"
+	assert.Equal(t, expectedOutput, outputStream.String())
+}
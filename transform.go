@@ -0,0 +1,264 @@
+package loggy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Transform transforms the attributes of a record, returning the new attributes. The attributes it receives include
+// the ones added to the logger, nested inside their groups, with their values resolved. It must not modify the slice
+// it receives in place.
+//
+// The transforms in this package take keys as paths, with the keys of nested groups separated by dots, e.g.
+// "request.user.id".
+type Transform func(attrs []slog.Attr) []slog.Attr
+
+// RenameAttr returns a Transform that renames the attribute at the given path to the given key, keeping it in the
+// same group.
+func RenameAttr(path, key string) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		return updateAttr(
+			attrs, splitAttrPath(path), func(attr slog.Attr) (slog.Attr, bool) {
+				attr.Key = key
+				return attr, true
+			},
+		)
+	}
+}
+
+// DropAttrs returns a Transform that drops the attributes at the given paths.
+func DropAttrs(paths ...string) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		for _, path := range paths {
+			attrs = updateAttr(attrs, splitAttrPath(path), func(attr slog.Attr) (slog.Attr, bool) { return attr, false })
+		}
+		return attrs
+	}
+}
+
+// AddAttrs returns a Transform that adds the given attributes at the top level of every record, e.g. static fields
+// like the environment or version of the service.
+func AddAttrs(attrs ...slog.Attr) Transform {
+	return func(recordAttrs []slog.Attr) []slog.Attr {
+		return append(recordAttrs[:len(recordAttrs):len(recordAttrs)], attrs...)
+	}
+}
+
+// HashAttrs returns a Transform that replaces the values of the attributes at the given paths by the hex encoded
+// SHA-256 hash of their string representation, so that they can still be correlated without being revealed.
+func HashAttrs(paths ...string) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		for _, path := range paths {
+			attrs = updateAttr(
+				attrs, splitAttrPath(path), func(attr slog.Attr) (slog.Attr, bool) {
+					hash := sha256.Sum256([]byte(valueToString(attr.Value)))
+					return slog.String(attr.Key, hex.EncodeToString(hash[:])), true
+				},
+			)
+		}
+		return attrs
+	}
+}
+
+// TruncateStrings returns a Transform that truncates all string values longer than the given number of characters,
+// including the ones in groups, marking them with a trailing ellipsis. A negative length is treated as zero.
+func TruncateStrings(maxLength int) Transform {
+	maxLength = max(maxLength, 0)
+
+	var truncate func(attrs []slog.Attr) []slog.Attr
+	truncate = func(attrs []slog.Attr) []slog.Attr {
+		truncated := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			switch attr.Value.Kind() {
+			case slog.KindString:
+				if s := attr.Value.String(); utf8.RuneCountInString(s) > maxLength {
+					attr.Value = slog.StringValue(string([]rune(s)[:maxLength]) + "…")
+				}
+			case slog.KindGroup:
+				attr.Value = slog.GroupValue(truncate(attr.Value.Group())...)
+			}
+			truncated[i] = attr
+		}
+		return truncated
+	}
+	return truncate
+}
+
+// FlattenGroups returns a Transform that replaces all groups by their attributes at the top level, with their keys
+// qualified by the keys of the groups they were in, joined by the given separator, e.g. "request.method".
+func FlattenGroups(sep string) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		flattened := make([]slog.Attr, 0, len(attrs))
+		flattenAttrs(
+			"", sep, attrs, func(key string, value slog.Value) {
+				flattened = append(flattened, slog.Attr{Key: key, Value: value})
+			},
+		)
+		return flattened
+	}
+}
+
+// MoveToGroup returns a Transform that moves the attributes at the given paths into a group with the given key at
+// the top level, which is created if it doesn't exist.
+func MoveToGroup(group string, paths ...string) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		// Take the attributes out of wherever they are
+		var moved []slog.Attr
+		for _, path := range paths {
+			attrs = updateAttr(
+				attrs, splitAttrPath(path), func(attr slog.Attr) (slog.Attr, bool) {
+					moved = append(moved, attr)
+					return attr, false
+				},
+			)
+		}
+		if len(moved) == 0 {
+			return attrs
+		}
+
+		// Add them to the group, if it already exists
+		for i, attr := range attrs {
+			if attr.Key == group && attr.Value.Kind() == slog.KindGroup {
+				groupAttrs := attr.Value.Group()
+				groupAttrs = append(groupAttrs[:len(groupAttrs):len(groupAttrs)], moved...)
+				attrs = append(attrs[:0:0], attrs...)
+				attrs[i] = slog.Attr{Key: group, Value: slog.GroupValue(groupAttrs...)}
+				return attrs
+			}
+		}
+
+		return append(attrs[:len(attrs):len(attrs)], slog.Attr{Key: group, Value: slog.GroupValue(moved...)})
+	}
+}
+
+// ConvertAttr returns a Transform that converts the value of the attribute at the given path using the given
+// function, e.g. to log a duration as a number of milliseconds.
+func ConvertAttr(path string, convert func(slog.Value) slog.Value) Transform {
+	return func(attrs []slog.Attr) []slog.Attr {
+		return updateAttr(
+			attrs, splitAttrPath(path), func(attr slog.Attr) (slog.Attr, bool) {
+				attr.Value = convert(attr.Value).Resolve()
+				return attr, true
+			},
+		)
+	}
+}
+
+// splitAttrPath splits a path into the keys of the groups it goes through and the key of the attribute.
+func splitAttrPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// updateAttr returns a copy of attrs with every attribute at the given path replaced by the result of fn, or dropped
+// if fn returns false. Groups that end up with no attributes are dropped.
+func updateAttr(attrs []slog.Attr, path []string, fn func(slog.Attr) (slog.Attr, bool)) []slog.Attr {
+	updated := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr.Key != path[0] {
+			updated = append(updated, attr)
+			continue
+		}
+
+		// Update the attribute itself, if this is the end of the path
+		if len(path) == 1 {
+			if attr, keep := fn(attr); keep {
+				updated = append(updated, attr)
+			}
+			continue
+		}
+
+		// Otherwise, look for the rest of the path inside the group
+		if attr.Value.Kind() != slog.KindGroup {
+			updated = append(updated, attr)
+			continue
+		}
+		if groupAttrs := updateAttr(attr.Value.Group(), path[1:], fn); len(groupAttrs) > 0 {
+			updated = append(updated, slog.Attr{Key: attr.Key, Value: slog.GroupValue(groupAttrs...)})
+		}
+	}
+
+	return updated
+}
+
+// SortAttrs returns a Transform that sorts the attributes of records by their keys, including the attributes in
+// groups, so that records are written the same way regardless of the order their attributes were added in. Attributes
+// with the same key keep their order.
+func SortAttrs() Transform {
+	var sortAttrs func(attrs []slog.Attr) []slog.Attr
+	sortAttrs = func(attrs []slog.Attr) []slog.Attr {
+		sorted := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			if attr.Value.Kind() == slog.KindGroup {
+				attr.Value = slog.GroupValue(sortAttrs(attr.Value.Group())...)
+			}
+			sorted[i] = attr
+		}
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+		return sorted
+	}
+	return sortAttrs
+}
+
+// TransformHandler is a handler that passes records through a pipeline of transforms before passing them on to
+// another handler.
+//
+// Unlike slog.HandlerOptions.ReplaceAttr, transforms work on all the attributes of a record at once, including the
+// ones added to the logger, and work with any handler, e.g. third-party children of a CombinedHandler.
+type TransformHandler struct {
+	handler    slog.Handler
+	transforms []Transform
+	goas       []groupOrAttrs
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *TransformHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle passes the attributes of the record through the transforms, in order, and passes the record on to the
+// wrapped handler with the transformed attributes.
+func (h *TransformHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := collectAttrs(h.goas, record, nil)
+	for _, transform := range h.transforms {
+		attrs = transform(attrs)
+	}
+	return h.handler.Handle(ctx, recordWithAttrs(record, attrs))
+}
+
+// WithAttrs returns a new TransformHandler whose attributes consist of both the receiver's attributes and the
+// arguments.
+func (h *TransformHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &TransformHandler{
+		handler:    h.handler,
+		transforms: h.transforms,
+		goas:       withGroupOrAttrs(h.goas, groupOrAttrs{attrs: attrs}),
+	}
+}
+
+// WithGroup returns a new TransformHandler with the given group appended to the receiver's existing groups.
+//
+// If the name is empty, WithGroup returns the receiver.
+func (h *TransformHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &TransformHandler{
+		handler:    h.handler,
+		transforms: h.transforms,
+		goas:       withGroupOrAttrs(h.goas, groupOrAttrs{group: name}),
+	}
+}
+
+// NewTransformHandler returns a TransformHandler that passes records through the given transforms, in order, before
+// passing them on to the given handler.
+func NewTransformHandler(handler slog.Handler, transforms ...Transform) slog.Handler {
+	return &TransformHandler{handler: handler, transforms: transforms}
+}
@@ -0,0 +1,124 @@
+package loggy_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ksdfg/loggy"
+)
+
+// TestNewTransformHandler tests the TransformHandler returned by NewTransformHandler with a pipeline of transforms
+// that rename, drop, add, hash, truncate, move and convert attributes, including the ones added to the logger.
+func TestNewTransformHandler(t *testing.T) {
+	// Create a logger that transforms records before logging them to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewTransformHandler(
+		slog.NewJSONHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}),
+		loggy.RenameAttr("svc", "service"),
+		loggy.DropAttrs("request.debug", "internal"),
+		loggy.AddAttrs(slog.String("env", "prod")),
+		loggy.TruncateStrings(5),
+		loggy.HashAttrs("request.user"),
+		loggy.MoveToGroup("request", "client_ip"),
+		loggy.ConvertAttr(
+			"request.duration", func(v slog.Value) slog.Value { return slog.Int64Value(v.Duration().Milliseconds()) },
+		),
+	)
+	logger := slog.New(handler).With("svc", "api", "client_ip", "10.0.0.1").WithGroup("request")
+
+	// Log a record
+	logger.Info(
+		"request served",
+		"user", "jane",
+		"debug", true,
+		"duration", 1500*time.Millisecond,
+		"path", "/users/42",
+		slog.Group("", "internal", "x"),
+	)
+
+	// Check the output
+	logs := decodeJSONLogs(t, outputStream.String())
+	if !assert.Len(t, logs, 1) {
+		return
+	}
+	userHash := sha256.Sum256([]byte("jane"))
+	assert.Equal(
+		t,
+		map[string]any{
+			"level":   "INFO",
+			"msg":     "request served",
+			"service": "api",
+			"env":     "prod",
+			"request": map[string]any{
+				"user":      hex.EncodeToString(userHash[:]),
+				"duration":  float64(1500),
+				"path":      "/user…",
+				"internal":  "x",
+				"client_ip": "10.0.…",
+			},
+		},
+		logs[0],
+	)
+}
+
+// TestNewTransformHandler_FlattenGroups tests the TransformHandler returned by NewTransformHandler with a transform
+// that flattens groups, which should work with handlers that don't support groups well.
+func TestNewTransformHandler_FlattenGroups(t *testing.T) {
+	// Create a logger that flattens groups before logging them to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewTransformHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}), loggy.FlattenGroups("_"),
+	)
+	logger := slog.New(handler).WithGroup("request")
+
+	// Log a record with nested groups
+	logger.Info("request served", slog.Group("user", "id", 42), "method", "GET")
+
+	// Check the output
+	assert.Equal(
+		t, "level=INFO msg=\"request served\" request_user_id=42 request_method=GET\n", outputStream.String(),
+	)
+}
+
+// TestNewTransformHandler_SortAttrs tests the TransformHandler returned by NewTransformHandler with the SortAttrs
+// transform, which should sort the attributes in groups too, and keep attributes with the same key in order.
+func TestNewTransformHandler_SortAttrs(t *testing.T) {
+	// Create a logger that sorts attributes before logging them to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewTransformHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}), loggy.SortAttrs(),
+	)
+	logger := slog.New(handler).With("service", "api")
+
+	// Log a record with attributes out of order
+	logger.Info("sorted", "zone", "eu", slog.Group("request", "path", "/", "method", "GET"), "b", 1, "b", 2, "a", 0)
+
+	// Check the output
+	assert.Equal(
+		t,
+		"level=INFO msg=sorted a=0 b=1 b=2 request.method=GET request.path=/ service=api zone=eu\n",
+		outputStream.String(),
+	)
+}
+
+// TestNewTransformHandler_TruncateStringsNegative tests the TransformHandler returned by NewTransformHandler with the
+// TruncateStrings transform and a negative length, which should truncate strings to nothing instead of panicking.
+func TestNewTransformHandler_TruncateStringsNegative(t *testing.T) {
+	// Create a logger that truncates strings before logging them to a buffer
+	var outputStream strings.Builder
+	handler := loggy.NewTransformHandler(
+		slog.NewTextHandler(&outputStream, &slog.HandlerOptions{ReplaceAttr: removeTime}), loggy.TruncateStrings(-1),
+	)
+
+	// Log a record with a string and an empty string
+	slog.New(handler).Info("truncated", "user", "jane", "empty", "")
+
+	// Check the output
+	assert.Equal(t, "level=INFO msg=truncated user=… empty=\"\"\n", outputStream.String())
+}
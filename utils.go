@@ -1,12 +1,21 @@
 package loggy
 
 import (
+	"errors"
 	"fmt"
-	"log/slog"
 	"strings"
 )
 
-func checkLevel(log string, level slog.Level) bool {
-	return strings.Contains(log, fmt.Sprintf("level=%s", level.String())) ||
-		strings.Contains(log, fmt.Sprintf("\"level\":\"%s\"", level.String()))
+// ErrHandlerClosed is returned when a record is handled by a handler that sends records over a connection after it
+// has been closed.
+var ErrHandlerClosed = errors.New("loggy: handler is closed")
+
+// reservedKeyPrefix is the prefix added to the keys of attributes that would otherwise overwrite the fields that the
+// structured handlers write the built-in values of records to, e.g. an attribute with the key "message".
+const reservedKeyPrefix = "attrs."
+
+// checkLevel checks whether the log message, formatted as text or JSON, has the given value for the level key.
+func checkLevel(log, key, value string) bool {
+	return strings.Contains(log, fmt.Sprintf("%s=%s", key, value)) ||
+		strings.Contains(log, fmt.Sprintf("\"%s\":\"%s\"", key, value))
 }